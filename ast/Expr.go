@@ -10,9 +10,14 @@ type ExprVisitor interface {
 	VisitTernary(expr *TernaryExpr) (any, error)
 	VisitAssign(expr *AssignExpr) (any, error)
 	VisitBinary(expr *BinaryExpr) (any, error)
+	VisitCall(expr *CallExpr) (any, error)
+	VisitGet(expr *GetExpr) (any, error)
 	VisitGrouping(expr *GroupingExpr) (any, error)
 	VisitLiteral(expr *LiteralExpr) (any, error)
 	VisitLogical(expr *LogicalExpr) (any, error)
+	VisitSet(expr *SetExpr) (any, error)
+	VisitSuper(expr *SuperExpr) (any, error)
+	VisitThis(expr *ThisExpr) (any, error)
 	VisitUnary(expr *UnaryExpr) (any, error)
 	VisitVariable(expr *VariableExpr) (any, error)
 }
@@ -47,6 +52,25 @@ func (e *BinaryExpr) Accept(visitor ExprVisitor) (any, error) {
 	return visitor.VisitBinary(e)
 }
 
+type CallExpr struct {
+	Callee    Expr
+	Paren     token.Token
+	Arguments []Expr
+}
+
+func (e *CallExpr) Accept(visitor ExprVisitor) (any, error) {
+	return visitor.VisitCall(e)
+}
+
+type GetExpr struct {
+	Object Expr
+	Name   token.Token
+}
+
+func (e *GetExpr) Accept(visitor ExprVisitor) (any, error) {
+	return visitor.VisitGet(e)
+}
+
 type GroupingExpr struct {
 	Expression Expr
 }
@@ -56,6 +80,7 @@ func (e *GroupingExpr) Accept(visitor ExprVisitor) (any, error) {
 }
 
 type LiteralExpr struct {
+	Token token.Token
 	Value any
 }
 
@@ -73,6 +98,33 @@ func (e *LogicalExpr) Accept(visitor ExprVisitor) (any, error) {
 	return visitor.VisitLogical(e)
 }
 
+type SetExpr struct {
+	Object Expr
+	Name   token.Token
+	Value  Expr
+}
+
+func (e *SetExpr) Accept(visitor ExprVisitor) (any, error) {
+	return visitor.VisitSet(e)
+}
+
+type SuperExpr struct {
+	Keyword token.Token
+	Method  token.Token
+}
+
+func (e *SuperExpr) Accept(visitor ExprVisitor) (any, error) {
+	return visitor.VisitSuper(e)
+}
+
+type ThisExpr struct {
+	Keyword token.Token
+}
+
+func (e *ThisExpr) Accept(visitor ExprVisitor) (any, error) {
+	return visitor.VisitThis(e)
+}
+
 type UnaryExpr struct {
 	Operator token.Token
 	Right    Expr
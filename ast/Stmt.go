@@ -8,9 +8,12 @@ type Stmt interface {
 
 type StmtVisitor interface {
 	VisitBlock(stmt *BlockStmt) (any, error)
+	VisitClass(stmt *ClassStmt) (any, error)
 	VisitExpression(stmt *ExpressionStmt) (any, error)
+	VisitFunction(stmt *FunctionStmt) (any, error)
 	VisitIf(stmt *IfStmt) (any, error)
 	VisitPrint(stmt *PrintStmt) (any, error)
+	VisitReturn(stmt *ReturnStmt) (any, error)
 	VisitVar(stmt *VarStmt) (any, error)
 	VisitWhile(stmt *WhileStmt) (any, error)
 }
@@ -23,6 +26,16 @@ func (e *BlockStmt) Accept(visitor StmtVisitor) (any, error) {
 	return visitor.VisitBlock(e)
 }
 
+type ClassStmt struct {
+	Name       token.Token
+	Superclass *VariableExpr
+	Methods    []*FunctionStmt
+}
+
+func (e *ClassStmt) Accept(visitor StmtVisitor) (any, error) {
+	return visitor.VisitClass(e)
+}
+
 type ExpressionStmt struct {
 	Expression Expr
 }
@@ -31,7 +44,18 @@ func (e *ExpressionStmt) Accept(visitor StmtVisitor) (any, error) {
 	return visitor.VisitExpression(e)
 }
 
+type FunctionStmt struct {
+	Name   token.Token
+	Params []token.Token
+	Body   []Stmt
+}
+
+func (e *FunctionStmt) Accept(visitor StmtVisitor) (any, error) {
+	return visitor.VisitFunction(e)
+}
+
 type IfStmt struct {
+	Keyword    token.Token
 	Condition  Expr
 	ThenBranch Stmt
 	ElseBranch Stmt
@@ -42,6 +66,7 @@ func (e *IfStmt) Accept(visitor StmtVisitor) (any, error) {
 }
 
 type PrintStmt struct {
+	Keyword    token.Token
 	Expression Expr
 }
 
@@ -49,6 +74,15 @@ func (e *PrintStmt) Accept(visitor StmtVisitor) (any, error) {
 	return visitor.VisitPrint(e)
 }
 
+type ReturnStmt struct {
+	Keyword token.Token
+	Value   Expr
+}
+
+func (e *ReturnStmt) Accept(visitor StmtVisitor) (any, error) {
+	return visitor.VisitReturn(e)
+}
+
 type VarStmt struct {
 	Name        token.Token
 	Initializer Expr
@@ -59,6 +93,7 @@ func (e *VarStmt) Accept(visitor StmtVisitor) (any, error) {
 }
 
 type WhileStmt struct {
+	Keyword   token.Token
 	Condition Expr
 	Body      Stmt
 }
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"dsoechting/glox/compile"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const COMPILED_EXTENSION = ".gloxc"
+
+// glox build [-o output.gloxc] script
+// Compiles a script ahead of time, so running it skips scanning, parsing, and compiling
+func (g *Glox) build(args []string) int {
+	flags := flag.NewFlagSet("build", flag.ExitOnError)
+	output := flags.String("o", "", "output path, defaults to the script path with a "+COMPILED_EXTENSION+" extension")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		fmt.Fprintln(g.options.Stderr, "Usage glox build [-o output.gloxc] script")
+		return 64
+	}
+	path := flags.Arg(0)
+
+	function, exitCode := g.compileFile(path)
+	if function == nil {
+		return exitCode
+	}
+
+	outputPath := *output
+	if outputPath == "" {
+		outputPath = strings.TrimSuffix(path, filepath.Ext(path)) + COMPILED_EXTENSION
+	}
+
+	var encoded bytes.Buffer
+	encodeErr := compile.Encode(&encoded, function)
+	if encodeErr == nil {
+		encodeErr = os.WriteFile(outputPath, encoded.Bytes(), 0644)
+	}
+	if encodeErr != nil {
+		fmt.Fprintln(g.options.Stderr, encodeErr)
+		return 74
+	}
+	return 0
+}
+
+// glox disasm script
+// Prints the bytecode for either a source script or an already compiled one
+func (g *Glox) disassemble(args []string) int {
+	if len(args) != 1 {
+		fmt.Fprintln(g.options.Stderr, "Usage glox disasm script")
+		return 64
+	}
+
+	function, exitCode := g.compileFile(args[0])
+	if function == nil {
+		return exitCode
+	}
+	compile.Disassemble(g.options.Stdout, function)
+	return 0
+}
+
+func (g *Glox) runCompiled(data []byte) {
+	function, decodeErr := compile.Decode(data)
+	if decodeErr != nil {
+		g.report(decodeErr)
+		return
+	}
+
+	_, runErr := g.vm.Interpret(function)
+	if runErr != nil {
+		g.report(runErr)
+	}
+}
+
+// Returns the compiled script, or nil and the exit code to use
+func (g *Glox) compileFile(path string) (*compile.Function, int) {
+	data, readErr := os.ReadFile(path)
+	if readErr != nil {
+		fmt.Fprintln(g.options.Stderr, readErr)
+		return nil, 66
+	}
+	g.file = path
+
+	if compile.IsCompiled(data) {
+		function, decodeErr := compile.Decode(data)
+		if decodeErr != nil {
+			g.report(decodeErr)
+			return nil, 65
+		}
+		return function, 0
+	}
+
+	g.source = string(data)
+	statements, isParsed := g.parse(g.source)
+	if !isParsed {
+		return nil, 65
+	}
+	function, compileErr := compile.Compile(statements)
+	if compileErr != nil {
+		g.report(compileErr)
+		return nil, 65
+	}
+	return function, 0
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"dsoechting/glox/debug"
+	"dsoechting/glox/parse"
+	"dsoechting/glox/repl"
+	"dsoechting/glox/scanner"
+	"dsoechting/glox/tools/printer"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// The REPL's : commands, for looking inside the session
+func (g *Glox) replCommands() *repl.Commands {
+	commands := repl.CreateCommands(g.options.Stdout)
+	commands.Add(repl.Command{Name: "env", Usage: ":env", Help: "show every variable in the session", Run: g.showEnvironment})
+	commands.Add(repl.Command{Name: "load", Usage: ":load file.glox", Help: "run a script into the session", Run: g.loadFile})
+	commands.Add(repl.Command{Name: "reset", Usage: ":reset", Help: "forget every variable, starting a fresh session", Run: g.resetSession})
+	commands.Add(repl.Command{Name: "ast", Usage: ":ast expression", Help: "show the parse tree of an expression", Run: g.showAst})
+	commands.Add(repl.Command{Name: "tokens", Usage: ":tokens source", Help: "show what the scanner makes of source", Run: g.showTokens})
+	commands.Add(repl.Command{Name: "time", Usage: ":time statement", Help: "run a statement and show how long it took", Run: g.timeStatement})
+	return commands
+}
+
+func (g *Glox) showEnvironment(args string) error {
+	if args != "" {
+		return repl.ErrUsage
+	}
+	if g.backend != VM_BACKEND {
+		debug.PrintScopes(g.options.Stdout, g.interpreter.Environment())
+		return nil
+	}
+
+	// The VM keeps locals on its stack, between lines only globals are left
+	globals := g.vm.Globals()
+	names := make([]string, 0, len(globals))
+	for name := range globals {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fmt.Fprintln(g.options.Stdout, "globals:")
+	for _, name := range names {
+		value := globals[name]
+		text := value.String()
+		if value.IsString() {
+			text = strconv.Quote(text)
+		}
+		fmt.Fprintf(g.options.Stdout, "  %s = %s\n", name, text)
+	}
+	return nil
+}
+
+func (g *Glox) loadFile(path string) error {
+	if path == "" {
+		return repl.ErrUsage
+	}
+	data, readErr := os.ReadFile(path)
+	if readErr != nil {
+		return readErr
+	}
+	previous := g.file
+	g.file = path
+	defer func() { g.file = previous }()
+	g.printEchoes(g.run(string(data)))
+	return nil
+}
+
+func (g *Glox) resetSession(args string) error {
+	if args != "" {
+		return repl.ErrUsage
+	}
+	fresh := Create(g.backend, g.options)
+	g.interpreter, g.vm = fresh.interpreter, fresh.vm
+	fmt.Fprintln(g.options.Stdout, "Session reset.")
+	return nil
+}
+
+func (g *Glox) showAst(source string) error {
+	if source == "" {
+		return repl.ErrUsage
+	}
+	g.source = source
+	tokens, scanErr := scanner.Create(source).ScanTokens()
+	if scanErr != nil {
+		g.report(scanErr)
+		return nil
+	}
+	parser := parse.Create(tokens)
+	expr, parseErr := parser.ParseExpression()
+	if parseErr != nil {
+		g.report(parseErr)
+		return nil
+	}
+	astPrinter := printer.AstPrinter{}
+	fmt.Fprintln(g.options.Stdout, astPrinter.Print(expr))
+	return nil
+}
+
+func (g *Glox) showTokens(source string) error {
+	if source == "" {
+		return repl.ErrUsage
+	}
+	g.source = source
+	tokens, scanErr := scanner.Create(source).ScanTokens()
+	if scanErr != nil {
+		g.report(scanErr)
+		return nil
+	}
+	for _, tok := range tokens {
+		fmt.Fprintf(g.options.Stdout, "%-14s %s\n", tok.TokenType, tok.Lexeme)
+	}
+	return nil
+}
+
+func (g *Glox) timeStatement(source string) error {
+	if source == "" {
+		return repl.ErrUsage
+	}
+	start := time.Now()
+	echoes := g.run(source)
+	elapsed := time.Since(start)
+	g.printEchoes(echoes)
+	fmt.Fprintf(g.options.Stdout, "Took %s\n", elapsed.Round(time.Microsecond))
+	return nil
+}
@@ -0,0 +1,115 @@
+package compile
+
+import (
+	glox_error "dsoechting/glox/error"
+	"sort"
+)
+
+type OpCode byte
+
+// Operand sizes are noted next to each instruction. Constant pool indexes and
+// jump offsets are two bytes, big endian. Stack slots and upvalues are one byte
+const (
+	OP_CONSTANT      OpCode = iota // u16 constant
+	OP_NIL                         //
+	OP_TRUE                        //
+	OP_FALSE                       //
+	OP_POP                         //
+	OP_GET_LOCAL                   // u8 slot
+	OP_SET_LOCAL                   // u8 slot
+	OP_GET_GLOBAL                  // u16 name
+	OP_DEFINE_GLOBAL               // u16 name
+	OP_SET_GLOBAL                  // u16 name
+	OP_GET_UPVALUE                 // u8 upvalue
+	OP_SET_UPVALUE                 // u8 upvalue
+	OP_GET_PROPERTY                // u16 name
+	OP_SET_PROPERTY                // u16 name
+	OP_GET_SUPER                   // u16 name
+	OP_EQUAL                       //
+	OP_GREATER                     //
+	OP_LESS                        //
+	OP_ADD                         //
+	OP_SUBTRACT                    //
+	OP_MULTIPLY                    //
+	OP_DIVIDE                      //
+	OP_NOT                         //
+	OP_INVERT                      // flips a boolean the VM produced itself, unlike the checked OP_NOT
+	OP_NEGATE                      //
+	OP_PRINT                       //
+	OP_ECHO                        //
+	OP_JUMP                        // u16 forward offset
+	OP_JUMP_IF_FALSE               // u16 forward offset
+	OP_LOOP                        // u16 backward offset
+	OP_CALL                        // u8 argument count
+	OP_INVOKE                      // u16 name, u8 argument count
+	OP_SUPER_INVOKE                // u16 name, u8 argument count
+	OP_CLOSURE                     // u16 function, then a (u8 isLocal, u8 index) pair per upvalue
+	OP_CLOSE_UPVALUE               //
+	OP_RETURN                      //
+	OP_CLASS                       // u16 name
+	OP_INHERIT                     //
+	OP_METHOD                      // u16 name
+)
+
+// Source positions are run length encoded, since runs of instructions share a token.
+// Span is unknown for code the compiler made up
+type LineStart struct {
+	Offset int
+	Line   int
+	Span   glox_error.Span
+}
+
+type Chunk struct {
+	Code      []byte
+	Lines     []LineStart
+	Constants []Value
+}
+
+func CreateChunk() *Chunk {
+	return &Chunk{
+		Code:      []byte{},
+		Lines:     []LineStart{},
+		Constants: []Value{},
+	}
+}
+
+func (c *Chunk) Write(b byte, line int) {
+	c.WriteAt(b, line, glox_error.Span{})
+}
+
+// Writes a byte that came from the source text at span
+func (c *Chunk) WriteAt(b byte, line int, span glox_error.Span) {
+	if len(c.Lines) == 0 || c.Lines[len(c.Lines)-1].Line != line || c.Lines[len(c.Lines)-1].Span != span {
+		c.Lines = append(c.Lines, LineStart{
+			Offset: len(c.Code),
+			Line:   line,
+			Span:   span,
+		})
+	}
+	c.Code = append(c.Code, b)
+}
+
+func (c *Chunk) AddConstant(value Value) int {
+	c.Constants = append(c.Constants, value)
+	return len(c.Constants) - 1
+}
+
+// Finds the source line of the instruction at offset
+func (c *Chunk) GetLine(offset int) int {
+	return c.getPosition(offset).Line
+}
+
+// Finds the source text the instruction at offset was compiled from
+func (c *Chunk) GetSpan(offset int) glox_error.Span {
+	return c.getPosition(offset).Span
+}
+
+func (c *Chunk) getPosition(offset int) LineStart {
+	index := sort.Search(len(c.Lines), func(i int) bool {
+		return c.Lines[i].Offset > offset
+	})
+	if index == 0 {
+		return LineStart{}
+	}
+	return c.Lines[index-1]
+}
@@ -0,0 +1,819 @@
+package compile
+
+import (
+	"dsoechting/glox/ast"
+	glox_error "dsoechting/glox/error"
+	"dsoechting/glox/token"
+	"errors"
+	"fmt"
+	"math"
+)
+
+type Stmt = ast.Stmt
+type BlockStmt = ast.BlockStmt
+type ClassStmt = ast.ClassStmt
+type ExpressionStmt = ast.ExpressionStmt
+type FunctionStmt = ast.FunctionStmt
+type IfStmt = ast.IfStmt
+type PrintStmt = ast.PrintStmt
+type ReturnStmt = ast.ReturnStmt
+type VarStmt = ast.VarStmt
+type WhileStmt = ast.WhileStmt
+type Expr = ast.Expr
+type TernaryExpr = ast.TernaryExpr
+type AssignExpr = ast.AssignExpr
+type BinaryExpr = ast.BinaryExpr
+type CallExpr = ast.CallExpr
+type GetExpr = ast.GetExpr
+type GroupingExpr = ast.GroupingExpr
+type LiteralExpr = ast.LiteralExpr
+type LogicalExpr = ast.LogicalExpr
+type SetExpr = ast.SetExpr
+type SuperExpr = ast.SuperExpr
+type ThisExpr = ast.ThisExpr
+type UnaryExpr = ast.UnaryExpr
+type VariableExpr = ast.VariableExpr
+type Token = token.Token
+type CompileError = glox_error.CompileError
+
+// One byte operands for slots and upvalues
+const maxLocals = math.MaxUint8 + 1
+const maxUpvalues = math.MaxUint8 + 1
+
+type FunctionType int
+
+const (
+	TYPE_SCRIPT FunctionType = iota
+	TYPE_FUNCTION
+	TYPE_METHOD
+	TYPE_INITIALIZER
+)
+
+type local struct {
+	name string
+	// -1 until the variable's initializer has been compiled
+	depth      int
+	isCaptured bool
+}
+
+type upvalue struct {
+	index   byte
+	isLocal bool
+}
+
+// Per function state. Nested function declarations push a new one
+type functionCompiler struct {
+	enclosing    *functionCompiler
+	function     *Function
+	functionType FunctionType
+	locals       []local
+	upvalues     []upvalue
+	scopeDepth   int
+	// Reuses pool slots for repeated names and literals
+	constants map[Value]uint16
+}
+
+type classCompiler struct {
+	enclosing     *classCompiler
+	hasSuperclass bool
+}
+
+// Implements ExprVisitor and StmtVisitor
+// Lowers the tree into bytecode, resolving locals and upvalues to stack slots as it goes
+type Compiler struct {
+	current      *functionCompiler
+	currentClass *classCompiler
+	// Position of the last token we saw, stamped on every emitted byte
+	line   int
+	span   glox_error.Span
+	errors []error
+}
+
+// Compiles a whole script into the implicit top level function
+func Compile(statements []Stmt) (*Function, error) {
+	compiler := &Compiler{}
+	compiler.beginFunction("", TYPE_SCRIPT)
+
+	for _, stmt := range statements {
+		compiler.compileScriptStmt(stmt)
+	}
+
+	function := compiler.endFunction()
+	if len(compiler.errors) > 0 {
+		return nil, errors.Join(compiler.errors...)
+	}
+	return function, nil
+}
+
+func (c *Compiler) VisitBlock(stmt *BlockStmt) (any, error) {
+	c.beginScope()
+	for _, inner := range stmt.Statements {
+		c.compileStmt(inner)
+	}
+	c.endScope()
+	return nil, nil
+}
+
+func (c *Compiler) VisitClass(stmt *ClassStmt) (any, error) {
+	c.setPosition(stmt.Name)
+	nameConstant := c.identifierConstant(stmt.Name.Lexeme)
+	c.declareVariable(stmt.Name)
+
+	c.emitOpShort(OP_CLASS, nameConstant)
+	c.defineVariable(nameConstant)
+
+	classCompiler := &classCompiler{
+		enclosing: c.currentClass,
+	}
+	c.currentClass = classCompiler
+
+	if stmt.Superclass != nil {
+		if stmt.Superclass.Name.Lexeme == stmt.Name.Lexeme {
+			c.addError(glox_error.INHERITS_FROM_ITSELF, stmt.Superclass.Name, "A class can't inherit from itself.")
+		}
+		c.namedVariable(stmt.Superclass.Name, nil)
+
+		// "super" lives in a local scope wrapped around the methods
+		c.beginScope()
+		c.addLocal(syntheticToken("super", stmt.Superclass.Name.Line))
+		c.markInitialized()
+
+		c.namedVariable(stmt.Name, nil)
+		c.emitOp(OP_INHERIT)
+		classCompiler.hasSuperclass = true
+	}
+
+	// Leave the class on the stack while its methods are attached
+	c.namedVariable(stmt.Name, nil)
+	for _, method := range stmt.Methods {
+		functionType := TYPE_METHOD
+		if method.Name.Lexeme == "init" {
+			functionType = TYPE_INITIALIZER
+		}
+		c.function(method, functionType)
+		c.emitOpShort(OP_METHOD, c.identifierConstant(method.Name.Lexeme))
+	}
+	c.emitOp(OP_POP)
+
+	if classCompiler.hasSuperclass {
+		c.endScope()
+	}
+	c.currentClass = classCompiler.enclosing
+	return nil, nil
+}
+
+func (c *Compiler) VisitExpression(stmt *ExpressionStmt) (any, error) {
+	c.compileExpr(stmt.Expression)
+	c.emitOp(OP_POP)
+	return nil, nil
+}
+
+func (c *Compiler) VisitFunction(stmt *FunctionStmt) (any, error) {
+	c.setPosition(stmt.Name)
+	global := c.parseVariable(stmt.Name)
+	// Functions may refer to themselves, so they are usable before their body compiles
+	c.markInitialized()
+	c.function(stmt, TYPE_FUNCTION)
+	c.defineVariable(global)
+	return nil, nil
+}
+
+func (c *Compiler) VisitIf(stmt *IfStmt) (any, error) {
+	c.compileExpr(stmt.Condition)
+
+	thenJump := c.emitJump(OP_JUMP_IF_FALSE)
+	c.emitOp(OP_POP)
+	c.compileStmt(stmt.ThenBranch)
+
+	elseJump := c.emitJump(OP_JUMP)
+	c.patchJump(thenJump)
+	c.emitOp(OP_POP)
+
+	if stmt.ElseBranch != nil {
+		c.compileStmt(stmt.ElseBranch)
+	}
+	c.patchJump(elseJump)
+	return nil, nil
+}
+
+func (c *Compiler) VisitPrint(stmt *PrintStmt) (any, error) {
+	c.compileExpr(stmt.Expression)
+	c.emitOp(OP_PRINT)
+	return nil, nil
+}
+
+func (c *Compiler) VisitReturn(stmt *ReturnStmt) (any, error) {
+	c.setPosition(stmt.Keyword)
+	if c.current.functionType == TYPE_SCRIPT {
+		c.addError(glox_error.TOP_LEVEL_RETURN, stmt.Keyword, "Can't return from top-level code.")
+	}
+
+	if stmt.Value == nil {
+		c.emitReturn()
+		return nil, nil
+	}
+
+	if c.current.functionType == TYPE_INITIALIZER {
+		c.addError(glox_error.RETURN_VALUE_FROM_INITIALIZER, stmt.Keyword, "Can't return a value from an initializer.")
+	}
+	c.compileExpr(stmt.Value)
+	c.emitOp(OP_RETURN)
+	return nil, nil
+}
+
+func (c *Compiler) VisitVar(stmt *VarStmt) (any, error) {
+	c.setPosition(stmt.Name)
+	global := c.parseVariable(stmt.Name)
+
+	if stmt.Initializer != nil {
+		c.compileExpr(stmt.Initializer)
+	} else {
+		c.emitOp(OP_NIL)
+	}
+
+	c.defineVariable(global)
+	return nil, nil
+}
+
+func (c *Compiler) VisitWhile(stmt *WhileStmt) (any, error) {
+	loopStart := len(c.currentChunk().Code)
+	c.compileExpr(stmt.Condition)
+
+	exitJump := c.emitJump(OP_JUMP_IF_FALSE)
+	c.emitOp(OP_POP)
+	c.compileStmt(stmt.Body)
+	c.emitLoop(loopStart)
+
+	c.patchJump(exitJump)
+	c.emitOp(OP_POP)
+	return nil, nil
+}
+
+func (c *Compiler) VisitTernary(expr *TernaryExpr) (any, error) {
+	c.compileExpr(expr.First)
+
+	elseJump := c.emitJump(OP_JUMP_IF_FALSE)
+	c.emitOp(OP_POP)
+	c.compileExpr(expr.Second)
+
+	endJump := c.emitJump(OP_JUMP)
+	c.patchJump(elseJump)
+	c.emitOp(OP_POP)
+	c.compileExpr(expr.Third)
+
+	c.patchJump(endJump)
+	return nil, nil
+}
+
+func (c *Compiler) VisitAssign(expr *AssignExpr) (any, error) {
+	c.namedVariable(expr.Name, expr.Value)
+	return nil, nil
+}
+
+func (c *Compiler) VisitBinary(expr *BinaryExpr) (any, error) {
+	c.compileExpr(expr.Left)
+	c.compileExpr(expr.Right)
+
+	c.setPosition(expr.Operator)
+	switch expr.Operator.TokenType {
+	case token.EQUAL_EQUAL:
+		c.emitOp(OP_EQUAL)
+	case token.BANG_EQUAL:
+		c.emitOps(OP_EQUAL, OP_INVERT)
+	case token.GREATER:
+		c.emitOp(OP_GREATER)
+	case token.GREATER_EQUAL:
+		c.emitOps(OP_LESS, OP_INVERT)
+	case token.LESS:
+		c.emitOp(OP_LESS)
+	case token.LESS_EQUAL:
+		c.emitOps(OP_GREATER, OP_INVERT)
+	case token.PLUS:
+		c.emitOp(OP_ADD)
+	case token.MINUS:
+		c.emitOp(OP_SUBTRACT)
+	case token.STAR:
+		c.emitOp(OP_MULTIPLY)
+	case token.SLASH:
+		c.emitOp(OP_DIVIDE)
+	default:
+		c.addError(glox_error.UNSUPPORTED_OPERATOR, expr.Operator, fmt.Sprintf("Unsupported binary operator %s.", expr.Operator.TokenType))
+	}
+	return nil, nil
+}
+
+func (c *Compiler) VisitCall(expr *CallExpr) (any, error) {
+	// Method calls skip creating a bound method and invoke directly
+	switch callee := expr.Callee.(type) {
+	case *GetExpr:
+		c.compileExpr(callee.Object)
+		c.compileArguments(expr.Arguments)
+		c.setPosition(callee.Name)
+		c.emitOpShort(OP_INVOKE, c.identifierConstant(callee.Name.Lexeme))
+		c.emitByte(byte(len(expr.Arguments)))
+		return nil, nil
+	case *SuperExpr:
+		if !c.checkSuper(callee.Keyword) {
+			return nil, nil
+		}
+		c.namedVariable(syntheticToken("this", callee.Keyword.Line), nil)
+		c.compileArguments(expr.Arguments)
+		c.namedVariable(syntheticToken("super", callee.Keyword.Line), nil)
+		c.emitOpShort(OP_SUPER_INVOKE, c.identifierConstant(callee.Method.Lexeme))
+		c.emitByte(byte(len(expr.Arguments)))
+		return nil, nil
+	}
+
+	c.compileExpr(expr.Callee)
+	c.compileArguments(expr.Arguments)
+	c.setPosition(expr.Paren)
+	c.emitOp(OP_CALL)
+	c.emitByte(byte(len(expr.Arguments)))
+	return nil, nil
+}
+
+func (c *Compiler) VisitGet(expr *GetExpr) (any, error) {
+	c.compileExpr(expr.Object)
+	c.setPosition(expr.Name)
+	c.emitOpShort(OP_GET_PROPERTY, c.identifierConstant(expr.Name.Lexeme))
+	return nil, nil
+}
+
+func (c *Compiler) VisitGrouping(expr *GroupingExpr) (any, error) {
+	c.compileExpr(expr.Expression)
+	return nil, nil
+}
+
+func (c *Compiler) VisitLiteral(expr *LiteralExpr) (any, error) {
+	switch value := expr.Value.(type) {
+	case nil:
+		c.emitOp(OP_NIL)
+	case bool:
+		if value {
+			c.emitOp(OP_TRUE)
+		} else {
+			c.emitOp(OP_FALSE)
+		}
+	case float64:
+		c.emitConstant(NumberValue(value))
+	case string:
+		c.emitConstant(ObjValue(value))
+	default:
+		return nil, fmt.Errorf("Unsupported literal %v", value)
+	}
+	return nil, nil
+}
+
+func (c *Compiler) VisitLogical(expr *LogicalExpr) (any, error) {
+	c.compileExpr(expr.Left)
+
+	if expr.Operator.TokenType == token.OR {
+		elseJump := c.emitJump(OP_JUMP_IF_FALSE)
+		endJump := c.emitJump(OP_JUMP)
+
+		c.patchJump(elseJump)
+		c.emitOp(OP_POP)
+		c.compileExpr(expr.Right)
+		c.patchJump(endJump)
+		return nil, nil
+	}
+
+	endJump := c.emitJump(OP_JUMP_IF_FALSE)
+	c.emitOp(OP_POP)
+	c.compileExpr(expr.Right)
+	c.patchJump(endJump)
+	return nil, nil
+}
+
+func (c *Compiler) VisitSet(expr *SetExpr) (any, error) {
+	c.compileExpr(expr.Object)
+	c.compileExpr(expr.Value)
+	c.setPosition(expr.Name)
+	c.emitOpShort(OP_SET_PROPERTY, c.identifierConstant(expr.Name.Lexeme))
+	return nil, nil
+}
+
+func (c *Compiler) VisitSuper(expr *SuperExpr) (any, error) {
+	if !c.checkSuper(expr.Keyword) {
+		return nil, nil
+	}
+	c.namedVariable(syntheticToken("this", expr.Keyword.Line), nil)
+	c.namedVariable(syntheticToken("super", expr.Keyword.Line), nil)
+	c.emitOpShort(OP_GET_SUPER, c.identifierConstant(expr.Method.Lexeme))
+	return nil, nil
+}
+
+func (c *Compiler) VisitThis(expr *ThisExpr) (any, error) {
+	if c.currentClass == nil {
+		c.addError(glox_error.THIS_OUTSIDE_CLASS, expr.Keyword, "Can't use 'this' outside of a class.")
+		return nil, nil
+	}
+	c.namedVariable(expr.Keyword, nil)
+	return nil, nil
+}
+
+func (c *Compiler) VisitUnary(expr *UnaryExpr) (any, error) {
+	c.compileExpr(expr.Right)
+
+	c.setPosition(expr.Operator)
+	switch expr.Operator.TokenType {
+	case token.MINUS:
+		c.emitOp(OP_NEGATE)
+	case token.BANG:
+		c.emitOp(OP_NOT)
+	default:
+		c.addError(glox_error.UNSUPPORTED_OPERATOR, expr.Operator, fmt.Sprintf("Invalid Unary operator %s.", expr.Operator.TokenType))
+	}
+	return nil, nil
+}
+
+func (c *Compiler) VisitVariable(expr *VariableExpr) (any, error) {
+	c.namedVariable(expr.Name, nil)
+	return nil, nil
+}
+
+func (c *Compiler) compileStmt(stmt Stmt) {
+	_, err := stmt.Accept(c)
+	if err != nil {
+		c.errors = append(c.errors, err)
+	}
+}
+
+func (c *Compiler) compileExpr(expr Expr) {
+	_, err := expr.Accept(c)
+	if err != nil {
+		c.errors = append(c.errors, err)
+	}
+}
+
+func (c *Compiler) compileArguments(arguments []Expr) {
+	for _, argument := range arguments {
+		c.compileExpr(argument)
+	}
+}
+
+func (c *Compiler) beginFunction(name string, functionType FunctionType) {
+	fc := &functionCompiler{
+		enclosing: c.current,
+		function: &Function{
+			Name:  name,
+			Chunk: CreateChunk(),
+		},
+		functionType: functionType,
+		locals:       []local{},
+		upvalues:     []upvalue{},
+		constants:    make(map[Value]uint16),
+	}
+
+	// Slot zero holds the receiver for methods, and the callee otherwise
+	slotZero := ""
+	if functionType == TYPE_METHOD || functionType == TYPE_INITIALIZER {
+		slotZero = "this"
+	}
+	fc.locals = append(fc.locals, local{name: slotZero, depth: 0})
+
+	c.current = fc
+}
+
+func (c *Compiler) endFunction() *Function {
+	c.emitReturn()
+	function := c.current.function
+	c.current = c.current.enclosing
+	return function
+}
+
+func (c *Compiler) function(stmt *FunctionStmt, functionType FunctionType) {
+	c.beginFunction(stmt.Name.Lexeme, functionType)
+	c.beginScope()
+
+	for _, param := range stmt.Params {
+		c.current.function.Arity++
+		c.declareVariable(param)
+		c.markInitialized()
+	}
+	for _, bodyStmt := range stmt.Body {
+		c.compileStmt(bodyStmt)
+	}
+
+	// No endScope, the whole frame is discarded on return
+	upvalues := c.current.upvalues
+	function := c.endFunction()
+
+	c.setPosition(stmt.Name)
+	c.emitOpShort(OP_CLOSURE, c.makeConstant(ObjValue(function)))
+	for _, up := range upvalues {
+		if up.isLocal {
+			c.emitByte(1)
+		} else {
+			c.emitByte(0)
+		}
+		c.emitByte(up.index)
+	}
+}
+
+func (c *Compiler) beginScope() {
+	c.current.scopeDepth++
+}
+
+func (c *Compiler) endScope() {
+	c.current.scopeDepth--
+
+	locals := c.current.locals
+	for len(locals) > 0 && locals[len(locals)-1].depth > c.current.scopeDepth {
+		if locals[len(locals)-1].isCaptured {
+			c.emitOp(OP_CLOSE_UPVALUE)
+		} else {
+			c.emitOp(OP_POP)
+		}
+		locals = locals[:len(locals)-1]
+	}
+	c.current.locals = locals
+}
+
+// Hands values back so the REPL can show them, but only for expressions
+// written directly in the script, not in loop bodies or branches
+func (c *Compiler) compileScriptStmt(stmt Stmt) {
+	expression, isExpression := stmt.(*ExpressionStmt)
+	if !isExpression || isAssignment(expression.Expression) {
+		c.compileStmt(stmt)
+		return
+	}
+	c.compileExpr(expression.Expression)
+	c.emitOp(OP_ECHO)
+}
+
+func isAssignment(expr Expr) bool {
+	switch expr.(type) {
+	case *AssignExpr, *SetExpr:
+		return true
+	}
+	return false
+}
+
+// Declares the variable, returning the constant holding its name if it is a global
+func (c *Compiler) parseVariable(name Token) uint16 {
+	c.declareVariable(name)
+	if c.current.scopeDepth > 0 {
+		return 0
+	}
+	return c.identifierConstant(name.Lexeme)
+}
+
+func (c *Compiler) declareVariable(name Token) {
+	if c.current.scopeDepth == 0 {
+		return
+	}
+
+	for i := len(c.current.locals) - 1; i >= 0; i-- {
+		existing := c.current.locals[i]
+		if existing.depth != -1 && existing.depth < c.current.scopeDepth {
+			break
+		}
+		if existing.name == name.Lexeme {
+			c.addError(glox_error.ALREADY_DECLARED, name, "Already a variable with this name in this scope.")
+		}
+	}
+	c.addLocal(name)
+}
+
+func (c *Compiler) addLocal(name Token) {
+	if len(c.current.locals) == maxLocals {
+		c.addError(glox_error.TOO_MANY_LOCALS, name, "Too many local variables in function.")
+		return
+	}
+	c.current.locals = append(c.current.locals, local{
+		name:  name.Lexeme,
+		depth: -1,
+	})
+}
+
+func (c *Compiler) markInitialized() {
+	if c.current.scopeDepth == 0 {
+		return
+	}
+	c.current.locals[len(c.current.locals)-1].depth = c.current.scopeDepth
+}
+
+func (c *Compiler) defineVariable(global uint16) {
+	if c.current.scopeDepth > 0 {
+		// Locals are just the value left on the stack
+		c.markInitialized()
+		return
+	}
+	c.emitOpShort(OP_DEFINE_GLOBAL, global)
+}
+
+// Emits a read of the variable, or a write of value when it is not nil
+func (c *Compiler) namedVariable(name Token, value Expr) {
+	c.setPosition(name)
+
+	var getOp, setOp OpCode
+	var operand int
+	wide := false
+
+	if slot := c.resolveLocal(c.current, name); slot != -1 {
+		getOp, setOp, operand = OP_GET_LOCAL, OP_SET_LOCAL, slot
+	} else if index := c.resolveUpvalue(c.current, name); index != -1 {
+		getOp, setOp, operand = OP_GET_UPVALUE, OP_SET_UPVALUE, index
+	} else {
+		getOp, setOp = OP_GET_GLOBAL, OP_SET_GLOBAL
+		operand = int(c.identifierConstant(name.Lexeme))
+		wide = true
+	}
+
+	op := getOp
+	if value != nil {
+		c.compileExpr(value)
+		c.setPosition(name)
+		op = setOp
+	}
+
+	if wide {
+		c.emitOpShort(op, uint16(operand))
+	} else {
+		c.emitOp(op)
+		c.emitByte(byte(operand))
+	}
+}
+
+func (c *Compiler) resolveLocal(fc *functionCompiler, name Token) int {
+	for i := len(fc.locals) - 1; i >= 0; i-- {
+		if fc.locals[i].name == name.Lexeme {
+			if fc.locals[i].depth == -1 {
+				c.addError(glox_error.READ_IN_OWN_INITIALIZER, name, "Can't read local variable in its own initializer.")
+			}
+			return i
+		}
+	}
+	return -1
+}
+
+// Finds the variable in an enclosing function, threading it down through an
+// upvalue in every function in between
+func (c *Compiler) resolveUpvalue(fc *functionCompiler, name Token) int {
+	if fc.enclosing == nil {
+		return -1
+	}
+
+	if slot := c.resolveLocal(fc.enclosing, name); slot != -1 {
+		fc.enclosing.locals[slot].isCaptured = true
+		return c.addUpvalue(fc, byte(slot), true, name)
+	}
+
+	if index := c.resolveUpvalue(fc.enclosing, name); index != -1 {
+		return c.addUpvalue(fc, byte(index), false, name)
+	}
+	return -1
+}
+
+func (c *Compiler) addUpvalue(fc *functionCompiler, index byte, isLocal bool, name Token) int {
+	for i, existing := range fc.upvalues {
+		if existing.index == index && existing.isLocal == isLocal {
+			return i
+		}
+	}
+
+	if len(fc.upvalues) == maxUpvalues {
+		c.addError(glox_error.TOO_MANY_UPVALUES, name, "Too many closure variables in function.")
+		return 0
+	}
+
+	fc.upvalues = append(fc.upvalues, upvalue{
+		index:   index,
+		isLocal: isLocal,
+	})
+	fc.function.UpvalueCount = len(fc.upvalues)
+	return len(fc.upvalues) - 1
+}
+
+func (c *Compiler) checkSuper(keyword Token) bool {
+	if c.currentClass == nil {
+		c.addError(glox_error.SUPER_OUTSIDE_CLASS, keyword, "Can't use 'super' outside of a class.")
+		return false
+	}
+	if !c.currentClass.hasSuperclass {
+		c.addError(glox_error.SUPER_WITHOUT_SUPERCLASS, keyword, "Can't use 'super' in a class with no superclass.")
+		return false
+	}
+	return true
+}
+
+func (c *Compiler) currentChunk() *Chunk {
+	return c.current.function.Chunk
+}
+
+func (c *Compiler) setPosition(tok Token) {
+	c.line = tok.Line
+	c.span = glox_error.SpanOf(tok)
+}
+
+func (c *Compiler) emitByte(b byte) {
+	c.currentChunk().WriteAt(b, c.line, c.span)
+}
+
+func (c *Compiler) emitOp(op OpCode) {
+	c.emitByte(byte(op))
+}
+
+func (c *Compiler) emitOps(first OpCode, second OpCode) {
+	c.emitOp(first)
+	c.emitOp(second)
+}
+
+func (c *Compiler) emitShort(operand uint16) {
+	c.emitByte(byte(operand >> 8))
+	c.emitByte(byte(operand))
+}
+
+func (c *Compiler) emitOpShort(op OpCode, operand uint16) {
+	c.emitOp(op)
+	c.emitShort(operand)
+}
+
+func (c *Compiler) emitReturn() {
+	if c.current.functionType == TYPE_INITIALIZER {
+		c.emitOp(OP_GET_LOCAL)
+		c.emitByte(0)
+	} else {
+		c.emitOp(OP_NIL)
+	}
+	c.emitOp(OP_RETURN)
+}
+
+func (c *Compiler) emitConstant(value Value) {
+	c.emitOpShort(OP_CONSTANT, c.makeConstant(value))
+}
+
+func (c *Compiler) makeConstant(value Value) uint16 {
+	// Functions are unique, so only names and literals are worth sharing
+	reusable := value.Type != VAL_OBJ || value.IsString()
+	if reusable {
+		if index, isPresent := c.current.constants[value]; isPresent {
+			return index
+		}
+	}
+
+	index := c.currentChunk().AddConstant(value)
+	if index > math.MaxUint16 {
+		c.addLineError(glox_error.TOO_MANY_CONSTANTS, "Too many constants in one chunk.")
+		return 0
+	}
+	if reusable {
+		c.current.constants[value] = uint16(index)
+	}
+	return uint16(index)
+}
+
+func (c *Compiler) identifierConstant(name string) uint16 {
+	return c.makeConstant(ObjValue(name))
+}
+
+// Emits a jump with a placeholder offset, returning where to patch it
+func (c *Compiler) emitJump(op OpCode) int {
+	c.emitOp(op)
+	c.emitShort(0xffff)
+	return len(c.currentChunk().Code) - 2
+}
+
+func (c *Compiler) patchJump(offset int) {
+	code := c.currentChunk().Code
+	// -2 to skip over the jump offset itself
+	jump := len(code) - offset - 2
+	if jump > math.MaxUint16 {
+		c.addLineError(glox_error.JUMP_TOO_LARGE, "Too much code to jump over.")
+		return
+	}
+	code[offset] = byte(jump >> 8)
+	code[offset+1] = byte(jump)
+}
+
+func (c *Compiler) emitLoop(loopStart int) {
+	c.emitOp(OP_LOOP)
+	offset := len(c.currentChunk().Code) - loopStart + 2
+	if offset > math.MaxUint16 {
+		c.addLineError(glox_error.JUMP_TOO_LARGE, "Loop body too large.")
+	}
+	c.emitShort(uint16(offset))
+}
+
+func (c *Compiler) addError(code glox_error.Code, tokenWithError Token, message string) {
+	c.errors = append(c.errors, createCompileError(code, tokenWithError, message))
+}
+
+// For limits hit while emitting code, where only the current line is known
+func (c *Compiler) addLineError(code glox_error.Code, message string) {
+	c.errors = append(c.errors, &CompileError{Diagnostic: glox_error.Create(code, c.line, "", message)})
+}
+
+func createCompileError(code glox_error.Code, tokenWithError Token, message string) *CompileError {
+	where := fmt.Sprintf(" at '%s'", tokenWithError.Lexeme)
+	return &CompileError{Diagnostic: glox_error.CreateAt(code, tokenWithError, where, message)}
+}
+
+func syntheticToken(lexeme string, line int) Token {
+	return Token{
+		TokenType: token.IDENTIFIER,
+		Lexeme:    lexeme,
+		Line:      line,
+	}
+}
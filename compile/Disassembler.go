@@ -0,0 +1,151 @@
+package compile
+
+import (
+	"fmt"
+	"io"
+)
+
+var opNames = map[OpCode]string{
+	OP_CONSTANT:      "OP_CONSTANT",
+	OP_NIL:           "OP_NIL",
+	OP_TRUE:          "OP_TRUE",
+	OP_FALSE:         "OP_FALSE",
+	OP_POP:           "OP_POP",
+	OP_GET_LOCAL:     "OP_GET_LOCAL",
+	OP_SET_LOCAL:     "OP_SET_LOCAL",
+	OP_GET_GLOBAL:    "OP_GET_GLOBAL",
+	OP_DEFINE_GLOBAL: "OP_DEFINE_GLOBAL",
+	OP_SET_GLOBAL:    "OP_SET_GLOBAL",
+	OP_GET_UPVALUE:   "OP_GET_UPVALUE",
+	OP_SET_UPVALUE:   "OP_SET_UPVALUE",
+	OP_GET_PROPERTY:  "OP_GET_PROPERTY",
+	OP_SET_PROPERTY:  "OP_SET_PROPERTY",
+	OP_GET_SUPER:     "OP_GET_SUPER",
+	OP_EQUAL:         "OP_EQUAL",
+	OP_GREATER:       "OP_GREATER",
+	OP_LESS:          "OP_LESS",
+	OP_ADD:           "OP_ADD",
+	OP_SUBTRACT:      "OP_SUBTRACT",
+	OP_MULTIPLY:      "OP_MULTIPLY",
+	OP_DIVIDE:        "OP_DIVIDE",
+	OP_NOT:           "OP_NOT",
+	OP_INVERT:        "OP_INVERT",
+	OP_NEGATE:        "OP_NEGATE",
+	OP_PRINT:         "OP_PRINT",
+	OP_ECHO:          "OP_ECHO",
+	OP_JUMP:          "OP_JUMP",
+	OP_JUMP_IF_FALSE: "OP_JUMP_IF_FALSE",
+	OP_LOOP:          "OP_LOOP",
+	OP_CALL:          "OP_CALL",
+	OP_INVOKE:        "OP_INVOKE",
+	OP_SUPER_INVOKE:  "OP_SUPER_INVOKE",
+	OP_CLOSURE:       "OP_CLOSURE",
+	OP_CLOSE_UPVALUE: "OP_CLOSE_UPVALUE",
+	OP_RETURN:        "OP_RETURN",
+	OP_CLASS:         "OP_CLASS",
+	OP_INHERIT:       "OP_INHERIT",
+	OP_METHOD:        "OP_METHOD",
+}
+
+func (op OpCode) String() string {
+	name, isPresent := opNames[op]
+	if !isPresent {
+		return fmt.Sprintf("OpCode(%d)", byte(op))
+	}
+	return name
+}
+
+// Prints every instruction of the function, then of each function nested in its constants
+func Disassemble(w io.Writer, function *Function) {
+	DisassembleChunk(w, function.Chunk, function.String())
+	for _, constant := range function.Chunk.Constants {
+		nested, isFunction := constant.Obj.(*Function)
+		if isFunction {
+			fmt.Fprintln(w)
+			Disassemble(w, nested)
+		}
+	}
+}
+
+func DisassembleChunk(w io.Writer, chunk *Chunk, name string) {
+	fmt.Fprintf(w, "== %s ==\n", name)
+	for offset := 0; offset < len(chunk.Code); {
+		offset = DisassembleInstruction(w, chunk, offset)
+	}
+}
+
+// Prints the instruction at offset and returns the offset of the next one
+func DisassembleInstruction(w io.Writer, chunk *Chunk, offset int) int {
+	fmt.Fprintf(w, "%04d ", offset)
+	line := chunk.GetLine(offset)
+	if offset > 0 && line == chunk.GetLine(offset-1) {
+		fmt.Fprint(w, "   | ")
+	} else {
+		fmt.Fprintf(w, "%4d ", line)
+	}
+
+	op := OpCode(chunk.Code[offset])
+	switch op {
+	case OP_CONSTANT, OP_GET_GLOBAL, OP_DEFINE_GLOBAL, OP_SET_GLOBAL,
+		OP_GET_PROPERTY, OP_SET_PROPERTY, OP_GET_SUPER, OP_CLASS, OP_METHOD:
+		return constantInstruction(w, op, chunk, offset)
+	case OP_GET_LOCAL, OP_SET_LOCAL, OP_GET_UPVALUE, OP_SET_UPVALUE, OP_CALL:
+		return byteInstruction(w, op, chunk, offset)
+	case OP_JUMP, OP_JUMP_IF_FALSE:
+		return jumpInstruction(w, op, 1, chunk, offset)
+	case OP_LOOP:
+		return jumpInstruction(w, op, -1, chunk, offset)
+	case OP_INVOKE, OP_SUPER_INVOKE:
+		return invokeInstruction(w, op, chunk, offset)
+	case OP_CLOSURE:
+		return closureInstruction(w, chunk, offset)
+	}
+	fmt.Fprintln(w, op)
+	return offset + 1
+}
+
+func readShort(chunk *Chunk, offset int) uint16 {
+	return uint16(chunk.Code[offset])<<8 | uint16(chunk.Code[offset+1])
+}
+
+func constantInstruction(w io.Writer, op OpCode, chunk *Chunk, offset int) int {
+	constant := readShort(chunk, offset+1)
+	fmt.Fprintf(w, "%-16s %4d '%s'\n", op, constant, chunk.Constants[constant])
+	return offset + 3
+}
+
+func byteInstruction(w io.Writer, op OpCode, chunk *Chunk, offset int) int {
+	slot := chunk.Code[offset+1]
+	fmt.Fprintf(w, "%-16s %4d\n", op, slot)
+	return offset + 2
+}
+
+func jumpInstruction(w io.Writer, op OpCode, sign int, chunk *Chunk, offset int) int {
+	jump := int(readShort(chunk, offset+1))
+	fmt.Fprintf(w, "%-16s %4d -> %d\n", op, offset, offset+3+sign*jump)
+	return offset + 3
+}
+
+func invokeInstruction(w io.Writer, op OpCode, chunk *Chunk, offset int) int {
+	constant := readShort(chunk, offset+1)
+	argCount := chunk.Code[offset+3]
+	fmt.Fprintf(w, "%-16s (%d args) %4d '%s'\n", op, argCount, constant, chunk.Constants[constant])
+	return offset + 4
+}
+
+func closureInstruction(w io.Writer, chunk *Chunk, offset int) int {
+	constant := readShort(chunk, offset+1)
+	function := chunk.Constants[constant].Obj.(*Function)
+	fmt.Fprintf(w, "%-16s %4d %s\n", OP_CLOSURE, constant, function)
+
+	offset += 3
+	for i := 0; i < function.UpvalueCount; i++ {
+		kind := "upvalue"
+		if chunk.Code[offset] == 1 {
+			kind = "local"
+		}
+		fmt.Fprintf(w, "%04d    |                     %s %d\n", offset, kind, chunk.Code[offset+1])
+		offset += 2
+	}
+	return offset
+}
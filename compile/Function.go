@@ -0,0 +1,18 @@
+package compile
+
+import "fmt"
+
+// A compiled function body. The VM wraps it in a closure before calling it
+type Function struct {
+	Name         string
+	Arity        int
+	UpvalueCount int
+	Chunk        *Chunk
+}
+
+func (f *Function) String() string {
+	if f.Name == "" {
+		return "<script>"
+	}
+	return fmt.Sprintf("<fn %s>", f.Name)
+}
@@ -0,0 +1,247 @@
+package compile
+
+import (
+	"bytes"
+	glox_error "dsoechting/glox/error"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+)
+
+// Layout of a .gloxc file, all integers big endian:
+//
+//	magic    6 bytes "GLOXC\x00"
+//	version  u16
+//	length   u32, size of the payload
+//	checksum u32, CRC-32 (IEEE) of the payload
+//	payload  the script function, encoded by writeFunction
+const Magic = "GLOXC\x00"
+
+// Bump whenever the instruction set or payload layout changes
+const FormatVersion uint16 = 3
+
+const headerSize = len(Magic) + 2 + 4 + 4
+
+// Tags for entries in the constant pool
+const (
+	constantNumber byte = iota
+	constantString
+	constantFunction
+)
+
+var ErrBadMagic = errors.New("not a compiled glox file")
+var ErrChecksum = errors.New("compiled glox file is corrupt: checksum mismatch")
+
+// Reports whether data starts with the .gloxc magic header
+func IsCompiled(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(Magic))
+}
+
+func Encode(w io.Writer, function *Function) error {
+	var payload bytes.Buffer
+	writeErr := writeFunction(&payload, function)
+	if writeErr != nil {
+		return writeErr
+	}
+
+	header := make([]byte, 0, headerSize)
+	header = append(header, Magic...)
+	header = binary.BigEndian.AppendUint16(header, FormatVersion)
+	header = binary.BigEndian.AppendUint32(header, uint32(payload.Len()))
+	header = binary.BigEndian.AppendUint32(header, crc32.ChecksumIEEE(payload.Bytes()))
+
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	_, err := w.Write(payload.Bytes())
+	return err
+}
+
+func Decode(data []byte) (*Function, error) {
+	if len(data) < headerSize || !IsCompiled(data) {
+		return nil, ErrBadMagic
+	}
+	header := data[len(Magic):headerSize]
+	version := binary.BigEndian.Uint16(header[0:2])
+	if version != FormatVersion {
+		return nil, fmt.Errorf("unsupported compiled glox version %d, expected %d", version, FormatVersion)
+	}
+	length := binary.BigEndian.Uint32(header[2:6])
+	checksum := binary.BigEndian.Uint32(header[6:10])
+
+	payload := data[headerSize:]
+	if uint32(len(payload)) != length {
+		return nil, fmt.Errorf("compiled glox file is truncated: expected %d bytes of code, found %d", length, len(payload))
+	}
+	if crc32.ChecksumIEEE(payload) != checksum {
+		return nil, ErrChecksum
+	}
+
+	function, readErr := readFunction(bytes.NewReader(payload))
+	if readErr != nil {
+		return nil, fmt.Errorf("compiled glox file is malformed: %w", readErr)
+	}
+	// A matching checksum only means the file wasn't damaged, not that it came from the compiler
+	if verifyErr := verify(function); verifyErr != nil {
+		return nil, fmt.Errorf("compiled glox file is malformed: %w", verifyErr)
+	}
+	return function, nil
+}
+
+func writeFunction(b *bytes.Buffer, function *Function) error {
+	writeString(b, function.Name)
+	writeUvarint(b, uint64(function.Arity))
+	writeUvarint(b, uint64(function.UpvalueCount))
+
+	chunk := function.Chunk
+	writeUvarint(b, uint64(len(chunk.Code)))
+	b.Write(chunk.Code)
+
+	writeUvarint(b, uint64(len(chunk.Lines)))
+	for _, lineStart := range chunk.Lines {
+		writeUvarint(b, uint64(lineStart.Offset))
+		writeUvarint(b, uint64(lineStart.Line))
+		writeUvarint(b, uint64(lineStart.Span.Column))
+		writeUvarint(b, uint64(lineStart.Span.Start))
+		writeUvarint(b, uint64(lineStart.Span.End))
+	}
+
+	writeUvarint(b, uint64(len(chunk.Constants)))
+	for _, constant := range chunk.Constants {
+		switch {
+		case constant.IsNumber():
+			b.WriteByte(constantNumber)
+			b.Write(binary.BigEndian.AppendUint64(nil, math.Float64bits(constant.Number)))
+		case constant.IsString():
+			b.WriteByte(constantString)
+			writeString(b, constant.Obj.(string))
+		default:
+			nested, isFunction := constant.Obj.(*Function)
+			if !isFunction {
+				return fmt.Errorf("can't serialize constant %s", constant)
+			}
+			b.WriteByte(constantFunction)
+			if err := writeFunction(b, nested); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func readFunction(r *bytes.Reader) (*Function, error) {
+	name, err := readString(r)
+	if err != nil {
+		return nil, err
+	}
+	arity, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+	upvalueCount, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+
+	chunk := CreateChunk()
+	chunk.Code, err = readBytes(r)
+	if err != nil {
+		return nil, err
+	}
+
+	lineCount, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+	for i := uint64(0); i < lineCount; i++ {
+		offset, err := binary.ReadUvarint(r)
+		if err != nil {
+			return nil, err
+		}
+		line, err := binary.ReadUvarint(r)
+		if err != nil {
+			return nil, err
+		}
+		var span [3]uint64
+		for j := range span {
+			if span[j], err = binary.ReadUvarint(r); err != nil {
+				return nil, err
+			}
+		}
+		chunk.Lines = append(chunk.Lines, LineStart{
+			Offset: int(offset),
+			Line:   int(line),
+			Span:   glox_error.Span{Column: int(span[0]), Start: int(span[1]), End: int(span[2])},
+		})
+	}
+
+	constantCount, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+	for i := uint64(0); i < constantCount; i++ {
+		tag, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		switch tag {
+		case constantNumber:
+			var bits [8]byte
+			if _, err := io.ReadFull(r, bits[:]); err != nil {
+				return nil, err
+			}
+			chunk.AddConstant(NumberValue(math.Float64frombits(binary.BigEndian.Uint64(bits[:]))))
+		case constantString:
+			value, err := readString(r)
+			if err != nil {
+				return nil, err
+			}
+			chunk.AddConstant(ObjValue(value))
+		case constantFunction:
+			nested, err := readFunction(r)
+			if err != nil {
+				return nil, err
+			}
+			chunk.AddConstant(ObjValue(nested))
+		default:
+			return nil, fmt.Errorf("unknown constant tag %d", tag)
+		}
+	}
+
+	return &Function{
+		Name:         name,
+		Arity:        int(arity),
+		UpvalueCount: int(upvalueCount),
+		Chunk:        chunk,
+	}, nil
+}
+
+func writeUvarint(b *bytes.Buffer, value uint64) {
+	b.Write(binary.AppendUvarint(nil, value))
+}
+
+func writeString(b *bytes.Buffer, value string) {
+	writeUvarint(b, uint64(len(value)))
+	b.WriteString(value)
+}
+
+func readBytes(r *bytes.Reader) ([]byte, error) {
+	length, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+	if length > uint64(r.Len()) {
+		return nil, fmt.Errorf("length %d runs past the end of the file", length)
+	}
+	value := make([]byte, length)
+	_, err = io.ReadFull(r, value)
+	return value, err
+}
+
+func readString(r *bytes.Reader) (string, error) {
+	value, err := readBytes(r)
+	return string(value), err
+}
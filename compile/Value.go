@@ -0,0 +1,89 @@
+package compile
+
+import (
+	"fmt"
+	"strconv"
+)
+
+type ValueType byte
+
+const (
+	VAL_NIL ValueType = iota
+	VAL_BOOL
+	VAL_NUMBER
+	VAL_OBJ
+)
+
+// Values are unboxed for nil, booleans, and numbers. Strings and every heap
+// object (functions, closures, classes, instances) live in Obj
+type Value struct {
+	Type   ValueType
+	Bool   bool
+	Number float64
+	Obj    any
+}
+
+func NilValue() Value {
+	return Value{Type: VAL_NIL}
+}
+
+func BoolValue(b bool) Value {
+	return Value{Type: VAL_BOOL, Bool: b}
+}
+
+func NumberValue(n float64) Value {
+	return Value{Type: VAL_NUMBER, Number: n}
+}
+
+func ObjValue(obj any) Value {
+	return Value{Type: VAL_OBJ, Obj: obj}
+}
+
+func (v Value) IsNil() bool {
+	return v.Type == VAL_NIL
+}
+
+func (v Value) IsNumber() bool {
+	return v.Type == VAL_NUMBER
+}
+
+func (v Value) IsString() bool {
+	if v.Type != VAL_OBJ {
+		return false
+	}
+	_, isString := v.Obj.(string)
+	return isString
+}
+
+// nil and false are falsey, everything else is truthy
+func (v Value) IsFalsey() bool {
+	return v.Type == VAL_NIL || (v.Type == VAL_BOOL && !v.Bool)
+}
+
+func (v Value) Equals(other Value) bool {
+	if v.Type != other.Type {
+		return false
+	}
+	switch v.Type {
+	case VAL_NIL:
+		return true
+	case VAL_BOOL:
+		return v.Bool == other.Bool
+	case VAL_NUMBER:
+		return v.Number == other.Number
+	}
+	// Strings compare by content, other objects by identity
+	return v.Obj == other.Obj
+}
+
+func (v Value) String() string {
+	switch v.Type {
+	case VAL_NIL:
+		return "nil"
+	case VAL_BOOL:
+		return strconv.FormatBool(v.Bool)
+	case VAL_NUMBER:
+		return strconv.FormatFloat(v.Number, 'f', -1, 64)
+	}
+	return fmt.Sprintf("%v", v.Obj)
+}
@@ -0,0 +1,187 @@
+package compile
+
+import (
+	"fmt"
+)
+
+// What an instruction's operands refer to, which decides how they are checked
+type operandKind int
+
+const (
+	noOperand operandKind = iota
+	constantOperand
+	nameOperand
+	byteOperand
+	upvalueOperand
+	forwardJumpOperand
+	backwardJumpOperand
+	invokeOperand
+	closureOperand
+)
+
+// Matches the operand notes on the OpCode constants
+var operandKinds = map[OpCode]operandKind{
+	OP_CONSTANT:      constantOperand,
+	OP_GET_LOCAL:     byteOperand,
+	OP_SET_LOCAL:     byteOperand,
+	OP_GET_GLOBAL:    nameOperand,
+	OP_DEFINE_GLOBAL: nameOperand,
+	OP_SET_GLOBAL:    nameOperand,
+	OP_GET_UPVALUE:   upvalueOperand,
+	OP_SET_UPVALUE:   upvalueOperand,
+	OP_GET_PROPERTY:  nameOperand,
+	OP_SET_PROPERTY:  nameOperand,
+	OP_GET_SUPER:     nameOperand,
+	OP_JUMP:          forwardJumpOperand,
+	OP_JUMP_IF_FALSE: forwardJumpOperand,
+	OP_LOOP:          backwardJumpOperand,
+	OP_CALL:          byteOperand,
+	OP_INVOKE:        invokeOperand,
+	OP_SUPER_INVOKE:  invokeOperand,
+	OP_CLOSURE:       closureOperand,
+	OP_CLASS:         nameOperand,
+	OP_METHOD:        nameOperand,
+}
+
+// Checks decoded bytecode well enough that the VM can run it without reading
+// out of bounds: known instructions with whole operands, constants of the
+// right kind, upvalues that exist, jumps onto instructions, and a final return
+func verify(function *Function) error {
+	chunk := function.Chunk
+	code := chunk.Code
+	// Jumps are checked once every instruction's start is known
+	isInstruction := make([]bool, len(code)+1)
+	jumps := map[int]int{}
+	last := OpCode(0)
+
+	for offset := 0; offset < len(code); {
+		op := OpCode(code[offset])
+		if op > OP_METHOD {
+			return fmt.Errorf("unknown instruction %d at offset %d in %s", op, offset, describe(function))
+		}
+		isInstruction[offset] = true
+		last = op
+		start := offset
+		offset++
+
+		readShort := func() (int, error) {
+			if offset+2 > len(code) {
+				return 0, fmt.Errorf("instruction at offset %d in %s runs past the end of the code", start, describe(function))
+			}
+			value := int(code[offset])<<8 | int(code[offset+1])
+			offset += 2
+			return value, nil
+		}
+		readByte := func() (int, error) {
+			if offset+1 > len(code) {
+				return 0, fmt.Errorf("instruction at offset %d in %s runs past the end of the code", start, describe(function))
+			}
+			offset++
+			return int(code[offset-1]), nil
+		}
+		constant := func() (Value, error) {
+			index, err := readShort()
+			if err != nil {
+				return Value{}, err
+			}
+			if index >= len(chunk.Constants) {
+				return Value{}, fmt.Errorf("constant %d at offset %d in %s is past the end of the constant pool", index, start, describe(function))
+			}
+			return chunk.Constants[index], nil
+		}
+		name := func() error {
+			value, err := constant()
+			if err == nil && !value.IsString() {
+				err = fmt.Errorf("name at offset %d in %s is not a string constant", start, describe(function))
+			}
+			return err
+		}
+
+		var err error
+		switch operandKinds[op] {
+		case constantOperand:
+			_, err = constant()
+		case nameOperand:
+			err = name()
+		case byteOperand:
+			_, err = readByte()
+		case upvalueOperand:
+			var index int
+			if index, err = readByte(); err == nil && index >= function.UpvalueCount {
+				err = fmt.Errorf("upvalue %d at offset %d in %s doesn't exist", index, start, describe(function))
+			}
+		case forwardJumpOperand:
+			var distance int
+			if distance, err = readShort(); err == nil {
+				jumps[start] = offset + distance
+			}
+		case backwardJumpOperand:
+			var distance int
+			if distance, err = readShort(); err == nil {
+				jumps[start] = offset - distance
+			}
+		case invokeOperand:
+			if err = name(); err == nil {
+				_, err = readByte()
+			}
+		case closureOperand:
+			err = verifyClosure(function, start, &offset, constant)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(code) == 0 || last != OP_RETURN {
+		return fmt.Errorf("%s doesn't end with a return", describe(function))
+	}
+	for start, target := range jumps {
+		if target < 0 || target >= len(code) || !isInstruction[target] {
+			return fmt.Errorf("jump at offset %d in %s doesn't land on an instruction", start, describe(function))
+		}
+	}
+	for index, lineStart := range chunk.Lines {
+		if lineStart.Offset >= len(code) || index > 0 && lineStart.Offset <= chunk.Lines[index-1].Offset {
+			return fmt.Errorf("line table of %s is out of order", describe(function))
+		}
+	}
+	for _, value := range chunk.Constants {
+		if nested, isFunction := value.Obj.(*Function); isFunction {
+			if err := verify(nested); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// A closure names a function constant, then has an (isLocal, index) pair for each of its upvalues
+func verifyClosure(function *Function, start int, offset *int, constant func() (Value, error)) error {
+	value, err := constant()
+	if err != nil {
+		return err
+	}
+	nested, isFunction := value.Obj.(*Function)
+	if !isFunction {
+		return fmt.Errorf("closure at offset %d in %s is not a function constant", start, describe(function))
+	}
+	code := function.Chunk.Code
+	for range nested.UpvalueCount {
+		if *offset+2 > len(code) {
+			return fmt.Errorf("instruction at offset %d in %s runs past the end of the code", start, describe(function))
+		}
+		isLocal, index := code[*offset], int(code[*offset+1])
+		*offset += 2
+		if isLocal > 1 || isLocal == 0 && index >= function.UpvalueCount {
+			return fmt.Errorf("closure at offset %d in %s captures an upvalue that doesn't exist", start, describe(function))
+		}
+	}
+	return nil
+}
+
+func describe(function *Function) string {
+	if function.Name == "" {
+		return "<script>"
+	}
+	return function.Name
+}
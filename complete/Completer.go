@@ -0,0 +1,163 @@
+package complete
+
+import (
+	"dsoechting/glox/environment"
+	"dsoechting/glox/scanner"
+	"sort"
+	"strings"
+)
+
+// Where completion finds names besides keywords
+type Scope interface {
+	// Every variable visible where the completion happens
+	Names() []string
+	// The value a variable holds, so the members after a '.' can be listed
+	Lookup(name string) (any, bool)
+}
+
+// Values that have members to complete after a '.', like instances
+type HasMembers interface {
+	Members() []string
+}
+
+// Keywords that declare a new name, which nothing existing could complete
+var declarations = map[string]bool{"var": true, "fun": true, "class": true}
+
+// Completes the word that ends at cursor, a rune index into line. Returns where
+// the word starts and every sorted candidate for it, or no candidates when the
+// cursor is inside a string or comment, or names something new
+func Complete(line string, cursor int, scope Scope) (int, []string) {
+	runes := []rune(line)
+	cursor = min(max(cursor, 0), len(runes))
+	if isInStringOrComment(runes[:cursor]) {
+		return cursor, nil
+	}
+	start := cursor
+	for start > 0 && isIdentifier(runes[start-1]) {
+		start--
+	}
+	prefix := string(runes[start:cursor])
+	if prefix != "" && isDigit(runes[start]) {
+		return start, nil
+	}
+
+	// Members of whatever the variable before the '.' holds
+	if before := skipSpaces(runes, start); before > 0 && runes[before-1] == '.' {
+		receiverEnd := skipSpaces(runes, before-1)
+		receiverStart := receiverEnd
+		for receiverStart > 0 && isIdentifier(runes[receiverStart-1]) {
+			receiverStart--
+		}
+		if receiverStart == receiverEnd || scope == nil {
+			return start, nil
+		}
+		value, isPresent := scope.Lookup(string(runes[receiverStart:receiverEnd]))
+		withMembers, hasMembers := value.(HasMembers)
+		if !isPresent || !hasMembers {
+			return start, nil
+		}
+		return start, matching(prefix, withMembers.Members())
+	}
+
+	if declarations[previousWord(runes, start)] {
+		return start, nil
+	}
+	names := []string{}
+	for keyword := range scanner.Keywords {
+		names = append(names, keyword)
+	}
+	if scope != nil {
+		names = append(names, scope.Names()...)
+	}
+	return start, matching(prefix, names)
+}
+
+// The longest prefix every candidate shares
+func CommonPrefix(candidates []string) string {
+	if len(candidates) == 0 {
+		return ""
+	}
+	prefix := candidates[0]
+	for _, candidate := range candidates[1:] {
+		for !strings.HasPrefix(candidate, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+	return prefix
+}
+
+// The names starting with prefix, sorted and without repeats
+func matching(prefix string, names []string) []string {
+	seen := map[string]bool{}
+	candidates := []string{}
+	for _, name := range names {
+		if strings.HasPrefix(name, prefix) && !seen[name] {
+			seen[name] = true
+			candidates = append(candidates, name)
+		}
+	}
+	sort.Strings(candidates)
+	return candidates
+}
+
+// Glox strings have no escapes, so an odd number of quotes means the text ends inside one
+func isInStringOrComment(runes []rune) bool {
+	isInString := false
+	for index, r := range runes {
+		switch {
+		case r == '"':
+			isInString = !isInString
+		case !isInString && r == '/' && index+1 < len(runes) && runes[index+1] == '/':
+			return true
+		}
+	}
+	return isInString
+}
+
+func previousWord(runes []rune, end int) string {
+	end = skipSpaces(runes, end)
+	start := end
+	for start > 0 && isIdentifier(runes[start-1]) {
+		start--
+	}
+	return string(runes[start:end])
+}
+
+// Steps back over spaces from end, returning the index just past the last non space
+func skipSpaces(runes []rune, end int) int {
+	for end > 0 && (runes[end-1] == ' ' || runes[end-1] == '\t') {
+		end--
+	}
+	return end
+}
+
+func isIdentifier(r rune) bool {
+	return r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || isDigit(r)
+}
+
+func isDigit(r rune) bool {
+	return r >= '0' && r <= '9'
+}
+
+type environmentScope struct {
+	environment *environment.Environment
+}
+
+// The variables in environment and the scopes around it
+func EnvironmentScope(env *environment.Environment) Scope {
+	return environmentScope{environment: env}
+}
+
+func (s environmentScope) Names() []string {
+	names := []string{}
+	for scope := s.environment; scope != nil; scope = scope.Enclosing() {
+		for name := range scope.Values() {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+func (s environmentScope) Lookup(name string) (any, bool) {
+	return s.environment.Lookup(name)
+}
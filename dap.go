@@ -0,0 +1,21 @@
+package main
+
+import (
+	"dsoechting/glox/dap"
+	"fmt"
+)
+
+// glox dap
+// Runs a debug adapter on stdin and stdout until the editor disconnects
+func (g *Glox) serveDebugAdapter(args []string) int {
+	if len(args) != 0 {
+		fmt.Fprintln(g.options.Stderr, "Usage glox dap")
+		return 64
+	}
+	serveErr := dap.Create(g.options.Stdin, g.options.Stdout).Serve()
+	if serveErr != nil {
+		fmt.Fprintln(g.options.Stderr, serveErr)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,686 @@
+package dap
+
+import (
+	"bufio"
+	"dsoechting/glox/ast"
+	"dsoechting/glox/debug"
+	glox_error "dsoechting/glox/error"
+	"dsoechting/glox/interpret"
+	"dsoechting/glox/parse"
+	"dsoechting/glox/resolve"
+	"dsoechting/glox/scanner"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+type Interpreter = interpret.Interpreter
+type Environment = interpret.Environment
+type Instance = interpret.Instance
+type Stmt = ast.Stmt
+
+var ErrDisconnected = errors.New("client closed the stream without disconnecting")
+
+// Returned through the interpreter to stop a script the client terminated
+var ErrTerminated = errors.New("terminated by the debug client")
+
+// Sent to a paused script to tell it how to carry on
+type resumeCommand struct {
+	mode          debug.StepMode
+	isTerminating bool
+}
+
+// What the client can look at while the script is paused, thrown away when it resumes
+type pause struct {
+	frames []interpret.CallFrame
+	// Scopes and instances the client can expand. A variablesReference n names references[n-1]
+	references []any
+}
+
+func (p *pause) reference(value any) int {
+	p.references = append(p.references, value)
+	return len(p.references)
+}
+
+// Implements interpret.Hook
+// A debug adapter for one client. Requests are handled on the goroutine calling
+// Serve, while the script runs on its own and blocks in the hook when it pauses
+type Server struct {
+	reader *bufio.Reader
+	writer io.Writer
+	// Held while writing, since the script's goroutine sends events too
+	writeLock sync.Mutex
+	seq       int
+	// Added to our 1 based lines and columns for clients that count from 0
+	lineOffset   int
+	columnOffset int
+
+	// Held for everything below that the script's goroutine also touches
+	lock        sync.Mutex
+	stepper     *debug.Stepper
+	program     string
+	source      string
+	statements  []Stmt
+	interpreter *Interpreter
+	// Sorted lines that hold a statement, the only places a breakpoint can pause
+	statementLines []int
+	isLaunched     bool
+	isConfigured   bool
+	noDebug        bool
+	// Nil unless the script is paused
+	paused        *pause
+	isTerminating bool
+	resume        chan resumeCommand
+	// Closed once the script finishes, nil until it starts
+	finished chan struct{}
+	// Runs once the response to the current request is written
+	afterResponse func()
+}
+
+func Create(in io.Reader, out io.Writer) *Server {
+	return &Server{
+		reader:  bufio.NewReader(in),
+		writer:  out,
+		stepper: debug.CreateStepper(),
+		resume:  make(chan resumeCommand),
+	}
+}
+
+// Handles requests until the client disconnects or closes the stream.
+// Returns nil only after a disconnect request
+func (s *Server) Serve() error {
+	for {
+		request, readErr := s.read()
+		if readErr != nil {
+			s.stop()
+			if readErr == io.EOF {
+				return ErrDisconnected
+			}
+			return readErr
+		}
+
+		body, handleErr := s.handle(request)
+		if writeErr := s.respond(request, body, handleErr); writeErr != nil {
+			return writeErr
+		}
+		if s.afterResponse != nil {
+			after := s.afterResponse
+			s.afterResponse = nil
+			after()
+		}
+		if request.Command == "disconnect" {
+			return nil
+		}
+	}
+}
+
+func (s *Server) handle(request *Request) (any, error) {
+	switch request.Command {
+	case "initialize":
+		var arguments InitializeRequestArguments
+		if err := decodeArguments(request, &arguments); err != nil {
+			return nil, err
+		}
+		if arguments.LinesStartAt1 != nil && !*arguments.LinesStartAt1 {
+			s.lineOffset = -1
+		}
+		if arguments.ColumnsStartAt1 != nil && !*arguments.ColumnsStartAt1 {
+			s.columnOffset = -1
+		}
+		// Ready for breakpoints as soon as the client knows what we support
+		s.afterResponse = func() { s.sendEvent("initialized", nil) }
+		return Capabilities{
+			SupportsConfigurationDoneRequest: true,
+			SupportsEvaluateForHovers:        true,
+			SupportsTerminateRequest:         true,
+		}, nil
+	case "launch":
+		var arguments LaunchRequestArguments
+		if err := decodeArguments(request, &arguments); err != nil {
+			return nil, err
+		}
+		return nil, s.launch(arguments)
+	case "setBreakpoints":
+		var arguments SetBreakpointsArguments
+		if err := decodeArguments(request, &arguments); err != nil {
+			return nil, err
+		}
+		return s.setBreakpoints(arguments), nil
+	case "configurationDone":
+		s.isConfigured = true
+		if s.isLaunched {
+			s.afterResponse = s.start
+		}
+		return nil, nil
+	case "threads":
+		return ThreadsResponseBody{Threads: []Thread{{ID: THREAD_ID, Name: "main"}}}, nil
+	case "stackTrace":
+		var arguments StackTraceArguments
+		if err := decodeArguments(request, &arguments); err != nil {
+			return nil, err
+		}
+		return s.stackTrace(arguments)
+	case "scopes":
+		var arguments ScopesArguments
+		if err := decodeArguments(request, &arguments); err != nil {
+			return nil, err
+		}
+		return s.scopes(arguments)
+	case "variables":
+		var arguments VariablesArguments
+		if err := decodeArguments(request, &arguments); err != nil {
+			return nil, err
+		}
+		return s.variables(arguments)
+	case "evaluate":
+		var arguments EvaluateArguments
+		if err := decodeArguments(request, &arguments); err != nil {
+			return nil, err
+		}
+		return s.evaluate(arguments)
+	case "continue":
+		return ContinueResponseBody{AllThreadsContinued: true}, s.resumeWith(resumeCommand{mode: debug.CONTINUE})
+	case "next":
+		return nil, s.resumeWith(resumeCommand{mode: debug.STEP_OVER})
+	case "stepIn":
+		return nil, s.resumeWith(resumeCommand{mode: debug.STEP_INTO})
+	case "stepOut":
+		return nil, s.resumeWith(resumeCommand{mode: debug.STEP_OUT})
+	case "terminate":
+		s.terminate()
+		return nil, nil
+	case "disconnect":
+		s.stop()
+		return nil, nil
+	}
+	return nil, fmt.Errorf("Unsupported request '%s'.", request.Command)
+}
+
+// Loads, parses and resolves the program, so mistakes show up before anything runs
+func (s *Server) launch(arguments LaunchRequestArguments) error {
+	if s.isLaunched {
+		return errors.New("A program is already launched.")
+	}
+	data, readErr := os.ReadFile(arguments.Program)
+	if readErr != nil {
+		return fmt.Errorf("Can't read '%s': %w", arguments.Program, readErr)
+	}
+	source := string(data)
+	tokens, scanErr := scanner.Create(source).ScanTokens()
+	if scanErr != nil {
+		return errors.New(glox_error.Render(source, scanErr))
+	}
+	parser := parse.Create(tokens)
+	statements, parseErr := parser.Parse()
+	if parseErr != nil {
+		return errors.New(glox_error.Render(source, parseErr))
+	}
+	interpreter := interpret.CreateWithOptions(interpret.Options{
+		Stdout: outputWriter{server: s, category: "stdout"},
+		Stderr: outputWriter{server: s, category: "stderr"},
+		// Stdin carries the protocol, so readLine sees an empty stream
+		Stdin: strings.NewReader(""),
+	})
+	if resolveErr := resolve.Create(&interpreter).Resolve(statements); resolveErr != nil {
+		return errors.New(glox_error.Render(source, resolveErr))
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.program, s.source, s.statements = arguments.Program, source, statements
+	s.interpreter = &interpreter
+	s.statementLines = statementLines(statements)
+	s.noDebug = arguments.NoDebug
+	if arguments.StopOnEntry {
+		s.stepper.StopOnEntry()
+	}
+	s.isLaunched = true
+	if s.isConfigured {
+		s.afterResponse = s.start
+	}
+	return nil
+}
+
+func (s *Server) start() {
+	s.lock.Lock()
+	s.finished = make(chan struct{})
+	// Installed even without debugging, so the script can still be terminated
+	s.interpreter.SetHook(s)
+	s.lock.Unlock()
+	go s.run()
+}
+
+// Runs on the script's goroutine
+func (s *Server) run() {
+	defer close(s.finished)
+	_, runErr := s.interpreter.Interpret(s.statements)
+	exitCode := 0
+	if runErr != nil && !errors.Is(runErr, ErrTerminated) {
+		var runtimeErr *glox_error.RuntimeError
+		if errors.As(runErr, &runtimeErr) {
+			runtimeErr.SetFile(s.program)
+		}
+		s.sendEvent("output", OutputEventBody{Category: "stderr", Output: glox_error.Render(s.source, runErr) + "\n"})
+		exitCode = 70
+	}
+	s.sendEvent("exited", ExitedEventBody{ExitCode: exitCode})
+	s.sendEvent("terminated", nil)
+}
+
+// Called by the interpreter, on the script's goroutine, before each statement
+func (s *Server) BeforeStatement(interpreter *Interpreter, stmt Stmt) error {
+	s.lock.Lock()
+	// Checked before anything else, since a loop like while (true) {} only ever runs blocks
+	if s.isTerminating {
+		s.lock.Unlock()
+		return ErrTerminated
+	}
+	if _, isBlock := stmt.(*ast.BlockStmt); isBlock || s.noDebug {
+		s.lock.Unlock()
+		return nil
+	}
+	depth := interpreter.CallDepth()
+	reason, shouldStop := s.stepper.ShouldStop(stmt, depth)
+	if shouldStop {
+		s.paused = &pause{frames: interpreter.CallStack()}
+	}
+	s.lock.Unlock()
+	if !shouldStop {
+		return nil
+	}
+
+	s.sendEvent("stopped", StoppedEventBody{Reason: string(reason), ThreadID: THREAD_ID, AllThreadsStopped: true})
+	command := <-s.resume
+	if command.isTerminating {
+		return ErrTerminated
+	}
+	s.lock.Lock()
+	s.stepper.Resume(command.mode, depth)
+	s.lock.Unlock()
+	return nil
+}
+
+// Lets a paused script carry on, once the response has gone out so it comes before the next stop
+func (s *Server) resumeWith(command resumeCommand) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.paused == nil {
+		return errors.New("The program is not paused.")
+	}
+	s.paused = nil
+	s.afterResponse = func() { s.resume <- command }
+	return nil
+}
+
+// Stops the script at its next statement
+func (s *Server) terminate() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.isTerminating = true
+	if s.paused != nil {
+		s.paused = nil
+		s.afterResponse = func() { s.resume <- resumeCommand{isTerminating: true} }
+	} else if s.finished == nil {
+		s.afterResponse = func() { s.sendEvent("terminated", nil) }
+	}
+}
+
+// Stops the script and waits for it to finish
+func (s *Server) stop() {
+	s.lock.Lock()
+	s.isTerminating = true
+	isPaused := s.paused != nil
+	s.paused = nil
+	finished := s.finished
+	s.lock.Unlock()
+
+	if isPaused {
+		s.resume <- resumeCommand{isTerminating: true}
+	}
+	if finished != nil {
+		<-finished
+	}
+}
+
+// Replaces the breakpoints, moving each one down to the next line with a statement
+func (s *Server) setBreakpoints(arguments SetBreakpointsArguments) SetBreakpointsResponseBody {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	breakpoints := []Breakpoint{}
+	if !s.isProgram(arguments.Source.Path) {
+		for _, requested := range arguments.Breakpoints {
+			breakpoints = append(breakpoints, Breakpoint{Line: requested.Line, Message: "Not the launched program."})
+		}
+		return SetBreakpointsResponseBody{Breakpoints: breakpoints}
+	}
+
+	s.stepper.ClearBreakpoints()
+	for _, requested := range arguments.Breakpoints {
+		line := requested.Line - s.lineOffset
+		if s.isLaunched {
+			index := sort.SearchInts(s.statementLines, line)
+			if index == len(s.statementLines) {
+				breakpoints = append(breakpoints, Breakpoint{Line: requested.Line, Message: "No statement on or after this line."})
+				continue
+			}
+			line = s.statementLines[index]
+		}
+		s.stepper.SetBreakpoint(line)
+		breakpoints = append(breakpoints, Breakpoint{Verified: true, Line: line + s.lineOffset, Source: s.sourceReference()})
+	}
+	return SetBreakpointsResponseBody{Breakpoints: breakpoints}
+}
+
+// Until a program is launched any path could be it
+func (s *Server) isProgram(path string) bool {
+	if s.program == "" || path == "" {
+		return true
+	}
+	absolutePath, pathErr := filepath.Abs(path)
+	program, programErr := filepath.Abs(s.program)
+	return pathErr == nil && programErr == nil && absolutePath == program
+}
+
+func (s *Server) sourceReference() *Source {
+	if s.program == "" {
+		return nil
+	}
+	return &Source{Name: filepath.Base(s.program), Path: s.program}
+}
+
+func (s *Server) stackTrace(arguments StackTraceArguments) (any, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.paused == nil {
+		return nil, errors.New("The program is not paused.")
+	}
+	frames := s.paused.frames
+	start := min(max(arguments.StartFrame, 0), len(frames))
+	end := len(frames)
+	if arguments.Levels > 0 {
+		end = min(end, start+arguments.Levels)
+	}
+	stackFrames := []StackFrame{}
+	for index := start; index < end; index++ {
+		stackFrames = append(stackFrames, StackFrame{
+			// Frame ids count from 1 so that 0 can mean none
+			ID:     index + 1,
+			Name:   frames[index].Name,
+			Source: s.sourceReference(),
+			Line:   frames[index].Line + s.lineOffset,
+			Column: 1 + s.columnOffset,
+		})
+	}
+	return StackTraceResponseBody{StackFrames: stackFrames, TotalFrames: len(frames)}, nil
+}
+
+// One scope per environment in the frame's chain, innermost first
+func (s *Server) scopes(arguments ScopesArguments) (any, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	frame, frameErr := s.frame(arguments.FrameID)
+	if frameErr != nil {
+		return nil, frameErr
+	}
+	scopes := []Scope{}
+	for environment := frame.Environment; environment != nil; environment = environment.Enclosing() {
+		name := "Locals"
+		if environment.Enclosing() == nil {
+			name = "Globals"
+		} else if len(scopes) > 0 {
+			name = fmt.Sprintf("Enclosing %d", len(scopes))
+		}
+		scopes = append(scopes, Scope{Name: name, VariablesReference: s.paused.reference(environment)})
+	}
+	return ScopesResponseBody{Scopes: scopes}, nil
+}
+
+func (s *Server) variables(arguments VariablesArguments) (any, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.paused == nil {
+		return nil, errors.New("The program is not paused.")
+	}
+	index := arguments.VariablesReference - 1
+	if index < 0 || index >= len(s.paused.references) {
+		return nil, fmt.Errorf("Unknown variables reference %d.", arguments.VariablesReference)
+	}
+
+	values := map[string]any{}
+	switch container := s.paused.references[index].(type) {
+	case *Environment:
+		values = container.Values()
+	case *Instance:
+		values = container.Fields()
+	}
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	variables := []Variable{}
+	for _, name := range names {
+		value := values[name]
+		variables = append(variables, Variable{
+			Name:               name,
+			Value:              debug.Format(value),
+			Type:               typeName(value),
+			VariablesReference: s.expandable(value),
+		})
+	}
+	return VariablesResponseBody{Variables: variables}, nil
+}
+
+// Parses a watch or hover expression and evaluates it in the chosen frame's scope
+func (s *Server) evaluate(arguments EvaluateArguments) (any, error) {
+	s.lock.Lock()
+	frameID := arguments.FrameID
+	if frameID == 0 {
+		frameID = 1
+	}
+	frame, frameErr := s.frame(frameID)
+	s.lock.Unlock()
+	if frameErr != nil {
+		return nil, frameErr
+	}
+
+	tokens, scanErr := scanner.Create(arguments.Expression).ScanTokens()
+	if scanErr != nil {
+		return nil, errors.New(message(scanErr))
+	}
+	parser := parse.Create(tokens)
+	expr, parseErr := parser.ParseExpression()
+	if parseErr != nil {
+		return nil, errors.New(message(parseErr))
+	}
+	// The script's goroutine is blocked until we resume it, so the interpreter is ours for now
+	value, evalErr := s.interpreter.EvaluateIn(expr, frame.Environment)
+	if evalErr != nil {
+		return nil, errors.New(message(evalErr))
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return EvaluateResponseBody{
+		Result:             debug.Format(value),
+		Type:               typeName(value),
+		VariablesReference: s.expandable(value),
+	}, nil
+}
+
+func (s *Server) frame(id int) (interpret.CallFrame, error) {
+	if s.paused == nil {
+		return interpret.CallFrame{}, errors.New("The program is not paused.")
+	}
+	if id < 1 || id > len(s.paused.frames) {
+		return interpret.CallFrame{}, fmt.Errorf("Unknown frame %d.", id)
+	}
+	return s.paused.frames[id-1], nil
+}
+
+// Instances can be opened up to show their fields, other values can't
+func (s *Server) expandable(value any) int {
+	if instance, isInstance := value.(*Instance); isInstance && s.paused != nil {
+		return s.paused.reference(instance)
+	}
+	return 0
+}
+
+func typeName(value any) string {
+	switch value.(type) {
+	case nil:
+		return "nil"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case *interpret.Class:
+		return "class"
+	case *Instance:
+		return "instance"
+	case interpret.Callable:
+		return "function"
+	}
+	return ""
+}
+
+// The messages from err, without the line prefix a client already knows
+func message(err error) string {
+	messages := []string{}
+	for _, single := range glox_error.Flatten(err) {
+		if reportable, isReportable := single.(glox_error.Reportable); isReportable {
+			messages = append(messages, reportable.Details().Message)
+		} else {
+			messages = append(messages, single.Error())
+		}
+	}
+	return strings.Join(messages, "\n")
+}
+
+// Every line that holds a statement the hook will see, sorted
+func statementLines(statements []Stmt) []int {
+	seen := map[int]bool{}
+	var walk func(statements []Stmt)
+	walk = func(statements []Stmt) {
+		for _, stmt := range statements {
+			switch stmt := stmt.(type) {
+			case nil:
+				continue
+			case *ast.BlockStmt:
+				walk(stmt.Statements)
+				continue
+			case *ast.ClassStmt:
+				for _, method := range stmt.Methods {
+					walk(method.Body)
+				}
+			case *ast.FunctionStmt:
+				walk(stmt.Body)
+			case *ast.IfStmt:
+				walk([]Stmt{stmt.ThenBranch, stmt.ElseBranch})
+			case *ast.WhileStmt:
+				walk([]Stmt{stmt.Body})
+			}
+			seen[interpret.StatementLine(stmt)] = true
+		}
+	}
+	walk(statements)
+
+	lines := make([]int, 0, len(seen))
+	for line := range seen {
+		lines = append(lines, line)
+	}
+	sort.Ints(lines)
+	return lines
+}
+
+// Forwards what the script prints to the client as output events
+type outputWriter struct {
+	server   *Server
+	category string
+}
+
+func (w outputWriter) Write(output []byte) (int, error) {
+	if err := w.server.sendEvent("output", OutputEventBody{Category: w.category, Output: string(output)}); err != nil {
+		return 0, err
+	}
+	return len(output), nil
+}
+
+func decodeArguments(request *Request, arguments any) error {
+	if len(request.Arguments) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(request.Arguments, arguments); err != nil {
+		return fmt.Errorf("Bad arguments for '%s': %w", request.Command, err)
+	}
+	return nil
+}
+
+// Reads one framed message: headers, a blank line, then Content-Length bytes of JSON
+func (s *Server) read() (*Request, error) {
+	headers, headerErr := textproto.NewReader(s.reader).ReadMIMEHeader()
+	if headerErr != nil {
+		if len(headers) == 0 && errors.Is(headerErr, io.EOF) {
+			return nil, io.EOF
+		}
+		return nil, headerErr
+	}
+	length, lengthErr := strconv.Atoi(strings.TrimSpace(headers.Get("Content-Length")))
+	if lengthErr != nil {
+		return nil, fmt.Errorf("bad Content-Length header: %w", lengthErr)
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(s.reader, body); err != nil {
+		return nil, err
+	}
+	var request Request
+	if err := json.Unmarshal(body, &request); err != nil {
+		return nil, fmt.Errorf("malformed message: %w", err)
+	}
+	return &request, nil
+}
+
+func (s *Server) respond(request *Request, body any, err error) error {
+	response := Response{Type: RESPONSE, RequestSeq: request.Seq, Success: err == nil, Command: request.Command, Body: body}
+	if err != nil {
+		response.Message = err.Error()
+		response.Body = nil
+	}
+	return s.write(func(seq int) any {
+		response.Seq = seq
+		return response
+	})
+}
+
+func (s *Server) sendEvent(event string, body any) error {
+	return s.write(func(seq int) any {
+		return Event{Seq: seq, Type: EVENT, Event: event, Body: body}
+	})
+}
+
+// Numbers and writes one message. Sequence numbers are handed out under the
+// lock so they reach the client in order
+func (s *Server) write(message func(seq int) any) error {
+	s.writeLock.Lock()
+	defer s.writeLock.Unlock()
+	s.seq++
+	body, encodeErr := json.Marshal(message(s.seq))
+	if encodeErr != nil {
+		return encodeErr
+	}
+	if _, err := fmt.Fprintf(s.writer, "Content-Length: %d\r\n\r\n", len(body)); err != nil {
+		return err
+	}
+	_, err := s.writer.Write(body)
+	return err
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"bufio"
+	"dsoechting/glox/debug"
+	"dsoechting/glox/resolve"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// glox debug script
+// Runs a script on the tree walking interpreter, pausing for commands read from stdin
+func (g *Glox) debug(args []string) int {
+	if len(args) != 1 {
+		fmt.Fprintln(g.options.Stderr, "Usage glox debug script")
+		return 64
+	}
+	data, readErr := os.ReadFile(args[0])
+	if readErr != nil {
+		fmt.Fprintln(g.options.Stderr, readErr)
+		return 66
+	}
+	g.file = args[0]
+	statements, isParsed := g.parse(string(data))
+	if !isParsed {
+		return exitCode(g.err)
+	}
+	if resolveErr := resolve.Create(&g.interpreter).Resolve(statements); resolveErr != nil {
+		g.report(resolveErr)
+		return exitCode(g.err)
+	}
+
+	// Commands and readLine share a buffer, so neither steals the other's lines
+	reader, isBuffered := g.options.Stdin.(*bufio.Reader)
+	if !isBuffered {
+		reader = bufio.NewReader(g.options.Stdin)
+	}
+	g.interpreter.SetHook(debug.Create(string(data), reader, g.options.Stdout))
+	_, evalErr := g.interpreter.Interpret(statements)
+	if errors.Is(evalErr, debug.ErrQuit) {
+		return 0
+	}
+	if evalErr != nil {
+		g.report(evalErr)
+		return exitCode(g.err)
+	}
+	return 0
+}
@@ -0,0 +1,259 @@
+package debug
+
+import (
+	"bufio"
+	"dsoechting/glox/ast"
+	"dsoechting/glox/interpret"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type Interpreter = interpret.Interpreter
+type Environment = interpret.Environment
+type Stmt = ast.Stmt
+
+// Returned through the interpreter when the user quits mid run
+var ErrQuit = errors.New("quit from the debugger")
+
+// Lines shown either side of the current one by list
+const listContext = 3
+
+// Implements interpret.Hook
+// A command line debugger. It pauses before statements on breakpoint lines or
+// while stepping, and reads commands until told to carry on
+type Debugger struct {
+	lines   []string
+	stepper *Stepper
+	// Set once the input runs out, after which the script runs freely
+	isDetached  bool
+	lastCommand string
+	input       *bufio.Reader
+	output      io.Writer
+}
+
+// The debugger pauses before the first statement, so breakpoints can be set
+func Create(source string, input *bufio.Reader, output io.Writer) *Debugger {
+	stepper := CreateStepper()
+	stepper.StopOnEntry()
+	return &Debugger{
+		lines:   strings.Split(source, "\n"),
+		stepper: stepper,
+		input:   input,
+		output:  output,
+	}
+}
+
+func (d *Debugger) SetBreakpoint(line int) {
+	d.stepper.SetBreakpoint(line)
+}
+
+func (d *Debugger) BeforeStatement(interpreter *Interpreter, stmt Stmt) error {
+	// Blocks only group statements, the debugger stops at the ones inside
+	if _, isBlock := stmt.(*ast.BlockStmt); isBlock || d.isDetached {
+		return nil
+	}
+
+	line := interpret.StatementLine(stmt)
+	depth := interpreter.CallDepth()
+	if _, shouldStop := d.stepper.ShouldStop(stmt, depth); !shouldStop {
+		return nil
+	}
+
+	frame := interpreter.CurrentFrame()
+	fmt.Fprintf(d.output, "Stopped at line %d in %s\n", line, frame.Name)
+	d.printLine(line, true)
+	return d.prompt(interpreter, depth)
+}
+
+// Reads commands until one resumes the script
+func (d *Debugger) prompt(interpreter *Interpreter, depth int) error {
+	for {
+		fmt.Fprint(d.output, "(glox) ")
+		text, readErr := d.input.ReadString('\n')
+		if readErr != nil && text == "" {
+			if readErr == io.EOF {
+				fmt.Fprintln(d.output)
+				d.isDetached = true
+				return nil
+			}
+			return readErr
+		}
+
+		text = strings.TrimSpace(text)
+		if text == "" {
+			// Like gdb, an empty line repeats the last command
+			text = d.lastCommand
+		}
+		d.lastCommand = text
+		fields := strings.Fields(text)
+		if len(fields) == 0 {
+			continue
+		}
+		command, args := fields[0], fields[1:]
+
+		switch command {
+		case "continue", "c":
+			return nil
+		case "step", "s":
+			d.stepper.Resume(STEP_INTO, depth)
+			return nil
+		case "next", "n":
+			d.stepper.Resume(STEP_OVER, depth)
+			return nil
+		case "finish", "out", "o":
+			d.stepper.Resume(STEP_OUT, depth)
+			return nil
+		case "break", "b":
+			d.breakCommand(args)
+		case "delete", "d":
+			d.deleteCommand(args)
+		case "backtrace", "bt":
+			for index, frame := range interpreter.CallStack() {
+				fmt.Fprintf(d.output, "#%d %s at line %d\n", index, frame.Name, frame.Line)
+			}
+		case "print", "p":
+			d.printCommand(interpreter, args)
+		case "list", "l":
+			current := interpreter.CurrentFrame().Line
+			for line := max(1, current-listContext); line <= min(len(d.lines), current+listContext); line++ {
+				d.printLine(line, line == current)
+			}
+		case "quit", "q":
+			return ErrQuit
+		case "help", "h":
+			fmt.Fprint(d.output, help)
+		default:
+			fmt.Fprintf(d.output, "Unknown command %q, try help\n", command)
+		}
+	}
+}
+
+const help = `break, b [line]      set a breakpoint, or list them with no line
+delete, d line       remove a breakpoint
+continue, c          run to the next breakpoint
+step, s              run to the next statement, entering calls
+next, n              run to the next statement in this function or its callers
+finish, out, o       run until the current function returns
+backtrace, bt        show the active calls
+print, p [name]      show a variable, or every scope with no name
+list, l              show the source around the current line
+quit, q              stop the script
+`
+
+func (d *Debugger) breakCommand(args []string) {
+	if len(args) == 0 {
+		lines := []int{}
+		for line := range d.stepper.Breakpoints() {
+			lines = append(lines, line)
+		}
+		sort.Ints(lines)
+		if len(lines) == 0 {
+			fmt.Fprintln(d.output, "No breakpoints")
+		}
+		for _, line := range lines {
+			fmt.Fprintf(d.output, "Breakpoint at line %d\n", line)
+		}
+		return
+	}
+	line, lineErr := d.parseLine(args[0])
+	if lineErr != nil {
+		fmt.Fprintln(d.output, lineErr)
+		return
+	}
+	d.SetBreakpoint(line)
+	fmt.Fprintf(d.output, "Breakpoint at line %d\n", line)
+}
+
+func (d *Debugger) deleteCommand(args []string) {
+	if len(args) != 1 {
+		fmt.Fprintln(d.output, "Usage: delete line")
+		return
+	}
+	line, lineErr := d.parseLine(args[0])
+	if lineErr != nil {
+		fmt.Fprintln(d.output, lineErr)
+		return
+	}
+	if !d.stepper.HasBreakpoint(line) {
+		fmt.Fprintf(d.output, "No breakpoint at line %d\n", line)
+		return
+	}
+	d.stepper.ClearBreakpoint(line)
+	fmt.Fprintf(d.output, "Deleted breakpoint at line %d\n", line)
+}
+
+func (d *Debugger) parseLine(text string) (int, error) {
+	line, err := strconv.Atoi(text)
+	if err != nil || line < 1 || line > len(d.lines) {
+		return 0, fmt.Errorf("No line %s, the script has %d lines", text, len(d.lines))
+	}
+	return line, nil
+}
+
+// Prints one variable, or the whole scope chain from the innermost scope out to the globals
+func (d *Debugger) printCommand(interpreter *Interpreter, args []string) {
+	environment := interpreter.Environment()
+	if len(args) > 0 {
+		for _, name := range args {
+			value, isPresent := environment.Lookup(name)
+			if !isPresent {
+				fmt.Fprintf(d.output, "Undefined variable '%s'.\n", name)
+				continue
+			}
+			fmt.Fprintf(d.output, "%s = %s\n", name, Format(value))
+		}
+		return
+	}
+
+	PrintScopes(d.output, environment)
+}
+
+func (d *Debugger) printLine(line int, isCurrent bool) {
+	if line < 1 || line > len(d.lines) {
+		return
+	}
+	marker := " "
+	if isCurrent {
+		marker = ">"
+	}
+	if d.stepper.HasBreakpoint(line) {
+		marker += "*"
+	} else {
+		marker += " "
+	}
+	fmt.Fprintf(d.output, "%s %4d | %s\n", marker, line, d.lines[line-1])
+}
+
+// Prints every variable from environment out to the globals, one scope at a time
+func PrintScopes(output io.Writer, environment *Environment) {
+	depth := 0
+	for scope := environment; scope != nil; scope = scope.Enclosing() {
+		if scope.Enclosing() == nil {
+			fmt.Fprintln(output, "globals:")
+		} else {
+			fmt.Fprintf(output, "scope %d:\n", depth)
+		}
+		values := scope.Values()
+		names := make([]string, 0, len(values))
+		for name := range values {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Fprintf(output, "  %s = %s\n", name, Format(values[name]))
+		}
+		depth++
+	}
+}
+
+// Strings are quoted so "1" and 1 look different
+func Format(value any) string {
+	if text, isString := value.(string); isString {
+		return strconv.Quote(text)
+	}
+	return interpret.Stringify(value)
+}
@@ -0,0 +1,111 @@
+package debug
+
+import (
+	"dsoechting/glox/interpret"
+)
+
+type StepMode int
+
+const (
+	CONTINUE StepMode = iota
+	STEP_INTO
+	STEP_OVER
+	STEP_OUT
+)
+
+// Why a Stepper paused
+type StopReason string
+
+const (
+	ENTRY      StopReason = "entry"
+	BREAKPOINT StopReason = "breakpoint"
+	STEP       StopReason = "step"
+)
+
+// Decides which statements a debugger pauses at, from its breakpoints and the
+// last step command. Shared by the command line debugger and the DAP server
+type Stepper struct {
+	breakpoints map[int]bool
+	mode        StepMode
+	// Call depth when the last step command was given
+	stepDepth int
+	// Where the previous statement was, so a line holding several statements pauses once
+	lastLine  int
+	lastDepth int
+	// The statements run since lastLine was reached. Meeting one of them again
+	// means a loop came back around, which is a new visit to the line
+	lineStatements map[Stmt]bool
+	// Reported for the first pause when stopping on entry
+	isStarting bool
+}
+
+// Only pauses at breakpoints until told otherwise
+func CreateStepper() *Stepper {
+	return &Stepper{breakpoints: map[int]bool{}, mode: CONTINUE}
+}
+
+// Pauses at the first statement too
+func (s *Stepper) StopOnEntry() {
+	s.mode, s.isStarting = STEP_INTO, true
+}
+
+func (s *Stepper) SetBreakpoint(line int) {
+	s.breakpoints[line] = true
+}
+
+func (s *Stepper) ClearBreakpoint(line int) {
+	delete(s.breakpoints, line)
+}
+
+func (s *Stepper) ClearBreakpoints() {
+	s.breakpoints = map[int]bool{}
+}
+
+func (s *Stepper) HasBreakpoint(line int) bool {
+	return s.breakpoints[line]
+}
+
+func (s *Stepper) Breakpoints() map[int]bool {
+	return s.breakpoints
+}
+
+// Called before each statement that is not a block, with how many frames are
+// active. Reports whether to pause there and why
+func (s *Stepper) ShouldStop(stmt Stmt, depth int) (StopReason, bool) {
+	line := interpret.StatementLine(stmt)
+	isNewVisit := line != s.lastLine || depth != s.lastDepth || s.lineStatements[stmt]
+	if isNewVisit {
+		s.lastLine, s.lastDepth = line, depth
+		s.lineStatements = map[Stmt]bool{}
+	}
+	s.lineStatements[stmt] = true
+	if !isNewVisit {
+		return "", false
+	}
+
+	reason := STEP
+	shouldStop := false
+	switch s.mode {
+	case STEP_INTO:
+		shouldStop = true
+	case STEP_OVER:
+		shouldStop = depth <= s.stepDepth
+	case STEP_OUT:
+		shouldStop = depth < s.stepDepth
+	}
+	if s.breakpoints[line] {
+		shouldStop, reason = true, BREAKPOINT
+	}
+	if s.isStarting {
+		reason, s.isStarting = ENTRY, false
+	}
+	if shouldStop {
+		s.mode = CONTINUE
+	}
+	return reason, shouldStop
+}
+
+// Resumes after a pause at the given depth, until the mode says to pause again
+func (s *Stepper) Resume(mode StepMode, depth int) {
+	s.mode, s.stepDepth = mode, depth
+}
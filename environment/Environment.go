@@ -8,24 +8,25 @@ import (
 )
 
 type Token = token.Token
-type GloxError = glox_error.GloxError
 
 type Environment struct {
 	values    map[string]any
 	enclosing *Environment
 }
 
-func Create() Environment {
-	return Environment{
+func Create() *Environment {
+	return &Environment{
 		values:    make(map[string]any),
 		enclosing: nil,
 	}
 }
 
-func CreateWithEnclosing(enclosing Environment) Environment {
-	return Environment{
+// Scopes are shared by pointer, so a closure that captures one keeps it alive
+// after its block exits and sees any later assignments made to it
+func CreateWithEnclosing(enclosing *Environment) *Environment {
+	return &Environment{
 		values:    make(map[string]any),
-		enclosing: &enclosing,
+		enclosing: enclosing,
 	}
 }
 
@@ -47,7 +48,19 @@ func (e *Environment) Get(name Token) (any, error) {
 		}
 		return enclosedValue, nil
 	}
-	return nil, glox_error.Create(name.Line, "", fmt.Sprintf("Undefined variable '%v'.\n", name.Lexeme))
+	return nil, glox_error.CreateRuntimeError(glox_error.UNDEFINED_VARIABLE, name, fmt.Sprintf("Undefined variable '%v'.", name.Lexeme))
+}
+
+// Like Get, but by plain name for callers outside of a script, such as an embedding host
+func (e *Environment) Lookup(name string) (any, bool) {
+	value, isPresent := e.values[name]
+	if isPresent {
+		return value, true
+	}
+	if e.enclosing != nil {
+		return e.enclosing.Lookup(name)
+	}
+	return nil, false
 }
 
 func (e *Environment) Assign(name Token, value any) error {
@@ -65,7 +78,37 @@ func (e *Environment) Assign(name Token, value any) error {
 		}
 
 	}
-	return glox_error.Create(name.Line, "", fmt.Sprintf("Undefined variable '%v'.", name.Lexeme))
+	return glox_error.CreateRuntimeError(glox_error.UNDEFINED_VARIABLE, name, fmt.Sprintf("Undefined variable '%v'.", name.Lexeme))
+}
+
+// A copy of the variables defined directly in this scope, not its enclosing ones
+func (e *Environment) Values() map[string]any {
+	values := make(map[string]any, len(e.values))
+	for name, value := range e.values {
+		values[name] = value
+	}
+	return values
+}
+
+func (e *Environment) Enclosing() *Environment {
+	return e.enclosing
+}
+
+// Used once the resolver has told us exactly how many scopes out a variable lives
+func (e *Environment) GetAt(distance int, name string) any {
+	return e.ancestor(distance).values[name]
+}
+
+func (e *Environment) AssignAt(distance int, name Token, value any) {
+	e.ancestor(distance).values[name.Lexeme] = value
+}
+
+func (e *Environment) ancestor(distance int) *Environment {
+	env := e
+	for i := 0; i < distance; i++ {
+		env = env.enclosing
+	}
+	return env
 }
 
 func (e *Environment) String() string {
@@ -0,0 +1,63 @@
+package glox_error
+
+// Stable identifiers for each kind of diagnostic. Tools match on these, so
+// never renumber one, only add new ones. The hundreds digit is the phase
+type Code string
+
+const (
+	// Scanning
+	UNEXPECTED_CHARACTER Code = "E100"
+	UNTERMINATED_STRING  Code = "E101"
+	INVALID_NUMBER       Code = "E102"
+
+	// Parsing
+	EXPECTED_EXPRESSION       Code = "E200"
+	EXPECTED_TOKEN            Code = "E201"
+	INVALID_ASSIGNMENT_TARGET Code = "E202"
+	TOO_MANY_ARGUMENTS        Code = "E203"
+
+	// Resolving, shared by the bytecode compiler which does the same checks
+	READ_IN_OWN_INITIALIZER       Code = "E300"
+	ALREADY_DECLARED              Code = "E301"
+	TOP_LEVEL_RETURN              Code = "E302"
+	RETURN_VALUE_FROM_INITIALIZER Code = "E303"
+	THIS_OUTSIDE_CLASS            Code = "E304"
+	SUPER_OUTSIDE_CLASS           Code = "E305"
+	SUPER_WITHOUT_SUPERCLASS      Code = "E306"
+	INHERITS_FROM_ITSELF          Code = "E307"
+
+	// Bytecode compiler limits
+	TOO_MANY_CONSTANTS   Code = "E350"
+	TOO_MANY_LOCALS      Code = "E351"
+	TOO_MANY_UPVALUES    Code = "E352"
+	JUMP_TOO_LARGE       Code = "E353"
+	UNSUPPORTED_OPERATOR Code = "E354"
+
+	// Running
+	INVALID_OPERAND      Code = "E400"
+	UNDEFINED_VARIABLE   Code = "E401"
+	UNDEFINED_PROPERTY   Code = "E402"
+	NOT_CALLABLE         Code = "E403"
+	WRONG_ARGUMENT_COUNT Code = "E404"
+	NOT_AN_INSTANCE      Code = "E405"
+	SUPERCLASS_NOT_CLASS Code = "E406"
+	STACK_OVERFLOW       Code = "E407"
+	NATIVE_FAILURE       Code = "E408"
+	INVALID_BYTECODE     Code = "E409"
+
+	// Linting, always warnings
+	UNUSED_VARIABLE    Code = "W500"
+	SHADOWED_VARIABLE  Code = "W501"
+	UNREACHABLE_CODE   Code = "W502"
+	CONSTANT_CONDITION Code = "W503"
+	SELF_ASSIGNMENT    Code = "W504"
+	INVALID_COMPARISON Code = "W505"
+	UNKNOWN_LINT_RULE  Code = "W506"
+)
+
+// Messages for INVALID_OPERAND, shared so both backends word them the same
+const (
+	OPERAND_MUST_BE_NUMBER   = "Operand must be a number."
+	OPERANDS_MUST_BE_NUMBERS = "Operands must be numbers."
+	OPERANDS_MUST_BE_ADDABLE = "Operands must be two numbers or two strings."
+)
@@ -1,17 +1,295 @@
 package glox_error
 
-import "fmt"
+import (
+	"dsoechting/glox/token"
+	"fmt"
+	"strings"
+)
 
-type GloxError struct {
-	line    int
-	where   string
-	message string
+type Severity int
+
+const (
+	ERROR Severity = iota
+	WARNING
+)
+
+func (s Severity) String() string {
+	if s == WARNING {
+		return "Warning"
+	}
+	return "Error"
+}
+
+// A stretch of source text, Start and End are byte offsets with End exclusive.
+// The zero Span means the location inside the line is unknown
+type Span struct {
+	Column int
+	Start  int
+	End    int
+}
+
+func (s Span) IsKnown() bool {
+	return s.Column > 0
+}
+
+// The span a token was scanned from, unknown for tokens made up by the compiler
+func SpanOf(tok token.Token) Span {
+	if !tok.HasPosition() {
+		return Span{}
+	}
+	return Span{Column: tok.Column, Start: tok.Start, End: tok.End}
+}
+
+// Extra context attached to a diagnostic, like where an unclosed paren opened
+type Note struct {
+	Message string
+	Span    Span
+}
+
+// Everything known about one problem in a script. Each phase wraps it in its
+// own type (ScanError, ParseError, ...) so callers can tell them apart with errors.As
+type Diagnostic struct {
+	Severity Severity
+	Code     Code
+	Line     int
+	// Describes the location in words, like " at 'x'"
+	Where   string
+	Message string
+	Span    Span
+	Notes   []Note
+	// Possibly nil, the Go error this one was raised from
+	cause error
+}
+
+func (d *Diagnostic) Error() string {
+	return fmt.Sprintf("[line %d] %s %s: %s", d.Line, d.Severity, d.Where, d.Message)
+}
+
+func (d *Diagnostic) Unwrap() error {
+	return d.cause
+}
+
+// Gives access to the diagnostic behind any of the phase error types
+func (d *Diagnostic) Details() *Diagnostic {
+	return d
+}
+
+func (d *Diagnostic) AddNote(message string, span Span) {
+	d.Notes = append(d.Notes, Note{Message: message, Span: span})
+}
+
+// Implemented by every phase error type
+type Reportable interface {
+	error
+	Details() *Diagnostic
+}
+
+type ScanError struct{ Diagnostic }
+type ParseError struct {
+	Diagnostic
+	// Set when the input ran out, so more of it might fix the error
+	IsAtEnd bool
+}
+type ResolveError struct{ Diagnostic }
+
+// Raised by the bytecode compiler, which does its own resolution
+type CompileError struct{ Diagnostic }
+
+// Found by glox lint, the code runs but probably not as intended
+type LintError struct{ Diagnostic }
+
+type RuntimeError struct {
+	Diagnostic
+	// The glox frames that were active when the error was raised, innermost first
+	Trace []Frame
+	// Line in the caller of the last frame added, which becomes the next frame's line
+	callLine int
 }
 
-func (e *GloxError) Error() string {
-	return fmt.Sprintf("[line %d] Error %s: %s", e.line, e.where, e.message)
+// One active call. Line is where that call was executing when the error hit
+type Frame struct {
+	Name string `json:"name"`
+	File string `json:"file"`
+	Line int    `json:"line"`
 }
 
-func Create(line int, where string, message string) *GloxError {
-	return &GloxError{line, where, message}
+// The name of the frame for code outside any function
+const SCRIPT_FRAME = "script"
+
+// Records the frame the error is unwinding out of, callLine being the line
+// in the caller that made the call. Frames must be added innermost first
+func (e *RuntimeError) AddFrame(name string, callLine int) {
+	line := e.Line
+	if len(e.Trace) > 0 {
+		line = e.callLine
+	}
+	e.Trace = append(e.Trace, Frame{Name: name, Line: line})
+	e.callLine = callLine
+}
+
+// Fills in the file of every frame that doesn't know it yet
+func (e *RuntimeError) SetFile(file string) {
+	for i := range e.Trace {
+		if e.Trace[i].File == "" {
+			e.Trace[i].File = file
+		}
+	}
+}
+
+func Create(code Code, line int, where string, message string) Diagnostic {
+	return Diagnostic{Severity: ERROR, Code: code, Line: line, Where: where, Message: message}
+}
+
+// Creates a diagnostic pointing at the token
+func CreateAt(code Code, tokenWithError token.Token, where string, message string) Diagnostic {
+	diagnostic := Create(code, tokenWithError.Line, where, message)
+	diagnostic.Span = SpanOf(tokenWithError)
+	return diagnostic
+}
+
+// Wraps an error from Go code, keeping it reachable through errors.Is and errors.As
+func Wrap(code Code, line int, where string, cause error) Diagnostic {
+	diagnostic := Create(code, line, where, cause.Error())
+	diagnostic.cause = cause
+	return diagnostic
+}
+
+// Runtime errors come from several packages and all look alike, so they get a shortcut
+func CreateRuntimeError(code Code, tokenWithError token.Token, message string) *RuntimeError {
+	return &RuntimeError{Diagnostic: CreateAt(code, tokenWithError, "", message)}
+}
+
+// Flattens errors joined with errors.Join, or any other Unwrap() []error, into a list
+func Flatten(err error) []error {
+	if err == nil {
+		return nil
+	}
+	if joined, isJoined := err.(interface{ Unwrap() []error }); isJoined {
+		flattened := []error{}
+		for _, inner := range joined.Unwrap() {
+			flattened = append(flattened, Flatten(inner)...)
+		}
+		return flattened
+	}
+	return []error{err}
+}
+
+// Formats err for people: each diagnostic that knows its span is followed by the
+// offending source line with the span underlined, then by its notes
+func Render(source string, err error) string {
+	rendered := []string{}
+	for _, single := range Flatten(err) {
+		reportable, isReportable := single.(Reportable)
+		if !isReportable {
+			rendered = append(rendered, single.Error())
+			continue
+		}
+		diagnostic := reportable.Details()
+		text := ""
+		if runtimeErr, isRuntime := single.(*RuntimeError); isRuntime && len(runtimeErr.Trace) > 1 {
+			text = traceback(source, runtimeErr.Trace) + "\n"
+		}
+		text += diagnostic.Error()
+		if showsIn(source, diagnostic.Span) {
+			text += "\n" + snippet(source, diagnostic.Span)
+		}
+		for _, note := range diagnostic.Notes {
+			text += "\n  note: " + note.Message
+			if showsIn(source, note.Span) {
+				text += "\n" + snippet(source, note.Span)
+			}
+		}
+		rendered = append(rendered, text)
+	}
+	return strings.Join(rendered, "\n")
+}
+
+// Past this many identical frames in a row, the rest are summarized in one line
+const repeatedFrameLimit = 3
+
+// Lists the frames outermost first, like Python does:
+//
+//	Traceback (most recent call last):
+//	  File "fib.glox", line 9, in script
+//	    print fib(30);
+func traceback(source string, trace []Frame) string {
+	lines := []string{"Traceback (most recent call last):"}
+	repeats := 0
+	for i := len(trace) - 1; i >= 0; i-- {
+		frame := trace[i]
+		if i < len(trace)-1 && frame == trace[i+1] {
+			repeats++
+		} else {
+			lines = appendRepeats(lines, repeats)
+			repeats = 0
+		}
+		if repeats >= repeatedFrameLimit {
+			continue
+		}
+		file := frame.File
+		if file == "" {
+			file = "<stdin>"
+		}
+		lines = append(lines, fmt.Sprintf("  File \"%s\", line %d, in %s", file, frame.Line, frame.Name))
+		if text, found := sourceLine(source, frame.Line); found {
+			lines = append(lines, "    "+text)
+		}
+	}
+	return strings.Join(appendRepeats(lines, repeats), "\n")
+}
+
+func appendRepeats(lines []string, repeats int) []string {
+	if repeats < repeatedFrameLimit {
+		return lines
+	}
+	return append(lines, fmt.Sprintf("  [Previous frame repeated %d more times]", repeats-repeatedFrameLimit+1))
+}
+
+// The trimmed text of a 1-based line of source
+func sourceLine(source string, line int) (string, bool) {
+	lines := strings.Split(source, "\n")
+	if line < 1 || line > len(lines) {
+		return "", false
+	}
+	text := strings.TrimSpace(lines[line-1])
+	return text, text != ""
+}
+
+func showsIn(source string, span Span) bool {
+	return span.IsKnown() && span.Start <= len(source)
+}
+
+// The source line holding the span, with carets under it:
+//
+//	3 | print (1 + ;
+//	  |            ^
+func snippet(source string, span Span) string {
+	lineStart := strings.LastIndexByte(source[:span.Start], '\n') + 1
+	lineEnd := strings.IndexByte(source[span.Start:], '\n')
+	if lineEnd < 0 {
+		lineEnd = len(source)
+	} else {
+		lineEnd += span.Start
+	}
+	text := strings.TrimRight(source[lineStart:lineEnd], "\r")
+	lineNumber := strings.Count(source[:lineStart], "\n") + 1
+
+	// Mirror tabs so the carets line up however wide the terminal draws them
+	var indent strings.Builder
+	for _, char := range source[lineStart:span.Start] {
+		if char == '\t' {
+			indent.WriteRune('\t')
+		} else {
+			indent.WriteRune(' ')
+		}
+	}
+	// Spans running onto later lines are underlined to the end of this one
+	width := min(span.End, lineEnd) - span.Start
+	if width < 1 {
+		width = 1
+	}
+
+	gutter := fmt.Sprintf("%d", lineNumber)
+	blank := strings.Repeat(" ", len(gutter))
+	return fmt.Sprintf(" %s | %s\n %s | %s%s", gutter, text, blank, indent.String(), strings.Repeat("^", width))
 }
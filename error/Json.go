@@ -0,0 +1,91 @@
+package glox_error
+
+import (
+	"encoding/json"
+	"io"
+	"strings"
+)
+
+// One diagnostic as emitted by -diagnostics=json. Columns are 1-based bytes,
+// and the end position is exclusive, just past the last character
+type JSONDiagnostic struct {
+	File      string     `json:"file"`
+	Line      int        `json:"line"`
+	Column    int        `json:"column,omitempty"`
+	EndLine   int        `json:"endLine,omitempty"`
+	EndColumn int        `json:"endColumn,omitempty"`
+	Code      Code       `json:"code,omitempty"`
+	Severity  string     `json:"severity"`
+	Message   string     `json:"message"`
+	Notes     []JSONNote `json:"notes,omitempty"`
+	// Active frames of a runtime error, innermost first
+	Trace []Frame `json:"trace,omitempty"`
+}
+
+type JSONNote struct {
+	Message   string `json:"message"`
+	Line      int    `json:"line,omitempty"`
+	Column    int    `json:"column,omitempty"`
+	EndLine   int    `json:"endLine,omitempty"`
+	EndColumn int    `json:"endColumn,omitempty"`
+}
+
+// Converts every error in err to its JSON form. Errors that aren't diagnostics,
+// like a corrupt .gloxc file, keep only their message
+func ToJSON(file string, source string, err error) []JSONDiagnostic {
+	converted := []JSONDiagnostic{}
+	for _, single := range Flatten(err) {
+		reportable, isReportable := single.(Reportable)
+		if !isReportable {
+			converted = append(converted, JSONDiagnostic{
+				File:     file,
+				Severity: strings.ToLower(ERROR.String()),
+				Message:  single.Error(),
+			})
+			continue
+		}
+		diagnostic := reportable.Details()
+		entry := JSONDiagnostic{
+			File:     file,
+			Line:     diagnostic.Line,
+			Code:     diagnostic.Code,
+			Severity: strings.ToLower(diagnostic.Severity.String()),
+			Message:  diagnostic.Message,
+		}
+		if showsIn(source, diagnostic.Span) {
+			entry.Line, entry.Column = Position(source, diagnostic.Span.Start)
+			entry.EndLine, entry.EndColumn = Position(source, diagnostic.Span.End)
+		}
+		for _, note := range diagnostic.Notes {
+			jsonNote := JSONNote{Message: note.Message}
+			if showsIn(source, note.Span) {
+				jsonNote.Line, jsonNote.Column = Position(source, note.Span.Start)
+				jsonNote.EndLine, jsonNote.EndColumn = Position(source, note.Span.End)
+			}
+			entry.Notes = append(entry.Notes, jsonNote)
+		}
+		if runtimeErr, isRuntime := single.(*RuntimeError); isRuntime {
+			entry.Trace = runtimeErr.Trace
+		}
+		converted = append(converted, entry)
+	}
+	return converted
+}
+
+// Writes each diagnostic in err as a JSON object on its own line
+func WriteJSON(w io.Writer, file string, source string, err error) error {
+	encoder := json.NewEncoder(w)
+	for _, entry := range ToJSON(file, source, err) {
+		if encodeErr := encoder.Encode(entry); encodeErr != nil {
+			return encodeErr
+		}
+	}
+	return nil
+}
+
+// The 1-based line and byte column of an offset into source
+func Position(source string, offset int) (int, int) {
+	offset = min(offset, len(source))
+	lineStart := strings.LastIndexByte(source[:offset], '\n') + 1
+	return strings.Count(source[:lineStart], "\n") + 1, offset - lineStart + 1
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"dsoechting/glox/format"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+)
+
+// glox fmt [-w] [-d] [script ...]
+// Reprints scripts in the canonical style, or stdin when no scripts are named
+func (g *Glox) formatScripts(args []string) int {
+	flags := flag.NewFlagSet("fmt", flag.ExitOnError)
+	write := flags.Bool("w", false, "rewrite each script in place instead of printing it")
+	diff := flags.Bool("d", false, "print a diff of the changes instead of the formatted script")
+	flags.Parse(args)
+
+	if flags.NArg() == 0 {
+		if *write {
+			fmt.Fprintln(g.options.Stderr, "Usage glox fmt [-w] [-d] [script ...], -w needs a script to rewrite")
+			return 64
+		}
+		data, readErr := io.ReadAll(g.options.Stdin)
+		if readErr != nil {
+			fmt.Fprintln(g.options.Stderr, readErr)
+			return 66
+		}
+		return g.formatSource("<stdin>", string(data), false, *diff)
+	}
+
+	exitCode := 0
+	for _, path := range flags.Args() {
+		data, readErr := os.ReadFile(path)
+		if readErr != nil {
+			fmt.Fprintln(g.options.Stderr, readErr)
+			exitCode = 66
+			continue
+		}
+		if code := g.formatSource(path, string(data), *write, *diff); code != 0 {
+			exitCode = code
+		}
+	}
+	return exitCode
+}
+
+func (g *Glox) formatSource(path string, source string, write bool, diff bool) int {
+	g.file, g.source = path, source
+	formatted, formatErr := format.Source(source)
+	if formatErr != nil {
+		g.report(formatErr)
+		return exitCode(formatErr)
+	}
+
+	if diff {
+		fmt.Fprint(g.options.Stdout, format.Diff(path+".orig", path, source, formatted))
+	}
+	if write {
+		if formatted == source {
+			return 0
+		}
+		info, statErr := os.Stat(path)
+		if statErr != nil {
+			fmt.Fprintln(g.options.Stderr, statErr)
+			return 74
+		}
+		if writeErr := os.WriteFile(path, []byte(formatted), info.Mode().Perm()); writeErr != nil {
+			fmt.Fprintln(g.options.Stderr, writeErr)
+			return 74
+		}
+		return 0
+	}
+	if !diff {
+		fmt.Fprint(g.options.Stdout, formatted)
+	}
+	return 0
+}
@@ -0,0 +1,136 @@
+package format
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Lines of unchanged text shown around each change
+const DIFF_CONTEXT = 3
+
+// One line of a diff. Kind is ' ' for a line both texts share, '-' for one
+// only in the old text and '+' for one only in the new
+type edit struct {
+	kind byte
+	text string
+	// 0-based lines in each text where the edit sits
+	oldLine int
+	newLine int
+}
+
+// A unified diff from old to new, or "" when they are the same
+func Diff(oldName string, newName string, old string, new string) string {
+	edits := lineEdits(lines(old), lines(new))
+	var diff strings.Builder
+	for start := 0; start < len(edits); {
+		// Find the next change, then grow the hunk until the changes are far enough apart
+		for start < len(edits) && edits[start].kind == ' ' {
+			start++
+		}
+		if start == len(edits) {
+			break
+		}
+		end := start
+		for index := start; index < len(edits) && index <= end+2*DIFF_CONTEXT; index++ {
+			if edits[index].kind != ' ' {
+				end = index
+			}
+		}
+		hunk := edits[max(0, start-DIFF_CONTEXT):min(len(edits), end+DIFF_CONTEXT+1)]
+
+		if diff.Len() == 0 {
+			fmt.Fprintf(&diff, "--- %s\n+++ %s\n", oldName, newName)
+		}
+		oldCount, newCount := 0, 0
+		for _, line := range hunk {
+			if line.kind != '+' {
+				oldCount++
+			}
+			if line.kind != '-' {
+				newCount++
+			}
+		}
+		fmt.Fprintf(&diff, "@@ -%s +%s @@\n", hunkRange(hunk[0].oldLine, oldCount), hunkRange(hunk[0].newLine, newCount))
+		for _, line := range hunk {
+			fmt.Fprintf(&diff, "%c%s\n", line.kind, line.text)
+		}
+		start = end + 1
+	}
+	return diff.String()
+}
+
+// An empty range is named by the line before it
+func hunkRange(line int, count int) string {
+	if count > 0 {
+		line++
+	}
+	return fmt.Sprintf("%d,%d", line, count)
+}
+
+func lines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
+
+// Myers' algorithm: finds the shortest edit script by trying ever more edits,
+// keeping how far each diagonal reached so the path can be walked back
+func lineEdits(old []string, new []string) []edit {
+	limit := len(old) + len(new)
+	offset := limit + 1
+	reach := make([]int, 2*limit+2)
+	trace := [][]int{}
+	edits := 0
+search:
+	for ; edits <= limit; edits++ {
+		trace = append(trace, append([]int(nil), reach...))
+		for diagonal := -edits; diagonal <= edits; diagonal += 2 {
+			x := 0
+			if diagonal == -edits || (diagonal != edits && reach[offset+diagonal-1] < reach[offset+diagonal+1]) {
+				x = reach[offset+diagonal+1]
+			} else {
+				x = reach[offset+diagonal-1] + 1
+			}
+			y := x - diagonal
+			for x < len(old) && y < len(new) && old[x] == new[y] {
+				x, y = x+1, y+1
+			}
+			reach[offset+diagonal] = x
+			if x >= len(old) && y >= len(new) {
+				break search
+			}
+		}
+	}
+
+	reversed := []edit{}
+	x, y := len(old), len(new)
+	for ; edits >= 0; edits-- {
+		reach := trace[edits]
+		diagonal := x - y
+		previous := diagonal - 1
+		if diagonal == -edits || (diagonal != edits && reach[offset+diagonal-1] < reach[offset+diagonal+1]) {
+			previous = diagonal + 1
+		}
+		previousX := reach[offset+previous]
+		previousY := previousX - previous
+		for x > previousX && y > previousY {
+			x, y = x-1, y-1
+			reversed = append(reversed, edit{kind: ' ', text: old[x], oldLine: x, newLine: y})
+		}
+		if edits > 0 {
+			if x == previousX {
+				reversed = append(reversed, edit{kind: '+', text: new[previousY], oldLine: previousX, newLine: previousY})
+			} else {
+				reversed = append(reversed, edit{kind: '-', text: old[previousX], oldLine: previousX, newLine: previousY})
+			}
+		}
+		x, y = previousX, previousY
+	}
+
+	result := make([]edit, len(reversed))
+	for index, line := range reversed {
+		result[len(reversed)-1-index] = line
+	}
+	return result
+}
@@ -0,0 +1,449 @@
+package format
+
+import (
+	"bytes"
+	"dsoechting/glox/ast"
+	"dsoechting/glox/parse"
+	"dsoechting/glox/scanner"
+	"dsoechting/glox/token"
+	"fmt"
+	"strings"
+)
+
+type Token = token.Token
+type Comment = token.Comment
+type Stmt = ast.Stmt
+type Expr = ast.Expr
+
+const INDENT = "  "
+
+// Reprints a parsed script in the canonical style. The printer walks the syntax
+// tree for structure while stepping through the tokens in lockstep, which is
+// where it finds the comments and blank lines to keep
+type Formatter struct {
+	tokens  []Token
+	current int
+	// Index of the token whose comments were written early, so they aren't written twice
+	commentsWritten int
+	out             []byte
+	indent          int
+	// A line break is owed before whatever is written next
+	isNewlinePending bool
+	// The owed line break splits a statement, so the next line is indented further
+	isContinuation bool
+	// Right after an opening brace, where blank lines are dropped
+	isBlockStart bool
+	// Source line of the last token or comment written, to keep blank lines
+	lastLine int
+	err      error
+}
+
+func Create(tokens []Token) *Formatter {
+	return &Formatter{tokens: tokens, commentsWritten: -1}
+}
+
+// Scans, parses and formats a whole script
+func Source(source string) (string, error) {
+	tokens, scanErr := scanner.Create(source).ScanTokens()
+	if scanErr != nil {
+		return "", scanErr
+	}
+	parser := parse.Create(tokens)
+	statements, parseErr := parser.Parse()
+	if parseErr != nil {
+		return "", parseErr
+	}
+	return Create(tokens).Format(statements)
+}
+
+// Formats statements parsed from the formatter's tokens
+func (f *Formatter) Format(statements []Stmt) (string, error) {
+	for _, stmt := range statements {
+		f.newline()
+		f.statement(stmt)
+	}
+	// Comments after the last statement ride on the EOF token
+	f.newline()
+	f.writeComments()
+	if f.err == nil && f.current != len(f.tokens)-1 {
+		f.fail("a token")
+	}
+	if f.err != nil {
+		return "", f.err
+	}
+	if len(f.out) == 0 {
+		return "", nil
+	}
+	return string(f.out) + "\n", nil
+}
+
+func (f *Formatter) statement(stmt Stmt) {
+	switch stmt := stmt.(type) {
+	case *ast.BlockStmt:
+		if f.check(token.FOR) {
+			// A for loop with an initializer, which the parser wraps in a block
+			f.forLoop(stmt.Statements[0], stmt.Statements[1].(*ast.WhileStmt))
+			return
+		}
+		f.block(stmt.Statements)
+	case *ast.ClassStmt:
+		f.token("class")
+		f.space()
+		f.token(stmt.Name.Lexeme)
+		if stmt.Superclass != nil {
+			f.space()
+			f.token("<")
+			f.space()
+			f.token(stmt.Superclass.Name.Lexeme)
+		}
+		f.space()
+		f.openBrace()
+		for _, method := range stmt.Methods {
+			f.newline()
+			f.function(method)
+		}
+		f.closeBrace(len(stmt.Methods) == 0)
+	case *ast.ExpressionStmt:
+		f.expression(stmt.Expression)
+		f.token(";")
+	case *ast.FunctionStmt:
+		f.token("fun")
+		f.space()
+		f.function(stmt)
+	case *ast.IfStmt:
+		f.token("if")
+		f.space()
+		f.token("(")
+		f.expression(stmt.Condition)
+		f.token(")")
+		isThenBlock := f.body(stmt.ThenBranch)
+		if stmt.ElseBranch == nil {
+			return
+		}
+		if isThenBlock {
+			f.space()
+		} else {
+			f.newline()
+		}
+		f.token("else")
+		if _, isElseIf := stmt.ElseBranch.(*ast.IfStmt); isElseIf {
+			f.space()
+			f.statement(stmt.ElseBranch)
+		} else {
+			f.body(stmt.ElseBranch)
+		}
+	case *ast.PrintStmt:
+		f.token("print")
+		f.space()
+		f.expression(stmt.Expression)
+		f.token(";")
+	case *ast.ReturnStmt:
+		f.token("return")
+		if stmt.Value != nil {
+			f.space()
+			f.expression(stmt.Value)
+		}
+		f.token(";")
+	case *ast.VarStmt:
+		f.token("var")
+		f.space()
+		f.token(stmt.Name.Lexeme)
+		if stmt.Initializer != nil {
+			f.space()
+			f.token("=")
+			f.space()
+			f.expression(stmt.Initializer)
+		}
+		f.token(";")
+	case *ast.WhileStmt:
+		if stmt.Keyword.TokenType == token.FOR {
+			f.forLoop(nil, stmt)
+			return
+		}
+		f.token("while")
+		f.space()
+		f.token("(")
+		f.expression(stmt.Condition)
+		f.token(")")
+		f.body(stmt.Body)
+	}
+}
+
+// The parser turns for loops into while loops, so the tokens tell us which
+// clauses were really written
+func (f *Formatter) forLoop(initializer Stmt, loop *ast.WhileStmt) {
+	f.token("for")
+	f.space()
+	f.token("(")
+	if initializer != nil {
+		f.statement(initializer)
+	} else {
+		f.token(";")
+	}
+	if !f.check(token.SEMICOLON) {
+		f.space()
+		f.expression(loop.Condition)
+	}
+	f.token(";")
+	body := loop.Body
+	if !f.check(token.RIGHT_PAREN) {
+		// The increment was appended to the end of the body
+		withIncrement := body.(*ast.BlockStmt)
+		body = withIncrement.Statements[0]
+		f.space()
+		f.expression(withIncrement.Statements[1].(*ast.ExpressionStmt).Expression)
+	}
+	f.token(")")
+	f.body(body)
+}
+
+// Blocks open on the same line, any other body goes on its own indented line.
+// Reports whether the body was a block
+func (f *Formatter) body(stmt Stmt) bool {
+	if _, isBlock := stmt.(*ast.BlockStmt); isBlock && f.check(token.LEFT_BRACE) {
+		f.space()
+		f.statement(stmt)
+		return true
+	}
+	f.indent++
+	f.newline()
+	f.statement(stmt)
+	f.indent--
+	return false
+}
+
+func (f *Formatter) function(stmt *ast.FunctionStmt) {
+	f.token(stmt.Name.Lexeme)
+	f.token("(")
+	for index, param := range stmt.Params {
+		if index > 0 {
+			f.token(",")
+			f.space()
+		}
+		f.token(param.Lexeme)
+	}
+	f.token(")")
+	f.space()
+	f.block(stmt.Body)
+}
+
+func (f *Formatter) block(statements []Stmt) {
+	f.openBrace()
+	for _, stmt := range statements {
+		f.newline()
+		f.statement(stmt)
+	}
+	f.closeBrace(len(statements) == 0)
+}
+
+func (f *Formatter) openBrace() {
+	f.token("{")
+	f.indent++
+	f.isBlockStart = true
+}
+
+// Comments before the brace stay inside the block. An empty block closes on the line it opened
+func (f *Formatter) closeBrace(isEmpty bool) {
+	if f.current < len(f.tokens) && len(f.tokens[f.current].Comments) > 0 {
+		isEmpty = false
+		f.newline()
+		f.writeComments()
+	}
+	f.indent--
+	if !isEmpty {
+		f.newline()
+	}
+	f.token("}")
+}
+
+func (f *Formatter) expression(expr Expr) {
+	switch expr := expr.(type) {
+	case *ast.AssignExpr:
+		f.token(expr.Name.Lexeme)
+		f.space()
+		f.token("=")
+		f.space()
+		f.expression(expr.Value)
+	case *ast.BinaryExpr:
+		f.expression(expr.Left)
+		f.space()
+		f.token(expr.Operator.Lexeme)
+		f.space()
+		f.expression(expr.Right)
+	case *ast.CallExpr:
+		f.expression(expr.Callee)
+		f.token("(")
+		for index, argument := range expr.Arguments {
+			if index > 0 {
+				f.token(",")
+				f.space()
+			}
+			f.expression(argument)
+		}
+		f.token(")")
+	case *ast.GetExpr:
+		f.expression(expr.Object)
+		f.token(".")
+		f.token(expr.Name.Lexeme)
+	case *ast.GroupingExpr:
+		f.token("(")
+		f.expression(expr.Expression)
+		f.token(")")
+	case *ast.LiteralExpr:
+		f.token(expr.Token.Lexeme)
+	case *ast.LogicalExpr:
+		f.expression(expr.Left)
+		f.space()
+		f.token(expr.Operator.Lexeme)
+		f.space()
+		f.expression(expr.Right)
+	case *ast.SetExpr:
+		f.expression(expr.Object)
+		f.token(".")
+		f.token(expr.Name.Lexeme)
+		f.space()
+		f.token("=")
+		f.space()
+		f.expression(expr.Value)
+	case *ast.SuperExpr:
+		f.token("super")
+		f.token(".")
+		f.token(expr.Method.Lexeme)
+	case *ast.TernaryExpr:
+		f.expression(expr.First)
+		f.space()
+		f.token("?")
+		f.space()
+		f.expression(expr.Second)
+		f.space()
+		f.token(":")
+		f.space()
+		f.expression(expr.Third)
+	case *ast.ThisExpr:
+		f.token("this")
+	case *ast.UnaryExpr:
+		f.token(expr.Operator.Lexeme)
+		f.expression(expr.Right)
+	case *ast.VariableExpr:
+		f.token(expr.Name.Lexeme)
+	}
+}
+
+func (f *Formatter) check(tokenType token.TokenType) bool {
+	return f.current < len(f.tokens) && f.tokens[f.current].TokenType == tokenType
+}
+
+// Writes the next source token, which has to be the one the printer expects.
+// Anything else means the printer and the tree disagree, and the output can't be trusted
+func (f *Formatter) token(lexeme string) {
+	if f.err != nil {
+		return
+	}
+	if f.current >= len(f.tokens) || f.tokens[f.current].Lexeme != lexeme || f.tokens[f.current].TokenType == token.EOF {
+		f.fail(fmt.Sprintf("'%s'", lexeme))
+		return
+	}
+	f.writeComments()
+	next := f.tokens[f.current]
+	f.startLine(next.Line, next.TokenType != token.RIGHT_BRACE)
+	f.write(lexeme)
+	f.lastLine = next.Line + strings.Count(lexeme, "\n")
+	f.isBlockStart = false
+	f.current++
+}
+
+func (f *Formatter) fail(expected string) {
+	if f.current >= len(f.tokens) {
+		f.err = fmt.Errorf("formatter expected %s past the end of the script", expected)
+		return
+	}
+	found := f.tokens[f.current]
+	f.err = fmt.Errorf("[line %d] formatter expected %s but found '%s'", found.Line, expected, found.Lexeme)
+}
+
+func (f *Formatter) write(text string) {
+	f.out = append(f.out, text...)
+}
+
+func (f *Formatter) space() {
+	if !f.isNewlinePending {
+		f.write(" ")
+	}
+}
+
+// Owes a line break before the next thing written, at the current indent
+func (f *Formatter) newline() {
+	if len(f.out) > 0 {
+		f.isNewlinePending = true
+	}
+	f.isContinuation = false
+}
+
+// Either nothing is written yet or a line break is owed
+func (f *Formatter) isAtLineStart() bool {
+	return f.isNewlinePending || len(f.out) == 0
+}
+
+// Pays any owed line break before writing something from sourceLine. A blank
+// line in the source survives as one blank line, except right inside braces
+func (f *Formatter) startLine(sourceLine int, allowsBlank bool) {
+	if !f.isNewlinePending {
+		return
+	}
+	f.out = bytes.TrimRight(f.out, " ")
+	f.write("\n")
+	if allowsBlank && sourceLine > f.lastLine+1 && !f.isBlockStart {
+		f.write("\n")
+	}
+	indent := f.indent
+	if f.isContinuation {
+		indent++
+	}
+	f.write(strings.Repeat(INDENT, indent))
+	f.isNewlinePending = false
+}
+
+// Writes the comments in front of the next token
+func (f *Formatter) writeComments() {
+	if f.current >= len(f.tokens) || f.commentsWritten == f.current {
+		return
+	}
+	f.commentsWritten = f.current
+	for _, comment := range f.tokens[f.current].Comments {
+		f.comment(comment)
+	}
+}
+
+func (f *Formatter) comment(comment Comment) {
+	switch {
+	case comment.IsTrailing && f.isNewlinePending:
+		// Stays at the end of the line it followed
+		f.write(" " + comment.Text)
+	case comment.IsTrailing:
+		// In the middle of a statement
+		f.write(comment.Text)
+		if comment.IsBlock() {
+			f.write(" ")
+		}
+	default:
+		if !f.isAtLineStart() {
+			// On its own line in the middle of a statement
+			f.isNewlinePending, f.isContinuation = true, true
+		}
+		f.startLine(comment.Line, true)
+		f.write(comment.Text)
+		endLine := comment.Line + strings.Count(comment.Text, "\n")
+		if comment.IsBlock() && f.current < len(f.tokens) && f.tokens[f.current].Line == endLine && f.tokens[f.current].TokenType != token.EOF {
+			// Code follows on the same line, so it stays there
+			f.write(" ")
+		} else {
+			f.isNewlinePending = true
+		}
+	}
+	f.lastLine = comment.Line + strings.Count(comment.Text, "\n")
+	f.isBlockStart = false
+	if !comment.IsBlock() && !f.isNewlinePending {
+		// Whatever follows a line comment has to go on the next line
+		f.isNewlinePending, f.isContinuation = true, true
+	}
+}
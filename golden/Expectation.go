@@ -0,0 +1,73 @@
+package golden
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// The annotations follow the upstream Lox test suite:
+//
+//	print 1; // expect: 1
+//	1 + 2; // expect echo: 3
+//	a(); // expect runtime error: Undefined variable 'a'.
+//	var = 1; // Error at '=': Expect variable name.
+//	// [line 3] Error at end: Expect '}' after block.
+var (
+	expectOutput       = regexp.MustCompile(`// expect: ?(.*)`)
+	expectEcho         = regexp.MustCompile(`// expect echo: ?(.*)`)
+	expectRuntimeError = regexp.MustCompile(`// expect runtime error: (.+)`)
+	expectErrorOnLine  = regexp.MustCompile(`// \[line (\d+)\] ((?i:error).*)`)
+	expectError        = regexp.MustCompile(`// ((?i:error).*)`)
+)
+
+// One annotation. Text is the printed line, the echoed value, the runtime error message, or the
+// whole "Error at 'x': message" for a static error
+type Expected struct {
+	Line int
+	Text string
+}
+
+// What a script says it should do when run
+type Expectations struct {
+	Output []Expected
+	// Values the REPL would show for the script's expression statements
+	Echoes       []Expected
+	Errors       []Expected
+	RuntimeError *Expected
+}
+
+func Parse(source string) Expectations {
+	expectations := Expectations{}
+	for index, text := range strings.Split(source, "\n") {
+		line := index + 1
+		if match := expectOutput.FindStringSubmatch(text); match != nil {
+			expectations.Output = append(expectations.Output, Expected{Line: line, Text: match[1]})
+		} else if match := expectEcho.FindStringSubmatch(text); match != nil {
+			expectations.Echoes = append(expectations.Echoes, Expected{Line: line, Text: match[1]})
+		} else if match := expectRuntimeError.FindStringSubmatch(text); match != nil {
+			expectations.RuntimeError = &Expected{Line: line, Text: match[1]}
+		} else if match := expectErrorOnLine.FindStringSubmatch(text); match != nil {
+			errorLine, _ := strconv.Atoi(match[1])
+			expectations.Errors = append(expectations.Errors, Expected{Line: errorLine, Text: match[2]})
+		} else if match := expectError.FindStringSubmatch(text); match != nil {
+			expectations.Errors = append(expectations.Errors, Expected{Line: line, Text: match[1]})
+		}
+	}
+	return expectations
+}
+
+// Splits "Error at 'x': message" into "at 'x'" and "message"
+func splitError(text string) (string, string) {
+	rest := strings.TrimSpace(text[len("error"):])
+	if strings.HasPrefix(rest, "at '") {
+		if end := strings.Index(rest[len("at '"):], "': "); end >= 0 {
+			end += len("at '") + 1
+			return rest[:end], rest[end+len(": "):]
+		}
+	}
+	if end := strings.Index(rest, ": "); end >= 0 {
+		return strings.TrimSpace(rest[:end]), rest[end+len(": "):]
+	}
+	return strings.TrimPrefix(rest, ":"), ""
+}
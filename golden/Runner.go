@@ -0,0 +1,174 @@
+package golden
+
+import (
+	"dsoechting/glox/compile"
+	glox_error "dsoechting/glox/error"
+	"dsoechting/glox/interpret"
+	"dsoechting/glox/parse"
+	"dsoechting/glox/resolve"
+	"dsoechting/glox/scanner"
+	"dsoechting/glox/vm"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"strings"
+)
+
+type Diagnostic = glox_error.Diagnostic
+
+// Runs a script, printing to stdout. Returns the values the REPL would echo,
+// formatted, along with whatever error stopped it
+type Backend func(source string, stdout io.Writer) ([]string, error)
+
+// Each script gets a fresh interpreter, and reads from an empty stdin so readLine never blocks
+func Tree(source string, stdout io.Writer) ([]string, error) {
+	statements, parseErr := parseSource(source)
+	if parseErr != nil {
+		return nil, parseErr
+	}
+	interpreter := interpret.CreateWithOptions(interpret.Options{Stdout: stdout, Stderr: io.Discard, Stdin: strings.NewReader("")})
+	if resolveErr := resolve.Create(&interpreter).Resolve(statements); resolveErr != nil {
+		return nil, resolveErr
+	}
+	values, runErr := interpreter.Interpret(statements)
+	echoes := []string{}
+	for _, value := range values {
+		echoes = append(echoes, interpret.Stringify(value))
+	}
+	return echoes, runErr
+}
+
+func VM(source string, stdout io.Writer) ([]string, error) {
+	statements, parseErr := parseSource(source)
+	if parseErr != nil {
+		return nil, parseErr
+	}
+	function, compileErr := compile.Compile(statements)
+	if compileErr != nil {
+		return nil, compileErr
+	}
+	values, runErr := vm.CreateWithOptions(vm.Options{Stdout: stdout, Stderr: io.Discard, Stdin: strings.NewReader("")}).Interpret(function)
+	echoes := []string{}
+	for _, value := range values {
+		echoes = append(echoes, value.String())
+	}
+	return echoes, runErr
+}
+
+func parseSource(source string) ([]parse.Stmt, error) {
+	tokens, scanErr := scanner.Create(source).ScanTokens()
+	if scanErr != nil {
+		return nil, scanErr
+	}
+	parser := parse.Create(tokens)
+	return parser.Parse()
+}
+
+// Every .glox file under root, in lexical order
+func Find(root string) ([]string, error) {
+	paths := []string{}
+	walkErr := filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !entry.IsDir() && filepath.Ext(path) == ".glox" {
+			paths = append(paths, path)
+		}
+		return nil
+	})
+	return paths, walkErr
+}
+
+// Runs source and compares what it did against its annotations. Each mismatch
+// comes back as one line, so an empty result means the script passed
+func Check(source string, backend Backend) []string {
+	expectations := Parse(source)
+	var stdout strings.Builder
+	echoes, runErr := backend(source, &stdout)
+
+	failures := []string{}
+	var runtimeErr *glox_error.RuntimeError
+	if errors.As(runErr, &runtimeErr) {
+		failures = append(failures, checkRuntimeError(expectations.RuntimeError, &runtimeErr.Diagnostic)...)
+	} else {
+		if expected := expectations.RuntimeError; expected != nil {
+			failures = append(failures, fmt.Sprintf("Expected runtime error '%s' on line %d and got none.", expected.Text, expected.Line))
+		}
+		failures = append(failures, checkErrors(expectations.Errors, runErr)...)
+	}
+	failures = append(failures, checkLines("output", expectations.Output, outputLines(stdout.String()))...)
+	// Files don't show echoes, so only scripts written for the REPL's behavior check them
+	if len(expectations.Echoes) > 0 {
+		failures = append(failures, checkLines("echo", expectations.Echoes, echoes)...)
+	}
+	return failures
+}
+
+func checkRuntimeError(expected *Expected, actual *Diagnostic) []string {
+	if expected == nil {
+		return []string{fmt.Sprintf("Unexpected runtime error: %s", actual)}
+	}
+	if actual.Message != expected.Text || actual.Line != expected.Line {
+		return []string{fmt.Sprintf("Expected runtime error '%s' on line %d and got: %s", expected.Text, expected.Line, actual)}
+	}
+	return nil
+}
+
+// Errors are matched in any order. An annotation's where only needs to start
+// the reported one, so "at 'x'" matches the parser's longer descriptions
+func checkErrors(expected []Expected, err error) []string {
+	failures := []string{}
+	actual := glox_error.Flatten(err)
+	isMatched := make([]bool, len(actual))
+	for _, want := range expected {
+		where, message := splitError(want.Text)
+		found := false
+		for index, got := range actual {
+			reportable, isReportable := got.(glox_error.Reportable)
+			if isMatched[index] || !isReportable {
+				continue
+			}
+			diagnostic := reportable.Details()
+			if diagnostic.Line == want.Line && diagnostic.Message == message && strings.HasPrefix(strings.TrimSpace(diagnostic.Where), where) {
+				isMatched[index], found = true, true
+				break
+			}
+		}
+		if !found {
+			failures = append(failures, fmt.Sprintf("Missing expected error: [line %d] %s", want.Line, want.Text))
+		}
+	}
+	for index, got := range actual {
+		if !isMatched[index] {
+			failures = append(failures, fmt.Sprintf("Unexpected error: %s", got))
+		}
+	}
+	return failures
+}
+
+func outputLines(stdout string) []string {
+	if stdout == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(stdout, "\n"), "\n")
+}
+
+// Compares lines in order, kind being what they are for the failure messages
+func checkLines(kind string, expected []Expected, lines []string) []string {
+	failures := []string{}
+	for index, line := range lines {
+		if index >= len(expected) {
+			failures = append(failures, fmt.Sprintf("Got %s '%s' when none was expected.", kind, line))
+			continue
+		}
+		if line != expected[index].Text {
+			failures = append(failures, fmt.Sprintf("Expected %s '%s' on line %d and got '%s'.", kind, expected[index].Text, expected[index].Line, line))
+		}
+	}
+	for _, missing := range expected[min(len(lines), len(expected)):] {
+		failures = append(failures, fmt.Sprintf("Missing expected %s '%s' on line %d.", kind, missing.Text, missing.Line))
+	}
+	return failures
+}
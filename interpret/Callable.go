@@ -0,0 +1,56 @@
+package interpret
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+type Callable interface {
+	Arity() int
+	Call(interpreter *Interpreter, arguments []any) (any, error)
+}
+
+// Go functions exposed to glox scripts as globals
+type NativeFunction struct {
+	name     string
+	arity    int
+	function func(interpreter *Interpreter, arguments []any) (any, error)
+}
+
+func (n *NativeFunction) Arity() int {
+	return n.arity
+}
+
+func (n *NativeFunction) Call(interpreter *Interpreter, arguments []any) (any, error) {
+	return n.function(interpreter, arguments)
+}
+
+func (n *NativeFunction) String() string {
+	return fmt.Sprintf("<native fn %s>", n.name)
+}
+
+var clock = &NativeFunction{
+	name:  "clock",
+	arity: 0,
+	function: func(interpreter *Interpreter, arguments []any) (any, error) {
+		return float64(time.Now().UnixMilli()) / 1000.0, nil
+	},
+}
+
+// Reads a line from the interpreter's input, or nil once the input is exhausted
+var readLine = &NativeFunction{
+	name:  "readLine",
+	arity: 0,
+	function: func(interpreter *Interpreter, arguments []any) (any, error) {
+		line, err := interpreter.input().ReadString('\n')
+		if err == io.EOF && line == "" {
+			return nil, nil
+		}
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		return strings.TrimRight(line, "\r\n"), nil
+	},
+}
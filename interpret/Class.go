@@ -0,0 +1,104 @@
+package interpret
+
+import (
+	glox_error "dsoechting/glox/error"
+	"fmt"
+)
+
+type Class struct {
+	name string
+	// Possibly nil
+	superclass *Class
+	methods    map[string]*Function
+}
+
+// Methods not found on the class are looked up the superclass chain
+func (c *Class) findMethod(name string) *Function {
+	method, isPresent := c.methods[name]
+	if isPresent {
+		return method
+	}
+	if c.superclass != nil {
+		return c.superclass.findMethod(name)
+	}
+	return nil
+}
+
+// Calling a class constructs a new instance, so its arity is the initializer's
+func (c *Class) Arity() int {
+	initializer := c.findMethod("init")
+	if initializer == nil {
+		return 0
+	}
+	return initializer.Arity()
+}
+
+func (c *Class) Call(interpreter *Interpreter, arguments []any) (any, error) {
+	instance := &Instance{
+		class:  c,
+		fields: make(map[string]any),
+	}
+	initializer := c.findMethod("init")
+	if initializer != nil {
+		_, initErr := initializer.Bind(instance).Call(interpreter, arguments)
+		if initErr != nil {
+			return nil, initErr
+		}
+	}
+	return instance, nil
+}
+
+func (c *Class) String() string {
+	return c.name
+}
+
+type Instance struct {
+	class  *Class
+	fields map[string]any
+}
+
+// Fields shadow methods of the same name
+func (i *Instance) Get(name Token) (any, error) {
+	value, isPresent := i.fields[name.Lexeme]
+	if isPresent {
+		return value, nil
+	}
+
+	method := i.class.findMethod(name.Lexeme)
+	if method != nil {
+		return method.Bind(i), nil
+	}
+
+	return nil, glox_error.CreateRuntimeError(glox_error.UNDEFINED_PROPERTY, name, fmt.Sprintf("Undefined property '%s'.", name.Lexeme))
+}
+
+func (i *Instance) Set(name Token, value any) {
+	i.fields[name.Lexeme] = value
+}
+
+// A copy of the instance's fields, for tools that inspect a running script
+func (i *Instance) Fields() map[string]any {
+	fields := make(map[string]any, len(i.fields))
+	for name, value := range i.fields {
+		fields[name] = value
+	}
+	return fields
+}
+
+// Field and method names, inherited methods included, for tools such as completion
+func (i *Instance) Members() []string {
+	members := []string{}
+	for name := range i.fields {
+		members = append(members, name)
+	}
+	for class := i.class; class != nil; class = class.superclass {
+		for name := range class.methods {
+			members = append(members, name)
+		}
+	}
+	return members
+}
+
+func (i *Instance) String() string {
+	return fmt.Sprintf("%s instance", i.class.name)
+}
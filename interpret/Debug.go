@@ -0,0 +1,122 @@
+package interpret
+
+// Lets tools such as debuggers watch a running script. The interpreter calls
+// BeforeStatement before it executes each statement, blocks included. An error
+// returned from it stops the script and is handed back from Interpret
+type Hook interface {
+	BeforeStatement(interpreter *Interpreter, stmt Stmt) error
+}
+
+// One active call, as a hook sees it
+type CallFrame struct {
+	Name string
+	// Line of the statement the frame is running
+	Line int
+	// Innermost scope of the frame, its enclosing ones hold the rest of its variables
+	Environment *Environment
+}
+
+// Installs the hook, or removes it when nil
+func (i *Interpreter) SetHook(hook Hook) {
+	i.hook = hook
+}
+
+// The active frames, innermost first. Only kept up to date while a hook is installed
+func (i *Interpreter) CallStack() []CallFrame {
+	stack := make([]CallFrame, len(i.frames))
+	for index, frame := range i.frames {
+		stack[len(i.frames)-1-index] = frame
+	}
+	return stack
+}
+
+// How many frames are active, the script's own included. Cheaper than CallStack
+// for hooks that run before every statement
+func (i *Interpreter) CallDepth() int {
+	return len(i.frames)
+}
+
+// The innermost frame, the script's own when no function is running
+func (i *Interpreter) CurrentFrame() CallFrame {
+	return i.frames[len(i.frames)-1]
+}
+
+// The scope the next statement runs in
+func (i *Interpreter) Environment() *Environment {
+	return i.environment
+}
+
+func (i *Interpreter) Globals() *Environment {
+	return i.globals
+}
+
+// Evaluates an unresolved expression, such as a debugger watch, as if it were
+// written where environment is in scope. Hooks are not called while it runs
+func (i *Interpreter) EvaluateIn(expr Expr, environment *Environment) (any, error) {
+	previous, previousHook, wasDynamic := i.environment, i.hook, i.isDynamic
+	i.environment, i.hook, i.isDynamic = environment, nil, true
+	defer func() {
+		i.environment, i.hook, i.isDynamic = previous, previousHook, wasDynamic
+	}()
+	return i.evaluate(expr)
+}
+
+// The line a statement starts on, or 0 for an empty block
+func StatementLine(stmt Stmt) int {
+	switch stmt := stmt.(type) {
+	case *BlockStmt:
+		if len(stmt.Statements) > 0 {
+			return StatementLine(stmt.Statements[0])
+		}
+	case *ClassStmt:
+		return stmt.Name.Line
+	case *ExpressionStmt:
+		return ExpressionLine(stmt.Expression)
+	case *FunctionStmt:
+		return stmt.Name.Line
+	case *IfStmt:
+		return stmt.Keyword.Line
+	case *PrintStmt:
+		return stmt.Keyword.Line
+	case *ReturnStmt:
+		return stmt.Keyword.Line
+	case *VarStmt:
+		return stmt.Name.Line
+	case *WhileStmt:
+		return stmt.Keyword.Line
+	}
+	return 0
+}
+
+// The line of the leftmost token in an expression
+func ExpressionLine(expr Expr) int {
+	switch expr := expr.(type) {
+	case *TernaryExpr:
+		return ExpressionLine(expr.First)
+	case *AssignExpr:
+		return expr.Name.Line
+	case *BinaryExpr:
+		return ExpressionLine(expr.Left)
+	case *CallExpr:
+		return ExpressionLine(expr.Callee)
+	case *GetExpr:
+		return ExpressionLine(expr.Object)
+	case *GroupingExpr:
+		return ExpressionLine(expr.Expression)
+	case *LiteralExpr:
+		return expr.Token.Line
+	case *LogicalExpr:
+		return ExpressionLine(expr.Left)
+	case *SetExpr:
+		return ExpressionLine(expr.Object)
+	case *SuperExpr:
+		return expr.Keyword.Line
+	case *ThisExpr:
+		return expr.Keyword.Line
+	case *UnaryExpr:
+		return expr.Operator.Line
+	case *VariableExpr:
+		return expr.Name.Line
+	}
+	return 0
+}
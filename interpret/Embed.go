@@ -0,0 +1,103 @@
+package interpret
+
+import (
+	"fmt"
+)
+
+// The signature of Go functions callable from glox. Arguments arrive as glox
+// values: float64, string, bool, nil, or one of the interpreter's own callables and instances
+type NativeFunc func(arguments []any) (any, error)
+
+// Formats a glox value the way print does
+func Stringify(value any) string {
+	return stringify(value)
+}
+
+// Registers a Go function as a global that scripts can call by name.
+// The result is converted with ToGlox, and a returned error becomes a glox
+// runtime error reported at the call site
+func (i *Interpreter) DefineNative(name string, arity int, function NativeFunc) {
+	native := &NativeFunction{
+		name:  name,
+		arity: arity,
+		function: func(interpreter *Interpreter, arguments []any) (any, error) {
+			result, err := function(arguments)
+			if err != nil {
+				return nil, err
+			}
+			return ToGlox(result)
+		},
+	}
+	i.globals.Define(name, native)
+}
+
+// Looks up a global defined by a script (or by DefineNative).
+// The second result is false if no global has that name
+func (i *Interpreter) Global(name string) (any, bool) {
+	return i.globals.Lookup(name)
+}
+
+// Reports whether a glox value can be passed to Call: functions, bound methods, classes, and natives
+func IsCallable(value any) bool {
+	_, isCallable := value.(Callable)
+	return isCallable
+}
+
+// Invokes a glox callable from Go. Arguments are converted with ToGlox, and the
+// result comes back as a glox value, so primitives are float64, string, bool, or nil
+func (i *Interpreter) Call(callee any, arguments ...any) (any, error) {
+	function, isCallable := callee.(Callable)
+	if !isCallable {
+		return nil, fmt.Errorf("Can only call functions and classes, got %v.", stringify(callee))
+	}
+	if len(arguments) != function.Arity() {
+		return nil, fmt.Errorf("Expected %d arguments but got %d.", function.Arity(), len(arguments))
+	}
+
+	converted := make([]any, len(arguments))
+	for index, argument := range arguments {
+		value, convertErr := ToGlox(argument)
+		if convertErr != nil {
+			return nil, convertErr
+		}
+		converted[index] = value
+	}
+	// Same limits and error handling as a call in a script, just without a call site
+	return i.call(function, converted, Token{})
+}
+
+// Converts a Go value into the glox value it corresponds to.
+// Every numeric type becomes a float64, since that is the only number glox has
+func ToGlox(value any) (any, error) {
+	switch v := value.(type) {
+	case nil:
+		return nil, nil
+	case bool, string, float64:
+		return v, nil
+	case float32:
+		return float64(v), nil
+	case int:
+		return float64(v), nil
+	case int8:
+		return float64(v), nil
+	case int16:
+		return float64(v), nil
+	case int32:
+		return float64(v), nil
+	case int64:
+		return float64(v), nil
+	case uint:
+		return float64(v), nil
+	case uint8:
+		return float64(v), nil
+	case uint16:
+		return float64(v), nil
+	case uint32:
+		return float64(v), nil
+	case uint64:
+		return float64(v), nil
+	case Callable, *Instance:
+		return v, nil
+	}
+	return nil, fmt.Errorf("Can't convert Go value of type %T to a glox value.", value)
+}
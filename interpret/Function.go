@@ -0,0 +1,75 @@
+package interpret
+
+import (
+	"dsoechting/glox/environment"
+	glox_error "dsoechting/glox/error"
+	"errors"
+	"fmt"
+)
+
+type Function struct {
+	declaration *FunctionStmt
+	// The scope the function was declared in, not the one it is called from
+	closure *Environment
+	// Initializers always hand back the instance, even on an early bare return
+	isInitializer bool
+}
+
+// Creates a copy of the method whose closure has "this" bound to the instance
+func (f *Function) Bind(instance *Instance) *Function {
+	env := environment.CreateWithEnclosing(f.closure)
+	env.Define("this", instance)
+	return &Function{
+		declaration:   f.declaration,
+		closure:       env,
+		isInitializer: f.isInitializer,
+	}
+}
+
+func (f *Function) Arity() int {
+	return len(f.declaration.Params)
+}
+
+func (f *Function) Call(interpreter *Interpreter, arguments []any) (any, error) {
+	env := environment.CreateWithEnclosing(f.closure)
+	for index, param := range f.declaration.Params {
+		env.Define(param.Lexeme, arguments[index])
+	}
+
+	interpreter.frames = append(interpreter.frames, CallFrame{Name: f.declaration.Name.Lexeme, Environment: env})
+	defer func() {
+		interpreter.frames = interpreter.frames[:len(interpreter.frames)-1]
+	}()
+
+	_, err := interpreter.executeBlock(f.declaration.Body, env)
+	if err != nil {
+		var returnValue *Return
+		if errors.As(err, &returnValue) {
+			if f.isInitializer {
+				return f.closure.GetAt(0, "this"), nil
+			}
+			return returnValue.Value, nil
+		}
+		return nil, err
+	}
+	if f.isInitializer {
+		return f.closure.GetAt(0, "this"), nil
+	}
+	return nil, nil
+}
+
+func (f *Function) String() string {
+	return fmt.Sprintf("<fn %s>", f.declaration.Name.Lexeme)
+}
+
+// Return unwinds the interpreter back to the enclosing call, carrying the returned value.
+// It travels through the error path, but it is not a real error
+type Return struct {
+	Keyword Token
+	Value   any
+}
+
+func (r *Return) Error() string {
+	diagnostic := glox_error.CreateAt(glox_error.TOP_LEVEL_RETURN, r.Keyword, "at 'return'", "Can't return from top-level code.")
+	return diagnostic.Error()
+}
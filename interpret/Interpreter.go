@@ -1,6 +1,7 @@
 package interpret
 
 import (
+	"bufio"
 	"dsoechting/glox/ast"
 	"dsoechting/glox/environment"
 	glox_error "dsoechting/glox/error"
@@ -8,7 +9,6 @@ import (
 	"errors"
 	"fmt"
 	"strconv"
-	"strings"
 )
 
 type Environment = environment.Environment
@@ -19,49 +19,178 @@ type PrintStmt = ast.PrintStmt
 type WhileStmt = ast.WhileStmt
 type VarStmt = ast.VarStmt
 type BlockStmt = ast.BlockStmt
+type ClassStmt = ast.ClassStmt
+type FunctionStmt = ast.FunctionStmt
+type ReturnStmt = ast.ReturnStmt
 type Expr = ast.Expr
 type TernaryExpr = ast.TernaryExpr
+type AssignExpr = ast.AssignExpr
 type BinaryExpr = ast.BinaryExpr
+type CallExpr = ast.CallExpr
+type GetExpr = ast.GetExpr
+type SetExpr = ast.SetExpr
+type SuperExpr = ast.SuperExpr
+type ThisExpr = ast.ThisExpr
 type LogicalExpr = ast.LogicalExpr
 type UnaryExpr = ast.UnaryExpr
 type VariableExpr = ast.VariableExpr
 type GroupingExpr = ast.GroupingExpr
 type LiteralExpr = ast.LiteralExpr
 type Token = token.Token
-type GloxError = glox_error.GloxError
+type RuntimeError = glox_error.RuntimeError
 
 // Implements ExprVisitor and StmtVisitor
 type Interpreter struct {
-	environment Environment
+	globals     *Environment
+	environment *Environment
+	// How many scopes out each local variable expression resolved to
+	locals  map[Expr]int
+	options Options
+	stdin   *bufio.Reader
+	// Possibly nil, told about every statement before it runs
+	hook Hook
+	// The script and every glox function running in it, outermost first
+	frames []CallFrame
+	// Set while evaluating an expression the resolver never saw, which looks
+	// its variables up through the scope chain instead
+	isDynamic bool
 }
 
 func Create() Interpreter {
-	env := environment.Create()
+	return CreateWithOptions(Options{})
+}
+
+func CreateWithOptions(options Options) Interpreter {
+	globals := environment.Create()
+	globals.Define("clock", clock)
+	globals.Define("readLine", readLine)
 	return Interpreter{
-		environment: env,
+		globals:     globals,
+		environment: globals,
+		locals:      make(map[Expr]int),
+		options:     options.withDefaults(),
+		frames:      []CallFrame{{Name: glox_error.SCRIPT_FRAME, Environment: globals}},
 	}
 }
 
-func (i *Interpreter) Interpret(statements []Stmt) (string, error) {
-	var sb strings.Builder
+// Called by the resolver for every local variable it binds
+func (i *Interpreter) Resolve(expr Expr, depth int) {
+	i.locals[expr] = depth
+}
+
+// What running a statement leaves for the REPL to echo. Only bare expression
+// statements have a value, so an empty string and nothing at all can't be mixed up
+type result struct {
+	value    any
+	hasValue bool
+}
+
+var noResult = result{}
+
+// Runs the statements, returning the values of the top level expression
+// statements for a REPL to echo, like the bytecode VM. Format them with Stringify
+func (i *Interpreter) Interpret(statements []Stmt) ([]any, error) {
+	values := []any{}
 
 	for _, statement := range statements {
 		value, err := i.execute(statement)
 		if err != nil {
-			return "", err
+			var runtimeErr *RuntimeError
+			if errors.As(err, &runtimeErr) {
+				runtimeErr.AddFrame(glox_error.SCRIPT_FRAME, 0)
+			}
+			return nil, err
 		}
-		// Do no add new line for empty values
-		if value != "" {
-			sb.WriteString(fmt.Sprintf("%v\n", value))
+		if statementResult, _ := value.(result); statementResult.hasValue {
+			values = append(values, statementResult.value)
 		}
 	}
-	// This is going to break my tests :)
-	// Maybe we will modify this later, to make things easier to test
-	return sb.String(), nil
+	return values, nil
 }
 
 func (i *Interpreter) VisitExpression(stmt *ExpressionStmt) (any, error) {
-	return i.evaluate(stmt.Expression)
+	value, err := i.evaluate(stmt.Expression)
+	if err != nil {
+		return nil, err
+	}
+	// Assignments are run for their effect, so like the VM they aren't echoed
+	switch stmt.Expression.(type) {
+	case *ast.AssignExpr, *ast.SetExpr:
+		return noResult, nil
+	}
+	return result{value: value, hasValue: true}, nil
+}
+
+func (i *Interpreter) VisitClass(stmt *ClassStmt) (any, error) {
+	var superclass *Class
+	if stmt.Superclass != nil {
+		value, superErr := i.evaluate(stmt.Superclass)
+		if superErr != nil {
+			return nil, superErr
+		}
+		var isClass bool
+		superclass, isClass = value.(*Class)
+		if !isClass {
+			return nil, glox_error.CreateRuntimeError(glox_error.SUPERCLASS_NOT_CLASS, stmt.Superclass.Name, "Superclass must be a class.")
+		}
+	}
+
+	i.environment.Define(stmt.Name.Lexeme, nil)
+
+	// Methods of a subclass close over an extra scope holding "super"
+	if superclass != nil {
+		i.environment = environment.CreateWithEnclosing(i.environment)
+		i.environment.Define("super", superclass)
+	}
+
+	methods := make(map[string]*Function)
+	for _, method := range stmt.Methods {
+		methods[method.Name.Lexeme] = &Function{
+			declaration:   method,
+			closure:       i.environment,
+			isInitializer: method.Name.Lexeme == "init",
+		}
+	}
+
+	class := &Class{
+		name:       stmt.Name.Lexeme,
+		superclass: superclass,
+		methods:    methods,
+	}
+
+	if superclass != nil {
+		i.environment = i.environment.Enclosing()
+	}
+
+	assignErr := i.environment.Assign(stmt.Name, class)
+	if assignErr != nil {
+		return nil, assignErr
+	}
+	return noResult, nil
+}
+
+func (i *Interpreter) VisitFunction(stmt *FunctionStmt) (any, error) {
+	function := &Function{
+		declaration: stmt,
+		closure:     i.environment,
+	}
+	i.environment.Define(stmt.Name.Lexeme, function)
+	return noResult, nil
+}
+
+func (i *Interpreter) VisitReturn(stmt *ReturnStmt) (any, error) {
+	var value any
+	if stmt.Value != nil {
+		var err error
+		value, err = i.evaluate(stmt.Value)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return nil, &Return{
+		Keyword: stmt.Keyword,
+		Value:   value,
+	}
 }
 
 func (i *Interpreter) VisitPrint(stmt *PrintStmt) (any, error) {
@@ -69,9 +198,8 @@ func (i *Interpreter) VisitPrint(stmt *PrintStmt) (any, error) {
 	if err != nil {
 		return nil, err
 	}
-	fmt.Println(stringify(value))
-	//Don't print in REPL
-	return "", nil
+	fmt.Fprintln(i.Options().Stdout, stringify(value))
+	return noResult, nil
 }
 
 func (i *Interpreter) VisitWhile(stmt *WhileStmt) (any, error) {
@@ -91,7 +219,7 @@ func (i *Interpreter) VisitWhile(stmt *WhileStmt) (any, error) {
 			return nil, condErr
 		}
 	}
-	return "", nil
+	return noResult, nil
 }
 
 func (i *Interpreter) VisitIf(stmt *IfStmt) (any, error) {
@@ -99,12 +227,14 @@ func (i *Interpreter) VisitIf(stmt *IfStmt) (any, error) {
 	if condErr != nil {
 		return nil, condErr
 	}
+	var branchErr error
 	if isTruthy(cond) {
-		return i.execute(stmt.ThenBranch)
+		_, branchErr = i.execute(stmt.ThenBranch)
 	} else if stmt.ElseBranch != nil {
-		return i.execute(stmt.ElseBranch)
+		_, branchErr = i.execute(stmt.ElseBranch)
 	}
-	return "", nil
+	// Only statements written directly in the script are echoed, not branches
+	return noResult, branchErr
 }
 
 func (i *Interpreter) VisitVar(stmt *VarStmt) (any, error) {
@@ -117,8 +247,7 @@ func (i *Interpreter) VisitVar(stmt *VarStmt) (any, error) {
 		}
 	}
 	i.environment.Define(stmt.Name.Lexeme, value)
-	// Don't print in REPL
-	return "", nil
+	return noResult, nil
 }
 
 func (i *Interpreter) VisitTernary(expr *TernaryExpr) (any, error) {
@@ -209,11 +338,126 @@ func (i *Interpreter) VisitBinary(expr *BinaryExpr) (any, error) {
 		if isLeftFloat && isRightFloat {
 			return leftFloat + rightFloat, nil
 		}
-		return nil, createInterpreterError(expr.Operator, "Operands must be two numbers or string", left, right)
+		return nil, createInterpreterError(expr.Operator, glox_error.OPERANDS_MUST_BE_ADDABLE)
 	}
 	return nil, fmt.Errorf("Unsupporter binary operator %s\n", expr.Operator.TokenType)
 }
 
+func (i *Interpreter) VisitCall(expr *CallExpr) (any, error) {
+	callee, calleeErr := i.evaluate(expr.Callee)
+	if calleeErr != nil {
+		return nil, calleeErr
+	}
+
+	arguments := []any{}
+	for _, argument := range expr.Arguments {
+		value, argumentErr := i.evaluate(argument)
+		if argumentErr != nil {
+			return nil, argumentErr
+		}
+		arguments = append(arguments, value)
+	}
+
+	function, isCallable := callee.(Callable)
+	if !isCallable {
+		return nil, glox_error.CreateRuntimeError(glox_error.NOT_CALLABLE, expr.Paren, "Can only call functions and classes.")
+	}
+
+	if len(arguments) != function.Arity() {
+		return nil, glox_error.CreateRuntimeError(glox_error.WRONG_ARGUMENT_COUNT, expr.Paren, fmt.Sprintf("Expected %d arguments but got %d.", function.Arity(), len(arguments)))
+	}
+
+	return i.call(function, arguments, expr.Paren)
+}
+
+// Every call, from a script or from Go, goes through here. paren is the call
+// site, the zero Token when there isn't one in the script
+func (i *Interpreter) call(function Callable, arguments []any, paren Token) (any, error) {
+	result, callErr := function.Call(i, arguments)
+	if callErr == nil {
+		return result, nil
+	}
+
+	var reportable glox_error.Reportable
+	if _, isNative := function.(*NativeFunction); isNative && !errors.As(callErr, &reportable) {
+		// Host errors know nothing about the script, so point them at the call
+		diagnostic := glox_error.Wrap(glox_error.NATIVE_FAILURE, paren.Line, "", callErr)
+		diagnostic.Span = glox_error.SpanOf(paren)
+		return nil, &RuntimeError{Diagnostic: diagnostic}
+	}
+	var runtimeErr *RuntimeError
+	if errors.As(callErr, &runtimeErr) {
+		runtimeErr.AddFrame(callableName(function), paren.Line)
+	}
+	return nil, callErr
+}
+
+// How a callable is named in stack traces
+func callableName(function Callable) string {
+	switch callable := function.(type) {
+	case *Function:
+		return callable.declaration.Name.Lexeme
+	case *Class:
+		return callable.name
+	case *NativeFunction:
+		return callable.name
+	}
+	return fmt.Sprintf("%v", function)
+}
+
+func (i *Interpreter) VisitGet(expr *GetExpr) (any, error) {
+	object, objectErr := i.evaluate(expr.Object)
+	if objectErr != nil {
+		return nil, objectErr
+	}
+
+	instance, isInstance := object.(*Instance)
+	if !isInstance {
+		return nil, glox_error.CreateRuntimeError(glox_error.NOT_AN_INSTANCE, expr.Name, "Only instances have properties.")
+	}
+	return instance.Get(expr.Name)
+}
+
+func (i *Interpreter) VisitSet(expr *SetExpr) (any, error) {
+	object, objectErr := i.evaluate(expr.Object)
+	if objectErr != nil {
+		return nil, objectErr
+	}
+
+	instance, isInstance := object.(*Instance)
+	if !isInstance {
+		return nil, glox_error.CreateRuntimeError(glox_error.NOT_AN_INSTANCE, expr.Name, "Only instances have fields.")
+	}
+
+	value, valueErr := i.evaluate(expr.Value)
+	if valueErr != nil {
+		return nil, valueErr
+	}
+	instance.Set(expr.Name, value)
+	return value, nil
+}
+
+func (i *Interpreter) VisitSuper(expr *SuperExpr) (any, error) {
+	distance, isLocal := i.locals[expr]
+	if !isLocal {
+		// The resolver places every super in a script, so only watch expressions get here
+		return nil, glox_error.CreateRuntimeError(glox_error.SUPER_OUTSIDE_CLASS, expr.Keyword, "Can't use 'super' outside of a method body.")
+	}
+	superclass := i.environment.GetAt(distance, "super").(*Class)
+	// "this" always lives in the scope just inside the one holding "super"
+	object := i.environment.GetAt(distance-1, "this").(*Instance)
+
+	method := superclass.findMethod(expr.Method.Lexeme)
+	if method == nil {
+		return nil, glox_error.CreateRuntimeError(glox_error.UNDEFINED_PROPERTY, expr.Method, fmt.Sprintf("Undefined property '%s'.", expr.Method.Lexeme))
+	}
+	return method.Bind(object), nil
+}
+
+func (i *Interpreter) VisitThis(expr *ThisExpr) (any, error) {
+	return i.lookUpVariable(expr.Keyword, expr)
+}
+
 func (i *Interpreter) VisitGrouping(expr *GroupingExpr) (any, error) {
 	return i.evaluate(expr.Expression)
 }
@@ -267,7 +511,18 @@ func (i *Interpreter) VisitUnary(expr *UnaryExpr) (any, error) {
 }
 
 func (i *Interpreter) VisitVariable(expr *VariableExpr) (any, error) {
-	return i.environment.Get(expr.Name)
+	return i.lookUpVariable(expr.Name, expr)
+}
+
+func (i *Interpreter) lookUpVariable(name Token, expr Expr) (any, error) {
+	distance, isLocal := i.locals[expr]
+	if isLocal {
+		return i.environment.GetAt(distance, name.Lexeme), nil
+	}
+	if i.isDynamic {
+		return i.environment.Get(name)
+	}
+	return i.globals.Get(name)
 }
 
 func (i *Interpreter) VisitAssign(expr *ast.AssignExpr) (any, error) {
@@ -276,13 +531,21 @@ func (i *Interpreter) VisitAssign(expr *ast.AssignExpr) (any, error) {
 		return nil, err
 	}
 
-	assignErr := i.environment.Assign(expr.Name, value)
-	if assignErr != nil {
-		return nil, assignErr
+	distance, isLocal := i.locals[expr]
+	if isLocal {
+		i.environment.AssignAt(distance, expr.Name, value)
+	} else if i.isDynamic {
+		assignErr := i.environment.Assign(expr.Name, value)
+		if assignErr != nil {
+			return nil, assignErr
+		}
+	} else {
+		assignErr := i.globals.Assign(expr.Name, value)
+		if assignErr != nil {
+			return nil, assignErr
+		}
 	}
-
-	// Don't want my REPL to print assignments
-	return "", nil
+	return value, nil
 }
 
 func (i *Interpreter) evaluate(expr Expr) (any, error) {
@@ -290,6 +553,14 @@ func (i *Interpreter) evaluate(expr Expr) (any, error) {
 }
 
 func (i *Interpreter) execute(stmt Stmt) (any, error) {
+	if i.hook != nil {
+		frame := &i.frames[len(i.frames)-1]
+		frame.Line = StatementLine(stmt)
+		frame.Environment = i.environment
+		if hookErr := i.hook.BeforeStatement(i, stmt); hookErr != nil {
+			return nil, hookErr
+		}
+	}
 	return stmt.Accept(i)
 }
 
@@ -298,7 +569,7 @@ func (i *Interpreter) VisitBlock(stmt *BlockStmt) (any, error) {
 	return i.executeBlock(stmt.Statements, blockEnv)
 }
 
-func (i *Interpreter) executeBlock(statements []Stmt, blockEnv Environment) (any, error) {
+func (i *Interpreter) executeBlock(statements []Stmt, blockEnv *Environment) (any, error) {
 	previous := i.environment
 
 	i.environment = blockEnv
@@ -307,16 +578,14 @@ func (i *Interpreter) executeBlock(statements []Stmt, blockEnv Environment) (any
 		i.environment = previous
 	}()
 
-	var sb strings.Builder
 	for _, stmt := range statements {
-		value, executeErr := i.execute(stmt)
+		_, executeErr := i.execute(stmt)
 		if executeErr != nil {
 			return nil, executeErr
 		}
-		sb.WriteString(fmt.Sprintf("%v\n", value))
 	}
-
-	return sb.String(), nil
+	// Nothing inside a block is echoed, matching the VM
+	return noResult, nil
 }
 
 func isTruthy(value any) bool {
@@ -346,7 +615,7 @@ func checkNumberOpernad(operator Token, operand any) error {
 	if isFloat {
 		return nil
 	}
-	return createInterpreterError(operator, "Operand must be a number", operand)
+	return createInterpreterError(operator, glox_error.OPERAND_MUST_BE_NUMBER)
 }
 
 func checkNumberOperands(operator Token, left any, right any) error {
@@ -356,11 +625,12 @@ func checkNumberOperands(operator Token, left any, right any) error {
 		return nil
 	}
 
-	return createInterpreterError(operator, "Operands must be numbers", left, right)
+	return createInterpreterError(operator, glox_error.OPERANDS_MUST_BE_NUMBERS)
 }
 
-func createInterpreterError(operator Token, message string, operands ...any) *GloxError {
-	return glox_error.Create(operator.Line, fmt.Sprintf("%s on %s", operands, operator.Lexeme), message)
+func createInterpreterError(operator Token, message string) *RuntimeError {
+	where := fmt.Sprintf(" at '%s'", operator.Lexeme)
+	return &RuntimeError{Diagnostic: glox_error.CreateAt(glox_error.INVALID_OPERAND, operator, where, message)}
 }
 
 func stringify(object any) string {
@@ -0,0 +1,53 @@
+package interpret
+
+import (
+	"bufio"
+	"io"
+	"os"
+)
+
+// Where a script's output goes and its input comes from.
+// Nil fields fall back to the process's standard streams
+type Options struct {
+	// Receives everything a script prints
+	Stdout io.Writer
+	// Receives diagnostics, such as scan, parse, and runtime errors
+	Stderr io.Writer
+	// Read by the readLine native
+	Stdin io.Reader
+}
+
+func (o Options) withDefaults() Options {
+	if o.Stdout == nil {
+		o.Stdout = os.Stdout
+	}
+	if o.Stderr == nil {
+		o.Stderr = os.Stderr
+	}
+	if o.Stdin == nil {
+		o.Stdin = os.Stdin
+	}
+	return o
+}
+
+func (i *Interpreter) Options() Options {
+	return i.options.withDefaults()
+}
+
+// Buffered lazily, so a zero value Interpreter still has somewhere to read from
+func (i *Interpreter) input() *bufio.Reader {
+	if i.stdin == nil {
+		i.stdin = bufferInput(i.Options().Stdin)
+	}
+	return i.stdin
+}
+
+// A host that reads the same stream as the script, like a REPL, should pass in a
+// *bufio.Reader and read through it too, so input isn't split between two buffers
+func bufferInput(stdin io.Reader) *bufio.Reader {
+	buffered, isBuffered := stdin.(*bufio.Reader)
+	if isBuffered {
+		return buffered
+	}
+	return bufio.NewReader(stdin)
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"dsoechting/glox/lint"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// glox lint script ...
+// Reports likely mistakes that still parse, exiting with 1 when any are found
+func (g *Glox) lint(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(g.options.Stderr, "Usage glox lint script ...")
+		return 64
+	}
+
+	exitCode := 0
+	for _, path := range args {
+		data, readErr := os.ReadFile(path)
+		if readErr != nil {
+			fmt.Fprintln(g.options.Stderr, readErr)
+			exitCode = 66
+			continue
+		}
+		g.file, g.source = path, string(data)
+		findings, parseErr := lint.Source(g.source, lint.DefaultRules())
+		if parseErr != nil {
+			g.report(parseErr)
+			exitCode = 65
+			continue
+		}
+		if len(findings) > 0 {
+			g.report(errors.Join(findings...))
+			if exitCode == 0 {
+				exitCode = 1
+			}
+		}
+	}
+	return exitCode
+}
@@ -0,0 +1,142 @@
+package lint
+
+import (
+	"dsoechting/glox/ast"
+	glox_error "dsoechting/glox/error"
+	"dsoechting/glox/parse"
+	"dsoechting/glox/scanner"
+	"dsoechting/glox/scope"
+	"dsoechting/glox/token"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+type Token = token.Token
+type Stmt = ast.Stmt
+type Expr = ast.Expr
+type LintError = glox_error.LintError
+
+// Comments starting with this turn rules off for the whole file, as in
+// "// lint:disable unused-variable, shadowing". With no rules named, every rule is off
+const DIRECTIVE = "lint:disable"
+
+// A check over a whole script
+type Rule interface {
+	// Names the rule in findings and in lint:disable directives, like "unused-variable"
+	ID() string
+	Code() glox_error.Code
+	Check(file *File) []*LintError
+}
+
+// Everything a rule gets to look at for one script
+type File struct {
+	Tokens     []Token
+	Statements []Stmt
+	Analysis   *scope.Analysis
+}
+
+func DefaultRules() []Rule {
+	return []Rule{
+		UnusedVariable{},
+		Shadowing{},
+		UnreachableCode{},
+		ConstantCondition{},
+		SelfAssignment{},
+		InvalidComparison{},
+	}
+}
+
+type Linter struct {
+	rules []Rule
+}
+
+func Create(rules []Rule) *Linter {
+	return &Linter{rules: rules}
+}
+
+// Scans, parses and lints a script. Syntax errors come back as the error,
+// since the rules need a whole tree to look at
+func Source(source string, rules []Rule) ([]error, error) {
+	tokens, scanErr := scanner.Create(source).ScanTokens()
+	if scanErr != nil {
+		return nil, scanErr
+	}
+	parser := parse.Create(tokens)
+	statements, parseErr := parser.Parse()
+	if parseErr != nil {
+		return nil, parseErr
+	}
+	file := &File{
+		Tokens:     tokens,
+		Statements: statements,
+		Analysis:   scope.Create(tokens).Analyze(statements),
+	}
+	return Create(rules).Lint(file), nil
+}
+
+// Runs every rule the file hasn't disabled. Findings are sorted by position
+func (l *Linter) Lint(file *File) []error {
+	disabled, findings := l.directives(file.Tokens)
+	for _, rule := range l.rules {
+		if disabled[rule.ID()] || disabled[""] {
+			continue
+		}
+		for _, finding := range rule.Check(file) {
+			findings = append(findings, finding)
+		}
+	}
+	sort.SliceStable(findings, func(i, j int) bool {
+		left, right := findings[i].(*LintError), findings[j].(*LintError)
+		if left.Line != right.Line {
+			return left.Line < right.Line
+		}
+		return left.Span.Start < right.Span.Start
+	})
+	return findings
+}
+
+// Collects the rules the file's directives turn off, keyed by ID. "" stands
+// for every rule. Naming a rule that doesn't exist is a finding of its own
+func (l *Linter) directives(tokens []Token) (map[string]bool, []error) {
+	known := map[string]bool{}
+	for _, rule := range l.rules {
+		known[rule.ID()] = true
+	}
+	disabled := map[string]bool{}
+	findings := []error{}
+	for _, tok := range tokens {
+		for _, comment := range tok.Comments {
+			text := strings.TrimPrefix(strings.TrimPrefix(comment.Text, "//"), "/*")
+			text = strings.TrimSpace(strings.TrimSuffix(text, "*/"))
+			rest, isDirective := strings.CutPrefix(text, DIRECTIVE)
+			if !isDirective || (rest != "" && rest[0] != ' ' && rest[0] != '\t') {
+				continue
+			}
+			ids := strings.FieldsFunc(rest, func(char rune) bool {
+				return char == ',' || char == ' ' || char == '\t'
+			})
+			if len(ids) == 0 {
+				disabled[""] = true
+			}
+			for _, id := range ids {
+				if known[id] {
+					disabled[id] = true
+					continue
+				}
+				diagnostic := glox_error.Create(glox_error.UNKNOWN_LINT_RULE, comment.Line, "", fmt.Sprintf("Unknown lint rule '%s'.", id))
+				diagnostic.Severity = glox_error.WARNING
+				findings = append(findings, &LintError{Diagnostic: diagnostic})
+			}
+		}
+	}
+	return disabled, findings
+}
+
+// A warning from rule at tok. The rule's ID goes on the end of the message, so
+// whoever reads it knows what to disable
+func warn(rule Rule, tok Token, message string) *LintError {
+	diagnostic := glox_error.CreateAt(rule.Code(), tok, fmt.Sprintf("at '%s'", tok.Lexeme), fmt.Sprintf("%s (%s)", message, rule.ID()))
+	diagnostic.Severity = glox_error.WARNING
+	return &LintError{Diagnostic: diagnostic}
+}
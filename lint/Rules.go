@@ -0,0 +1,248 @@
+package lint
+
+import (
+	"dsoechting/glox/ast"
+	glox_error "dsoechting/glox/error"
+	"dsoechting/glox/scope"
+	"dsoechting/glox/token"
+	"fmt"
+	"strings"
+)
+
+// Local variables that are declared but never read. Names starting with '_' are left alone
+type UnusedVariable struct{}
+
+func (UnusedVariable) ID() string            { return "unused-variable" }
+func (UnusedVariable) Code() glox_error.Code { return glox_error.UNUSED_VARIABLE }
+
+func (r UnusedVariable) Check(file *File) []*LintError {
+	reads := map[*scope.Symbol]int{}
+	for _, occurrence := range file.Analysis.Occurrences {
+		if !occurrence.IsDeclaration && !occurrence.IsAssignment {
+			reads[occurrence.Symbol]++
+		}
+	}
+	findings := []*LintError{}
+	for _, symbol := range file.Analysis.All {
+		// Globals might be read by whatever runs next, like the REPL's next line
+		if symbol.Kind != scope.VARIABLE || symbol.Depth == 0 || reads[symbol] > 0 || strings.HasPrefix(symbol.Name, "_") {
+			continue
+		}
+		findings = append(findings, warn(r, symbol.Declaration, fmt.Sprintf("Local variable '%s' is never used.", symbol.Name)))
+	}
+	return findings
+}
+
+// Declarations that hide one of the same name from an enclosing scope
+type Shadowing struct{}
+
+func (Shadowing) ID() string            { return "shadowing" }
+func (Shadowing) Code() glox_error.Code { return glox_error.SHADOWED_VARIABLE }
+
+func (r Shadowing) Check(file *File) []*LintError {
+	findings := []*LintError{}
+	for _, symbol := range file.Analysis.All {
+		outer := symbol.Shadows
+		if outer == nil {
+			continue
+		}
+		message := fmt.Sprintf("'%s' shadows the builtin '%s'.", symbol.Name, outer.Name)
+		if outer.IsDeclared() {
+			message = fmt.Sprintf("'%s' shadows the %s declared on line %d.", symbol.Name, kindName(outer.Kind), outer.Declaration.Line)
+		}
+		findings = append(findings, warn(r, symbol.Declaration, message))
+	}
+	return findings
+}
+
+func kindName(kind scope.SymbolKind) string {
+	switch kind {
+	case scope.PARAMETER:
+		return "parameter"
+	case scope.FUNCTION:
+		return "function"
+	case scope.CLASS:
+		return "class"
+	}
+	return "variable"
+}
+
+// Statements that follow a return, directly or through an if whose branches both return
+type UnreachableCode struct{}
+
+func (UnreachableCode) ID() string            { return "unreachable-code" }
+func (UnreachableCode) Code() glox_error.Code { return glox_error.UNREACHABLE_CODE }
+
+func (r UnreachableCode) Check(file *File) []*LintError {
+	findings := []*LintError{}
+	check := func(statements []Stmt) {
+		for index := 0; index+1 < len(statements); index++ {
+			if !terminates(statements[index]) {
+				continue
+			}
+			if unreachable, hasToken := stmtToken(statements[index+1]); hasToken {
+				findings = append(findings, warn(r, unreachable, "Unreachable code after return."))
+			}
+			return
+		}
+	}
+
+	// The parser appends a for loop's increment to its body in a block of its
+	// own, and that increment isn't unreachable even when the body returns
+	desugared := map[*ast.BlockStmt]bool{}
+	check(file.Statements)
+	inspect(file.Statements, func(node any) bool {
+		switch node := node.(type) {
+		case *ast.WhileStmt:
+			if body, isBlock := node.Body.(*ast.BlockStmt); isBlock && node.Keyword.TokenType == token.FOR && len(body.Statements) == 2 {
+				if _, isIncrement := body.Statements[1].(*ast.ExpressionStmt); isIncrement {
+					desugared[body] = true
+				}
+			}
+		case *ast.BlockStmt:
+			if !desugared[node] {
+				check(node.Statements)
+			}
+		case *ast.FunctionStmt:
+			check(node.Body)
+		}
+		return true
+	})
+	return findings
+}
+
+// Reports whether control never gets past stmt
+func terminates(stmt Stmt) bool {
+	switch stmt := stmt.(type) {
+	case *ast.ReturnStmt:
+		return true
+	case *ast.BlockStmt:
+		for _, inner := range stmt.Statements {
+			if terminates(inner) {
+				return true
+			}
+		}
+	case *ast.IfStmt:
+		return stmt.ElseBranch != nil && terminates(stmt.ThenBranch) && terminates(stmt.ElseBranch)
+	}
+	return false
+}
+
+// if and while conditions that can be worked out without running anything.
+// while (true) is left alone, it's how a loop that exits by returning is written
+type ConstantCondition struct{}
+
+func (ConstantCondition) ID() string            { return "constant-condition" }
+func (ConstantCondition) Code() glox_error.Code { return glox_error.CONSTANT_CONDITION }
+
+func (r ConstantCondition) Check(file *File) []*LintError {
+	findings := []*LintError{}
+	report := func(condition Expr) {
+		value, isConstant := constant(condition)
+		if isConstant {
+			findings = append(findings, warn(r, exprToken(condition), fmt.Sprintf("Condition is always %t.", isTruthy(value))))
+		}
+	}
+	inspect(file.Statements, func(node any) bool {
+		switch node := node.(type) {
+		case *ast.IfStmt:
+			report(node.Condition)
+		case *ast.WhileStmt:
+			literal, isLiteral := node.Condition.(*ast.LiteralExpr)
+			if isLiteral && (literal.Value == true || literal.Token.TokenType == token.FOR) {
+				// Either written as while (true), or the parser filled in a for loop's missing condition
+				return true
+			}
+			report(node.Condition)
+		}
+		return true
+	})
+	return findings
+}
+
+// Assignments of a variable or field to itself, like a = a or this.x = this.x
+type SelfAssignment struct{}
+
+func (SelfAssignment) ID() string            { return "self-assignment" }
+func (SelfAssignment) Code() glox_error.Code { return glox_error.SELF_ASSIGNMENT }
+
+func (r SelfAssignment) Check(file *File) []*LintError {
+	findings := []*LintError{}
+	inspect(file.Statements, func(node any) bool {
+		switch node := node.(type) {
+		case *ast.AssignExpr:
+			value, isVariable := unparenthesize(node.Value).(*ast.VariableExpr)
+			if isVariable && value.Name.Lexeme == node.Name.Lexeme {
+				findings = append(findings, warn(r, node.Name, fmt.Sprintf("'%s' is assigned to itself.", node.Name.Lexeme)))
+			}
+		case *ast.SetExpr:
+			value, isGet := unparenthesize(node.Value).(*ast.GetExpr)
+			object, isSimple := objectName(node.Object)
+			valueObject, isValueSimple := "", false
+			if isGet {
+				valueObject, isValueSimple = objectName(value.Object)
+			}
+			if isGet && isSimple && isValueSimple && object == valueObject && value.Name.Lexeme == node.Name.Lexeme {
+				findings = append(findings, warn(r, node.Name, fmt.Sprintf("'%s.%s' is assigned to itself.", object, node.Name.Lexeme)))
+			}
+		}
+		return true
+	})
+	return findings
+}
+
+// Names this or a variable, which are the same object each time they're evaluated
+func objectName(expr Expr) (string, bool) {
+	switch expr := unparenthesize(expr).(type) {
+	case *ast.ThisExpr:
+		return "this", true
+	case *ast.VariableExpr:
+		return expr.Name.Lexeme, true
+	}
+	return "", false
+}
+
+// Ordering comparisons with an operand that is certainly not a number, which
+// the interpreter rejects at runtime, like "a" > 1
+type InvalidComparison struct{}
+
+func (InvalidComparison) ID() string            { return "invalid-comparison" }
+func (InvalidComparison) Code() glox_error.Code { return glox_error.INVALID_COMPARISON }
+
+func (r InvalidComparison) Check(file *File) []*LintError {
+	findings := []*LintError{}
+	inspect(file.Statements, func(node any) bool {
+		binary, isBinary := node.(*ast.BinaryExpr)
+		if !isBinary {
+			return true
+		}
+		switch binary.Operator.TokenType {
+		case token.GREATER, token.GREATER_EQUAL, token.LESS, token.LESS_EQUAL:
+		default:
+			return true
+		}
+		left, right := staticType(binary.Left), staticType(binary.Right)
+		if isNumberOrUnknown(left) && isNumberOrUnknown(right) {
+			return true
+		}
+		message := fmt.Sprintf("Comparing %s with %s using '%s' always fails at runtime, only numbers can be ordered.",
+			describeType(left), describeType(right), binary.Operator.Lexeme)
+		findings = append(findings, warn(r, binary.Operator, message))
+		return true
+	})
+	return findings
+}
+
+func isNumberOrUnknown(valueType string) bool {
+	return valueType == NUMBER_TYPE || valueType == UNKNOWN_TYPE
+}
+
+func describeType(valueType string) string {
+	switch valueType {
+	case UNKNOWN_TYPE:
+		return "a value"
+	case NIL_TYPE:
+		return "nil"
+	}
+	return "a " + valueType
+}
@@ -0,0 +1,298 @@
+package lint
+
+import (
+	"dsoechting/glox/ast"
+	"dsoechting/glox/token"
+)
+
+// Calls visit on every statement and expression in the tree, parents before
+// their children. Returning false from visit skips the node's children
+func inspect(statements []Stmt, visit func(node any) bool) {
+	for _, stmt := range statements {
+		inspectStmt(stmt, visit)
+	}
+}
+
+func inspectStmt(stmt Stmt, visit func(node any) bool) {
+	if stmt == nil || !visit(stmt) {
+		return
+	}
+	switch stmt := stmt.(type) {
+	case *ast.BlockStmt:
+		inspect(stmt.Statements, visit)
+	case *ast.ClassStmt:
+		if stmt.Superclass != nil {
+			inspectExpr(stmt.Superclass, visit)
+		}
+		for _, method := range stmt.Methods {
+			inspectStmt(method, visit)
+		}
+	case *ast.ExpressionStmt:
+		inspectExpr(stmt.Expression, visit)
+	case *ast.FunctionStmt:
+		inspect(stmt.Body, visit)
+	case *ast.IfStmt:
+		inspectExpr(stmt.Condition, visit)
+		inspectStmt(stmt.ThenBranch, visit)
+		inspectStmt(stmt.ElseBranch, visit)
+	case *ast.PrintStmt:
+		inspectExpr(stmt.Expression, visit)
+	case *ast.ReturnStmt:
+		if stmt.Value != nil {
+			inspectExpr(stmt.Value, visit)
+		}
+	case *ast.VarStmt:
+		if stmt.Initializer != nil {
+			inspectExpr(stmt.Initializer, visit)
+		}
+	case *ast.WhileStmt:
+		inspectExpr(stmt.Condition, visit)
+		inspectStmt(stmt.Body, visit)
+	}
+}
+
+func inspectExpr(expr Expr, visit func(node any) bool) {
+	if !visit(expr) {
+		return
+	}
+	switch expr := expr.(type) {
+	case *ast.AssignExpr:
+		inspectExpr(expr.Value, visit)
+	case *ast.BinaryExpr:
+		inspectExpr(expr.Left, visit)
+		inspectExpr(expr.Right, visit)
+	case *ast.CallExpr:
+		inspectExpr(expr.Callee, visit)
+		for _, argument := range expr.Arguments {
+			inspectExpr(argument, visit)
+		}
+	case *ast.GetExpr:
+		inspectExpr(expr.Object, visit)
+	case *ast.GroupingExpr:
+		inspectExpr(expr.Expression, visit)
+	case *ast.LogicalExpr:
+		inspectExpr(expr.Left, visit)
+		inspectExpr(expr.Right, visit)
+	case *ast.SetExpr:
+		inspectExpr(expr.Object, visit)
+		inspectExpr(expr.Value, visit)
+	case *ast.TernaryExpr:
+		inspectExpr(expr.First, visit)
+		inspectExpr(expr.Second, visit)
+		inspectExpr(expr.Third, visit)
+	case *ast.UnaryExpr:
+		inspectExpr(expr.Right, visit)
+	}
+}
+
+// The leftmost token of a statement, false for an empty block
+func stmtToken(stmt Stmt) (Token, bool) {
+	switch stmt := stmt.(type) {
+	case *ast.BlockStmt:
+		if len(stmt.Statements) > 0 {
+			return stmtToken(stmt.Statements[0])
+		}
+	case *ast.ClassStmt:
+		return stmt.Name, true
+	case *ast.ExpressionStmt:
+		return exprToken(stmt.Expression), true
+	case *ast.FunctionStmt:
+		return stmt.Name, true
+	case *ast.IfStmt:
+		return stmt.Keyword, true
+	case *ast.PrintStmt:
+		return stmt.Keyword, true
+	case *ast.ReturnStmt:
+		return stmt.Keyword, true
+	case *ast.VarStmt:
+		return stmt.Name, true
+	case *ast.WhileStmt:
+		return stmt.Keyword, true
+	}
+	return Token{}, false
+}
+
+// The leftmost token of an expression. Groupings don't keep their '(', so they
+// give the first token inside it
+func exprToken(expr Expr) Token {
+	switch expr := expr.(type) {
+	case *ast.AssignExpr:
+		return expr.Name
+	case *ast.BinaryExpr:
+		return exprToken(expr.Left)
+	case *ast.CallExpr:
+		return exprToken(expr.Callee)
+	case *ast.GetExpr:
+		return exprToken(expr.Object)
+	case *ast.GroupingExpr:
+		return exprToken(expr.Expression)
+	case *ast.LiteralExpr:
+		return expr.Token
+	case *ast.LogicalExpr:
+		return exprToken(expr.Left)
+	case *ast.SetExpr:
+		return exprToken(expr.Object)
+	case *ast.SuperExpr:
+		return expr.Keyword
+	case *ast.TernaryExpr:
+		return exprToken(expr.First)
+	case *ast.ThisExpr:
+		return expr.Keyword
+	case *ast.UnaryExpr:
+		return expr.Operator
+	case *ast.VariableExpr:
+		return expr.Name
+	}
+	return Token{}
+}
+
+func unparenthesize(expr Expr) Expr {
+	for {
+		grouping, isGrouping := expr.(*ast.GroupingExpr)
+		if !isGrouping {
+			return expr
+		}
+		expr = grouping.Expression
+	}
+}
+
+// The value of an expression that doesn't depend on anything at runtime, following
+// the interpreter's rules. False when it does, or when evaluating it would fail
+func constant(expr Expr) (any, bool) {
+	switch expr := expr.(type) {
+	case *ast.LiteralExpr:
+		return expr.Value, true
+	case *ast.GroupingExpr:
+		return constant(expr.Expression)
+	case *ast.UnaryExpr:
+		right, isConstant := constant(expr.Right)
+		if !isConstant {
+			return nil, false
+		}
+		switch expr.Operator.TokenType {
+		case token.BANG:
+			return !isTruthy(right), true
+		case token.MINUS:
+			number, isNumber := right.(float64)
+			return -number, isNumber
+		}
+	case *ast.LogicalExpr:
+		left, isConstant := constant(expr.Left)
+		if !isConstant {
+			return nil, false
+		}
+		if (expr.Operator.TokenType == token.OR) == isTruthy(left) {
+			// Short circuits without looking at the right
+			return left, true
+		}
+		return constant(expr.Right)
+	case *ast.BinaryExpr:
+		left, isLeftConstant := constant(expr.Left)
+		right, isRightConstant := constant(expr.Right)
+		if !isLeftConstant || !isRightConstant {
+			return nil, false
+		}
+		return binary(expr.Operator.TokenType, left, right)
+	}
+	return nil, false
+}
+
+func binary(operator token.TokenType, left any, right any) (any, bool) {
+	switch operator {
+	case token.EQUAL_EQUAL:
+		return left == right, true
+	case token.BANG_EQUAL:
+		return left != right, true
+	case token.PLUS:
+		leftString, isLeftString := left.(string)
+		rightString, isRightString := right.(string)
+		if isLeftString && isRightString {
+			return leftString + rightString, true
+		}
+	}
+	leftNumber, isLeftNumber := left.(float64)
+	rightNumber, isRightNumber := right.(float64)
+	if !isLeftNumber || !isRightNumber {
+		return nil, false
+	}
+	switch operator {
+	case token.PLUS:
+		return leftNumber + rightNumber, true
+	case token.MINUS:
+		return leftNumber - rightNumber, true
+	case token.STAR:
+		return leftNumber * rightNumber, true
+	case token.SLASH:
+		return leftNumber / rightNumber, true
+	case token.GREATER:
+		return leftNumber > rightNumber, true
+	case token.GREATER_EQUAL:
+		return leftNumber >= rightNumber, true
+	case token.LESS:
+		return leftNumber < rightNumber, true
+	case token.LESS_EQUAL:
+		return leftNumber <= rightNumber, true
+	}
+	return nil, false
+}
+
+func isTruthy(value any) bool {
+	if value == nil {
+		return false
+	}
+	if boolean, isBool := value.(bool); isBool {
+		return boolean
+	}
+	return true
+}
+
+// Names of the types the linter can tell apart without running anything
+const (
+	UNKNOWN_TYPE = ""
+	NIL_TYPE     = "nil"
+	BOOLEAN_TYPE = "boolean"
+	NUMBER_TYPE  = "number"
+	STRING_TYPE  = "string"
+)
+
+// The type an expression always evaluates to, or UNKNOWN_TYPE when that depends on runtime values
+func staticType(expr Expr) string {
+	switch expr := expr.(type) {
+	case *ast.LiteralExpr:
+		switch expr.Value.(type) {
+		case nil:
+			return NIL_TYPE
+		case bool:
+			return BOOLEAN_TYPE
+		case float64:
+			return NUMBER_TYPE
+		case string:
+			return STRING_TYPE
+		}
+	case *ast.GroupingExpr:
+		return staticType(expr.Expression)
+	case *ast.UnaryExpr:
+		if expr.Operator.TokenType == token.BANG {
+			return BOOLEAN_TYPE
+		}
+		return NUMBER_TYPE
+	case *ast.BinaryExpr:
+		switch expr.Operator.TokenType {
+		case token.EQUAL_EQUAL, token.BANG_EQUAL, token.GREATER, token.GREATER_EQUAL, token.LESS, token.LESS_EQUAL:
+			return BOOLEAN_TYPE
+		case token.MINUS, token.STAR, token.SLASH:
+			return NUMBER_TYPE
+		case token.PLUS:
+			left, right := staticType(expr.Left), staticType(expr.Right)
+			if left == right && (left == NUMBER_TYPE || left == STRING_TYPE) {
+				return left
+			}
+		}
+	case *ast.TernaryExpr:
+		second, third := staticType(expr.Second), staticType(expr.Third)
+		if second == third {
+			return second
+		}
+	}
+	return UNKNOWN_TYPE
+}
@@ -0,0 +1,21 @@
+package main
+
+import (
+	"dsoechting/glox/lsp"
+	"fmt"
+)
+
+// glox lsp
+// Runs a language server on stdin and stdout until the editor shuts it down
+func (g *Glox) serveLanguageServer(args []string) int {
+	if len(args) != 0 {
+		fmt.Fprintln(g.options.Stderr, "Usage glox lsp")
+		return 64
+	}
+	serveErr := lsp.Create(g.options.Stdin, g.options.Stdout).Serve()
+	if serveErr != nil {
+		fmt.Fprintln(g.options.Stderr, serveErr)
+		return 1
+	}
+	return 0
+}
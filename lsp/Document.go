@@ -0,0 +1,94 @@
+package lsp
+
+import (
+	glox_error "dsoechting/glox/error"
+	"dsoechting/glox/interpret"
+	"dsoechting/glox/parse"
+	"dsoechting/glox/resolve"
+	"dsoechting/glox/scanner"
+	"dsoechting/glox/scope"
+	"io"
+)
+
+// An open file and everything learned from its current text
+type Document struct {
+	URI      string
+	Text     *Text
+	Analysis *scope.Analysis
+	// Scan, parse and resolve errors, plus the analysis warnings
+	Diagnostics []error
+}
+
+func Analyze(uri string, source string) *Document {
+	document := &Document{
+		URI:      uri,
+		Text:     CreateText(source),
+		Analysis: &scope.Analysis{},
+	}
+
+	tokens, scanErr := scanner.Create(source).ScanTokens()
+	if scanErr != nil {
+		document.Diagnostics = glox_error.Flatten(scanErr)
+		return document
+	}
+	parser := parse.Create(tokens)
+	statements, parseErr := parser.Parse()
+	document.Analysis = scope.Create(tokens).Analyze(statements)
+	if parseErr != nil {
+		// Anything found past this point would be guessing at a broken tree
+		document.Diagnostics = glox_error.Flatten(parseErr)
+		return document
+	}
+
+	interpreter := interpret.CreateWithOptions(interpret.Options{Stdout: io.Discard, Stderr: io.Discard})
+	resolveErr := resolve.Create(&interpreter).Resolve(statements)
+	document.Diagnostics = append(glox_error.Flatten(resolveErr), document.Analysis.Diagnostics...)
+	return document
+}
+
+func (d *Document) LSPDiagnostics() []Diagnostic {
+	converted := []Diagnostic{}
+	for _, err := range d.Diagnostics {
+		reportable, isReportable := err.(glox_error.Reportable)
+		if !isReportable {
+			converted = append(converted, Diagnostic{
+				Range:    d.Text.LineRange(1),
+				Severity: SEVERITY_ERROR,
+				Source:   "glox",
+				Message:  err.Error(),
+			})
+			continue
+		}
+		diagnostic := reportable.Details()
+		severity := SEVERITY_ERROR
+		if diagnostic.Severity == glox_error.WARNING {
+			severity = SEVERITY_WARNING
+		}
+		lspDiagnostic := Diagnostic{
+			Range:    d.spanRange(diagnostic.Span, diagnostic.Line),
+			Severity: severity,
+			Code:     string(diagnostic.Code),
+			Source:   "glox",
+			Message:  diagnostic.Message,
+		}
+		for _, note := range diagnostic.Notes {
+			lspDiagnostic.RelatedInformation = append(lspDiagnostic.RelatedInformation, DiagnosticRelatedInformation{
+				Location: Location{URI: d.URI, Range: d.spanRange(note.Span, diagnostic.Line)},
+				Message:  note.Message,
+			})
+		}
+		converted = append(converted, lspDiagnostic)
+	}
+	return converted
+}
+
+func (d *Document) spanRange(span glox_error.Span, line int) Range {
+	if !span.IsKnown() {
+		return d.Text.LineRange(line)
+	}
+	return d.Text.Range(span.Start, span.End)
+}
+
+func (d *Document) symbolAt(position Position) (*scope.Symbol, bool) {
+	return d.Analysis.SymbolAt(d.Text.Offset(position))
+}
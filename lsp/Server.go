@@ -0,0 +1,329 @@
+package lsp
+
+import (
+	"bufio"
+	"dsoechting/glox/scope"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strconv"
+	"strings"
+)
+
+// A language server for one client, talking JSON-RPC with LSP's Content-Length framing
+type Server struct {
+	reader    *bufio.Reader
+	writer    io.Writer
+	documents map[string]*Document
+	// Set by the shutdown request, after which only exit is allowed
+	isShutdown bool
+}
+
+var ErrExitWithoutShutdown = errors.New("exit notification received before shutdown")
+
+func Create(in io.Reader, out io.Writer) *Server {
+	return &Server{
+		reader:    bufio.NewReader(in),
+		writer:    out,
+		documents: map[string]*Document{},
+	}
+}
+
+// Handles messages until the client sends exit or closes the stream.
+// Returns nil only for an orderly shutdown then exit. A malformed message gets
+// a parse error response, only a broken stream stops the server
+func (s *Server) Serve() error {
+	for {
+		message, readErr := s.read()
+		var responseErr *ResponseError
+		if errors.As(readErr, &responseErr) {
+			// The request's ID is unreadable, so the response has a null one
+			unknownID := json.RawMessage("null")
+			if writeErr := s.respond(&unknownID, nil, responseErr); writeErr != nil {
+				return writeErr
+			}
+			continue
+		}
+		if readErr != nil {
+			if readErr == io.EOF {
+				return ErrExitWithoutShutdown
+			}
+			return readErr
+		}
+		if message.Method == "exit" {
+			if !s.isShutdown {
+				return ErrExitWithoutShutdown
+			}
+			return nil
+		}
+
+		result, handleErr := s.handle(message)
+		if message.ID == nil {
+			// Notifications get no response, even when they fail
+			continue
+		}
+		if writeErr := s.respond(message.ID, result, handleErr); writeErr != nil {
+			return writeErr
+		}
+	}
+}
+
+func (s *Server) handle(message *Message) (any, error) {
+	if s.isShutdown {
+		return nil, &ResponseError{Code: INVALID_REQUEST, Message: "server is shut down"}
+	}
+	switch message.Method {
+	case "initialize":
+		return InitializeResult{
+			Capabilities: ServerCapabilities{
+				TextDocumentSync:       FULL_SYNC,
+				DefinitionProvider:     true,
+				ReferencesProvider:     true,
+				HoverProvider:          true,
+				DocumentSymbolProvider: true,
+			},
+			ServerInfo: ServerInfo{Name: "glox"},
+		}, nil
+	case "initialized":
+		return nil, nil
+	case "shutdown":
+		s.isShutdown = true
+		return nil, nil
+	case "textDocument/didOpen":
+		var params DidOpenTextDocumentParams
+		if err := decodeParams(message, &params); err != nil {
+			return nil, err
+		}
+		return nil, s.update(params.TextDocument.URI, params.TextDocument.Text)
+	case "textDocument/didChange":
+		var params DidChangeTextDocumentParams
+		if err := decodeParams(message, &params); err != nil {
+			return nil, err
+		}
+		if len(params.ContentChanges) == 0 {
+			return nil, nil
+		}
+		// Full sync, so the last change holds the whole document
+		text := params.ContentChanges[len(params.ContentChanges)-1].Text
+		return nil, s.update(params.TextDocument.URI, text)
+	case "textDocument/didClose":
+		var params DidCloseTextDocumentParams
+		if err := decodeParams(message, &params); err != nil {
+			return nil, err
+		}
+		delete(s.documents, params.TextDocument.URI)
+		return nil, s.notify("textDocument/publishDiagnostics", PublishDiagnosticsParams{
+			URI:         params.TextDocument.URI,
+			Diagnostics: []Diagnostic{},
+		})
+	case "textDocument/definition":
+		var params TextDocumentPositionParams
+		if err := decodeParams(message, &params); err != nil {
+			return nil, err
+		}
+		return s.definition(params)
+	case "textDocument/references":
+		var params ReferenceParams
+		if err := decodeParams(message, &params); err != nil {
+			return nil, err
+		}
+		return s.references(params)
+	case "textDocument/hover":
+		var params TextDocumentPositionParams
+		if err := decodeParams(message, &params); err != nil {
+			return nil, err
+		}
+		return s.hover(params)
+	case "textDocument/documentSymbol":
+		var params DocumentSymbolParams
+		if err := decodeParams(message, &params); err != nil {
+			return nil, err
+		}
+		return s.documentSymbols(params)
+	}
+	return nil, &ResponseError{Code: METHOD_NOT_FOUND, Message: fmt.Sprintf("method not found: %s", message.Method)}
+}
+
+// Reanalyzes a document and publishes its diagnostics
+func (s *Server) update(uri string, text string) error {
+	document := Analyze(uri, text)
+	s.documents[uri] = document
+	return s.notify("textDocument/publishDiagnostics", PublishDiagnosticsParams{
+		URI:         uri,
+		Diagnostics: document.LSPDiagnostics(),
+	})
+}
+
+func (s *Server) document(uri string) (*Document, error) {
+	document, isOpen := s.documents[uri]
+	if !isOpen {
+		return nil, &ResponseError{Code: INVALID_PARAMS, Message: fmt.Sprintf("document not open: %s", uri)}
+	}
+	return document, nil
+}
+
+func (s *Server) definition(params TextDocumentPositionParams) (any, error) {
+	document, err := s.document(params.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+	symbol, isFound := document.symbolAt(params.Position)
+	if !isFound || !symbol.IsDeclared() {
+		return nil, nil
+	}
+	declaration := symbol.Declaration
+	return Location{URI: document.URI, Range: document.Text.Range(declaration.Start, declaration.End)}, nil
+}
+
+func (s *Server) references(params ReferenceParams) (any, error) {
+	document, err := s.document(params.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+	locations := []Location{}
+	symbol, isFound := document.symbolAt(params.Position)
+	if !isFound {
+		return locations, nil
+	}
+	for _, occurrence := range document.Analysis.Occurrences {
+		if occurrence.Symbol != symbol || (occurrence.IsDeclaration && !params.Context.IncludeDeclaration) {
+			continue
+		}
+		name := occurrence.Token
+		locations = append(locations, Location{URI: document.URI, Range: document.Text.Range(name.Start, name.End)})
+	}
+	return locations, nil
+}
+
+func (s *Server) hover(params TextDocumentPositionParams) (any, error) {
+	document, err := s.document(params.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+	offset := document.Text.Offset(params.Position)
+	for _, occurrence := range document.Analysis.Occurrences {
+		name := occurrence.Token
+		if offset < name.Start || offset > name.End {
+			continue
+		}
+		uses := len(occurrence.Symbol.References)
+		plural := "s"
+		if uses == 1 {
+			plural = ""
+		}
+		value := fmt.Sprintf("```glox\n%s\n```\n\n%d reference%s", occurrence.Symbol.Detail, uses, plural)
+		return Hover{
+			Contents: MarkupContent{Kind: "markdown", Value: value},
+			Range:    document.Text.Range(name.Start, name.End),
+		}, nil
+	}
+	return nil, nil
+}
+
+func (s *Server) documentSymbols(params DocumentSymbolParams) (any, error) {
+	document, err := s.document(params.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+	return documentSymbols(document, document.Analysis.Symbols), nil
+}
+
+func documentSymbols(document *Document, symbols []*scope.Symbol) []DocumentSymbol {
+	converted := []DocumentSymbol{}
+	for _, symbol := range symbols {
+		kind := SYMBOL_VARIABLE
+		switch symbol.Kind {
+		case scope.FUNCTION:
+			kind = SYMBOL_FUNCTION
+		case scope.METHOD:
+			kind = SYMBOL_METHOD
+		case scope.CLASS:
+			kind = SYMBOL_CLASS
+		}
+		converted = append(converted, DocumentSymbol{
+			Name:           symbol.Name,
+			Detail:         symbol.Detail,
+			Kind:           kind,
+			Range:          document.Text.Range(symbol.Start, symbol.End),
+			SelectionRange: document.Text.Range(symbol.Declaration.Start, symbol.Declaration.End),
+			Children:       documentSymbols(document, symbol.Children),
+		})
+	}
+	return converted
+}
+
+func decodeParams(message *Message, params any) error {
+	if err := json.Unmarshal(message.Params, params); err != nil {
+		return &ResponseError{Code: INVALID_PARAMS, Message: err.Error()}
+	}
+	return nil
+}
+
+// Reads one framed message: headers, a blank line, then Content-Length bytes of JSON.
+// A frame that can't be understood is a *ResponseError, anything else is the stream failing
+func (s *Server) read() (*Message, error) {
+	headers, headerErr := textproto.NewReader(s.reader).ReadMIMEHeader()
+	if headerErr != nil {
+		if len(headers) == 0 && errors.Is(headerErr, io.EOF) {
+			return nil, io.EOF
+		}
+		var protocolErr textproto.ProtocolError
+		if errors.As(headerErr, &protocolErr) {
+			return nil, &ResponseError{Code: PARSE_ERROR, Message: fmt.Sprintf("malformed header: %v", headerErr)}
+		}
+		return nil, headerErr
+	}
+	length, lengthErr := strconv.Atoi(strings.TrimSpace(headers.Get("Content-Length")))
+	if lengthErr != nil || length < 0 {
+		return nil, &ResponseError{Code: PARSE_ERROR, Message: fmt.Sprintf("bad Content-Length header %q", headers.Get("Content-Length"))}
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(s.reader, body); err != nil {
+		return nil, err
+	}
+	var message Message
+	if err := json.Unmarshal(body, &message); err != nil {
+		return nil, &ResponseError{Code: PARSE_ERROR, Message: fmt.Sprintf("malformed message: %v", err)}
+	}
+	return &message, nil
+}
+
+func (s *Server) respond(id *json.RawMessage, result any, err error) error {
+	response := Message{JSONRPC: "2.0", ID: id}
+	if err != nil {
+		var responseErr *ResponseError
+		if !errors.As(err, &responseErr) {
+			responseErr = &ResponseError{Code: INTERNAL_ERROR, Message: err.Error()}
+		}
+		response.Error = responseErr
+		return s.write(response)
+	}
+	encoded, encodeErr := json.Marshal(result)
+	if encodeErr != nil {
+		return encodeErr
+	}
+	response.Result = encoded
+	return s.write(response)
+}
+
+func (s *Server) notify(method string, params any) error {
+	encoded, encodeErr := json.Marshal(params)
+	if encodeErr != nil {
+		return encodeErr
+	}
+	return s.write(Message{JSONRPC: "2.0", Method: method, Params: encoded})
+}
+
+func (s *Server) write(message Message) error {
+	body, encodeErr := json.Marshal(message)
+	if encodeErr != nil {
+		return encodeErr
+	}
+	if _, err := fmt.Fprintf(s.writer, "Content-Length: %d\r\n\r\n", len(body)); err != nil {
+		return err
+	}
+	_, err := s.writer.Write(body)
+	return err
+}
@@ -0,0 +1,71 @@
+package lsp
+
+import (
+	"sort"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// Converts between the byte offsets tokens carry and LSP positions, which
+// count lines from 0 and characters in UTF-16 code units
+type Text struct {
+	source string
+	// Offset of the first byte of each line
+	lineStarts []int
+}
+
+func CreateText(source string) *Text {
+	lineStarts := []int{0}
+	for i := 0; i < len(source); i++ {
+		if source[i] == '\n' {
+			lineStarts = append(lineStarts, i+1)
+		}
+	}
+	return &Text{source: source, lineStarts: lineStarts}
+}
+
+func (t *Text) Position(offset int) Position {
+	offset = max(0, min(offset, len(t.source)))
+	line := sort.Search(len(t.lineStarts), func(i int) bool {
+		return t.lineStarts[i] > offset
+	}) - 1
+	character := 0
+	for _, char := range t.source[t.lineStarts[line]:offset] {
+		character += len(utf16.Encode([]rune{char}))
+	}
+	return Position{Line: line, Character: character}
+}
+
+func (t *Text) Range(start int, end int) Range {
+	return Range{Start: t.Position(start), End: t.Position(end)}
+}
+
+// The byte offset of a position, clamped to the document
+func (t *Text) Offset(position Position) int {
+	if position.Line < 0 {
+		return 0
+	}
+	if position.Line >= len(t.lineStarts) {
+		return len(t.source)
+	}
+	offset := t.lineStarts[position.Line]
+	for character := 0; character < position.Character && offset < len(t.source); {
+		char, size := utf8.DecodeRuneInString(t.source[offset:])
+		if char == '\n' {
+			break
+		}
+		character += len(utf16.Encode([]rune{char}))
+		offset += size
+	}
+	return offset
+}
+
+// The range covering a whole 1-based line, for diagnostics with no better location
+func (t *Text) LineRange(line int) Range {
+	index := max(0, min(line-1, len(t.lineStarts)-1))
+	end := len(t.source)
+	if index+1 < len(t.lineStarts) {
+		end = t.lineStarts[index+1] - 1
+	}
+	return t.Range(t.lineStarts[index], end)
+}
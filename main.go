@@ -2,34 +2,118 @@ package main
 
 import (
 	"bufio"
+	"errors"
+	"flag"
 	"fmt"
-	"log"
 	"os"
 
+	"dsoechting/glox/compile"
 	glox_error "dsoechting/glox/error"
 	"dsoechting/glox/interpret"
 	"dsoechting/glox/parse"
+	"dsoechting/glox/resolve"
 	"dsoechting/glox/scanner"
+	"dsoechting/glox/vm"
 )
 
-type GloxError = glox_error.GloxError
+type RuntimeError = glox_error.RuntimeError
 type Interpreter = interpret.Interpreter
+type VM = vm.VM
+
+const (
+	TREE_BACKEND = "tree"
+	VM_BACKEND   = "vm"
+)
+
+const (
+	TEXT_DIAGNOSTICS = "text"
+	JSON_DIAGNOSTICS = "json"
+)
 
 type Glox struct {
-	interpreter  Interpreter
-	compileError error
-	runtimeError error
+	backend     string
+	interpreter Interpreter
+	vm          *VM
+	options     interpret.Options
+	// How errors are printed, TEXT_DIAGNOSTICS or JSON_DIAGNOSTICS
+	diagnostics string
+	// Path and text of whatever is being run, so errors can quote it
+	file   string
+	source string
+	// The last error reported, its type decides the exit code
+	err error
+	// Stdin's file, edited with arrow keys and history by the REPL when it's a terminal
+	terminal *os.File
+}
+
+func Create(backend string, options interpret.Options) Glox {
+	return Glox{
+		backend:     backend,
+		interpreter: interpret.CreateWithOptions(options),
+		vm: vm.CreateWithOptions(vm.Options{
+			Stdout: options.Stdout,
+			Stderr: options.Stderr,
+			Stdin:  options.Stdin,
+		}),
+		options:     options,
+		diagnostics: TEXT_DIAGNOSTICS,
+	}
 }
 
 func main() {
-	args := os.Args[1:]
+	backend := flag.String("backend", TREE_BACKEND, "execution backend, either \"tree\" (tree walking interpreter) or \"vm\" (bytecode VM)")
+	diagnostics := flag.String("diagnostics", TEXT_DIAGNOSTICS, "error output format, either \"text\" or \"json\" (one object per line)")
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), "Usage glox [-backend=tree|vm] [-diagnostics=text|json] [script]")
+		fmt.Fprintln(flag.CommandLine.Output(), "      glox build [-o output.gloxc] script")
+		fmt.Fprintln(flag.CommandLine.Output(), "      glox disasm script")
+		fmt.Fprintln(flag.CommandLine.Output(), "      glox lsp")
+		fmt.Fprintln(flag.CommandLine.Output(), "      glox debug script")
+		fmt.Fprintln(flag.CommandLine.Output(), "      glox dap")
+		fmt.Fprintln(flag.CommandLine.Output(), "      glox fmt [-w] [-d] [script ...]")
+		fmt.Fprintln(flag.CommandLine.Output(), "      glox lint script ...")
+		fmt.Fprintln(flag.CommandLine.Output(), "      glox test [dir ...]")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	args := flag.Args()
 	argCount := len(args)
-	glox := Glox{
-		interpreter: interpret.Create(),
+	if *backend != TREE_BACKEND && *backend != VM_BACKEND || *diagnostics != TEXT_DIAGNOSTICS && *diagnostics != JSON_DIAGNOSTICS {
+		flag.Usage()
+		os.Exit(64)
+	}
+	glox := Create(*backend, interpret.Options{
+		Stdout: os.Stdout,
+		Stderr: os.Stderr,
+		Stdin:  bufio.NewReader(os.Stdin),
+	})
+	glox.diagnostics = *diagnostics
+	glox.terminal = os.Stdin
+
+	if argCount > 0 && !isFile(args[0]) {
+		switch args[0] {
+		case "build":
+			os.Exit(glox.build(args[1:]))
+		case "disasm":
+			os.Exit(glox.disassemble(args[1:]))
+		case "lsp":
+			os.Exit(glox.serveLanguageServer(args[1:]))
+		case "debug":
+			os.Exit(glox.debug(args[1:]))
+		case "dap":
+			os.Exit(glox.serveDebugAdapter(args[1:]))
+		case "fmt":
+			os.Exit(glox.formatScripts(args[1:]))
+		case "lint":
+			os.Exit(glox.lint(args[1:]))
+		case "test":
+			os.Exit(glox.runTests(args[1:]))
+		}
 	}
 
 	if argCount > 1 {
-		fmt.Println("Usage glox [script]")
+		flag.Usage()
 		os.Exit(64)
 	} else if argCount == 1 {
 		glox.runFile(args[0])
@@ -38,67 +122,119 @@ func main() {
 	}
 }
 
+// A script named like a subcommand, such as test, runs instead of the subcommand
+func isFile(path string) bool {
+	info, statErr := os.Stat(path)
+	return statErr == nil && !info.IsDir()
+}
+
 func (g *Glox) runFile(path string) {
 	data, readErr := os.ReadFile(path)
 	if readErr != nil {
 		// Can't read file
 		os.Exit(66)
 	}
-	g.run(string(data))
-	if g.compileError != nil {
-		os.Exit(65)
+	g.file = path
+	if compile.IsCompiled(data) {
+		g.runCompiled(data)
+	} else {
+		g.run(string(data))
 	}
-	if g.runtimeError != nil {
-		os.Exit(70)
+	if g.err != nil {
+		os.Exit(exitCode(g.err))
 	}
 }
 
-func (g *Glox) runPrompt() error {
-	reader := bufio.NewReader(os.Stdin)
-	for {
-		fmt.Print("> ")
-		line, _, err := reader.ReadLine()
-		if err != nil {
-			return err
-		}
-		if line == nil {
-			break
-		}
-		value := g.run(string(line))
-		fmt.Printf("%v", value)
+// Scripts that fail before running exit with 65, those that fail while running with 70
+func exitCode(err error) int {
+	var runtimeErr *RuntimeError
+	if errors.As(err, &runtimeErr) {
+		return 70
 	}
-	return nil
+	return 65
 }
 
-func (g *Glox) run(source string) any {
+// Runs source, returning the values of its top level expression statements
+// formatted for the REPL to echo
+func (g *Glox) run(source string) []string {
+	statements, isParsed := g.parse(source)
+	if !isParsed {
+		return nil
+	}
+
+	if g.backend == VM_BACKEND {
+		return g.runVM(statements)
+	}
+
+	resolver := resolve.Create(&g.interpreter)
+	resolveErr := resolver.Resolve(statements)
+	if resolveErr != nil {
+		g.report(resolveErr)
+		return nil
+	}
+
+	values, evalErr := g.interpreter.Interpret(statements)
+	if evalErr != nil {
+		g.report(evalErr)
+	}
+	echoes := make([]string, len(values))
+	for index, value := range values {
+		echoes[index] = interpret.Stringify(value)
+	}
+	return echoes
+}
+
+func (g *Glox) parse(source string) ([]parse.Stmt, bool) {
+	g.source = source
 	scanner := scanner.Create(source)
 	tokens, scanErr := scanner.ScanTokens()
 	if scanErr != nil {
-		g.setCompileError(scanErr)
-		return nil
+		g.report(scanErr)
+		return nil, false
 	}
-	// scanner.PrintTokens()
 
 	parser := parse.Create(tokens)
 
 	statements, parseError := parser.Parse()
 	if parseError != nil {
-		g.setCompileError(parseError)
-		return nil
+		g.report(parseError)
+		return nil, false
 	}
-	evalResult, evalErr := g.interpreter.Interpret(statements)
-	if evalErr != nil {
-		g.setRuntimeError(evalErr)
-	}
-	return evalResult
+	return statements, true
 }
 
-func (g *Glox) setCompileError(error error) {
-	g.compileError = error
-	log.Println(error.Error())
+// The compiler does its own scope resolution, so the VM skips the resolver pass
+func (g *Glox) runVM(statements []parse.Stmt) []string {
+	function, compileErr := compile.Compile(statements)
+	if compileErr != nil {
+		g.report(compileErr)
+		return nil
+	}
+
+	values, runErr := g.vm.Interpret(function)
+	if runErr != nil {
+		g.report(runErr)
+	}
+	echoes := make([]string, len(values))
+	for index, value := range values {
+		echoes[index] = value.String()
+	}
+	return echoes
 }
 
-func (g *Glox) setRuntimeError(error error) {
-	g.runtimeError = error
-	log.Println(error.Error())
+func (g *Glox) report(err error) {
+	g.err = err
+	var runtimeErr *RuntimeError
+	if errors.As(err, &runtimeErr) {
+		runtimeErr.SetFile(g.file)
+	}
+	if g.diagnostics == JSON_DIAGNOSTICS {
+		file := g.file
+		if file == "" {
+			file = "<stdin>"
+		}
+		glox_error.WriteJSON(g.options.Stderr, file, g.source, err)
+		return
+	}
+	fmt.Fprintln(g.options.Stderr, glox_error.Render(g.source, err))
 }
@@ -4,7 +4,9 @@ import (
 	"dsoechting/glox/ast"
 	glox_error "dsoechting/glox/error"
 	"dsoechting/glox/token"
+	"errors"
 	"fmt"
+	"strings"
 )
 
 type Expr = ast.Expr
@@ -19,13 +21,36 @@ type UnaryExpr = ast.UnaryExpr
 type LiteralExpr = ast.LiteralExpr
 type GroupingExpr = ast.GroupingExpr
 type VariableExpr = ast.VariableExpr
+type CallExpr = ast.CallExpr
+type FunctionStmt = ast.FunctionStmt
 type TokenType = token.TokenType
 type Token = token.Token
-type GloxError = glox_error.GloxError
+type ParseError = glox_error.ParseError
+
+const maxArguments = 255
 
 type Parser struct {
 	tokens  []token.Token
 	current int
+	// How many blocks the parser is inside, so recovery knows whether a '}' closes one
+	blockDepth int
+	// Every syntax error so far. Parsing carries on past them to find the rest
+	errors Errors
+}
+
+// All of the syntax errors from one parse, in source order
+type Errors []error
+
+func (e Errors) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Error()
+	}
+	return strings.Join(messages, "\n")
+}
+
+func (e Errors) Unwrap() []error {
+	return e
 }
 
 func Create(tokens []token.Token) Parser {
@@ -35,21 +60,69 @@ func Create(tokens []token.Token) Parser {
 	}
 }
 
+// Parses the whole token stream. On syntax errors the statements that did parse
+// are still returned, along with an Errors holding every error found
 func (p *Parser) Parse() ([]Stmt, error) {
 	statements := []Stmt{}
 	for !p.isAtEnd() {
 		stmt, stmtErr := p.declaration()
 		if stmtErr != nil {
-			// Do I want to end parsing here? I might want to keep going
-			return nil, stmtErr
+			// declaration has already synchronized, so keep going from the next statement
+			p.errors = append(p.errors, stmtErr)
+			continue
 		}
 		statements = append(statements, stmt)
 
 	}
+	if len(p.errors) > 0 {
+		return statements, p.errors
+	}
 	return statements, nil
 }
 
+// Reports whether every syntax error in err is at the end of the input, like an
+// unclosed brace or a trailing operator, so more lines could still complete it
+func IsIncomplete(err error) bool {
+	errs := glox_error.Flatten(err)
+	for _, single := range errs {
+		parseErr, isParseErr := single.(*ParseError)
+		if !isParseErr || !parseErr.IsAtEnd {
+			return false
+		}
+	}
+	return len(errs) > 0
+}
+
+// Parses a lone expression that has to use up every token, for tools such as
+// a debugger evaluating watches
+func (p *Parser) ParseExpression() (Expr, error) {
+	expr, exprErr := p.expression()
+	if exprErr != nil {
+		return nil, exprErr
+	}
+	if !p.isAtEnd() {
+		return nil, createParseError(glox_error.EXPECTED_TOKEN, p.peek(), "Expect end of expression.")
+	}
+	return expr, nil
+}
+
 func (p *Parser) declaration() (Stmt, error) {
+	if p.match(token.CLASS) {
+		classDecl, err := p.classDeclaration()
+		if err != nil {
+			p.synchronize()
+			return nil, err
+		}
+		return classDecl, nil
+	}
+	if p.match(token.FUN) {
+		funDecl, err := p.function("function")
+		if err != nil {
+			p.synchronize()
+			return nil, err
+		}
+		return funDecl, nil
+	}
 	if p.match(token.VAR) {
 		varDecl, err := p.varDeclaration()
 		if err != nil {
@@ -66,6 +139,50 @@ func (p *Parser) declaration() (Stmt, error) {
 	return stmt, nil
 }
 
+func (p *Parser) classDeclaration() (Stmt, error) {
+	name, nameErr := p.consume(token.IDENTIFIER, "Expect class name.")
+	if nameErr != nil {
+		return nil, nameErr
+	}
+
+	var superclass *VariableExpr
+	if p.match(token.LESS) {
+		superName, superNameErr := p.consume(token.IDENTIFIER, "Expect superclass name.")
+		if superNameErr != nil {
+			return nil, superNameErr
+		}
+		superclass = &VariableExpr{
+			Name: superName,
+		}
+	}
+
+	_, leftBraceErr := p.consume(token.LEFT_BRACE, "Expect '{' before class body.")
+	if leftBraceErr != nil {
+		return nil, leftBraceErr
+	}
+
+	methods := []*FunctionStmt{}
+	for !p.check(token.RIGHT_BRACE) && !p.isAtEnd() {
+		method, methodErr := p.function("method")
+		if methodErr != nil {
+			return nil, methodErr
+		}
+		methods = append(methods, method)
+	}
+
+	_, rightBraceErr := p.consume(token.RIGHT_BRACE, "Expect '}' after class body.")
+	if rightBraceErr != nil {
+		return nil, rightBraceErr
+	}
+
+	return &ast.ClassStmt{
+		Name: name,
+		// Possibly nil
+		Superclass: superclass,
+		Methods:    methods,
+	}, nil
+}
+
 func (p *Parser) statement() (Stmt, error) {
 	if p.match(token.FOR) {
 		return p.forStatement()
@@ -76,6 +193,9 @@ func (p *Parser) statement() (Stmt, error) {
 	if p.match(token.PRINT) {
 		return p.printStatement()
 	}
+	if p.match(token.RETURN) {
+		return p.returnStatement()
+	}
 	if p.match(token.WHILE) {
 		return p.whileStatement()
 	}
@@ -93,6 +213,7 @@ func (p *Parser) statement() (Stmt, error) {
 }
 
 func (p *Parser) forStatement() (Stmt, error) {
+	keyword := p.previous()
 	_, leftParenErr := p.consume(token.LEFT_PAREN, "Expect '(' after 'for',")
 	if leftParenErr != nil {
 		return nil, leftParenErr
@@ -156,12 +277,14 @@ func (p *Parser) forStatement() (Stmt, error) {
 
 	if condition == nil {
 		condition = &LiteralExpr{
+			Token: keyword,
 			Value: true,
 		}
 	}
 
 	// Make a while loop with our condition and the body (with incrementer)
 	body = &WhileStmt{
+		Keyword:   keyword,
 		Condition: condition,
 		Body:      body,
 	}
@@ -177,6 +300,7 @@ func (p *Parser) forStatement() (Stmt, error) {
 }
 
 func (p *Parser) ifStatement() (Stmt, error) {
+	keyword := p.previous()
 
 	_, leftParenErr := p.consume(token.LEFT_PAREN, "Expect '(' after 'if'.")
 	if leftParenErr != nil {
@@ -210,6 +334,7 @@ func (p *Parser) ifStatement() (Stmt, error) {
 		maybeElseBranch = elseBranch
 	}
 	return &ast.IfStmt{
+		Keyword:    keyword,
 		Condition:  condition,
 		ThenBranch: thenBranch,
 		// Possibly nil
@@ -218,6 +343,7 @@ func (p *Parser) ifStatement() (Stmt, error) {
 }
 
 func (p *Parser) printStatement() (Stmt, error) {
+	keyword := p.previous()
 	value, err := p.expression()
 	if err != nil {
 		return nil, err
@@ -229,11 +355,37 @@ func (p *Parser) printStatement() (Stmt, error) {
 	}
 
 	return &ast.PrintStmt{
+		Keyword:    keyword,
 		Expression: value,
 	}, nil
 }
 
+func (p *Parser) returnStatement() (Stmt, error) {
+	keyword := p.previous()
+
+	var value Expr
+	var valueErr error
+	if !p.check(token.SEMICOLON) {
+		value, valueErr = p.expression()
+	}
+	if valueErr != nil {
+		return nil, valueErr
+	}
+
+	_, semiColonErr := p.consume(token.SEMICOLON, "Expect ';' after return value.")
+	if semiColonErr != nil {
+		return nil, semiColonErr
+	}
+
+	return &ast.ReturnStmt{
+		Keyword: keyword,
+		// Possibly nil
+		Value: value,
+	}, nil
+}
+
 func (p *Parser) whileStatement() (Stmt, error) {
+	keyword := p.previous()
 
 	_, leftParenErr := p.consume(token.LEFT_PAREN, "Expect '(' after 'while'.")
 	if leftParenErr != nil {
@@ -258,12 +410,66 @@ func (p *Parser) whileStatement() (Stmt, error) {
 	}
 
 	return &WhileStmt{
+		Keyword:   keyword,
 		Condition: condition,
 		Body:      body,
 	}, nil
 
 }
 
+// kind is either "function" or "method", used for error messages
+func (p *Parser) function(kind string) (*FunctionStmt, error) {
+	name, nameErr := p.consume(token.IDENTIFIER, fmt.Sprintf("Expect %s name.", kind))
+	if nameErr != nil {
+		return nil, nameErr
+	}
+
+	_, leftParenErr := p.consume(token.LEFT_PAREN, fmt.Sprintf("Expect '(' after %s name.", kind))
+	if leftParenErr != nil {
+		return nil, leftParenErr
+	}
+
+	parameters := []Token{}
+	if !p.check(token.RIGHT_PAREN) {
+		for {
+			if len(parameters) >= maxArguments {
+				return nil, createParseError(glox_error.TOO_MANY_ARGUMENTS, p.peek(), fmt.Sprintf("Can't have more than %d parameters.", maxArguments))
+			}
+
+			param, paramErr := p.consume(token.IDENTIFIER, "Expect parameter name.")
+			if paramErr != nil {
+				return nil, paramErr
+			}
+			parameters = append(parameters, param)
+
+			if !p.match(token.COMMA) {
+				break
+			}
+		}
+	}
+
+	_, rightParenErr := p.consume(token.RIGHT_PAREN, "Expect ')' after parameters.")
+	if rightParenErr != nil {
+		return nil, rightParenErr
+	}
+
+	_, leftBraceErr := p.consume(token.LEFT_BRACE, fmt.Sprintf("Expect '{' before %s body.", kind))
+	if leftBraceErr != nil {
+		return nil, leftBraceErr
+	}
+
+	body, bodyErr := p.block()
+	if bodyErr != nil {
+		return nil, bodyErr
+	}
+
+	return &FunctionStmt{
+		Name:   name,
+		Params: parameters,
+		Body:   body,
+	}, nil
+}
+
 func (p *Parser) varDeclaration() (Stmt, error) {
 	name, nameErr := p.consume(token.IDENTIFIER, "Expected variable name.")
 	if nameErr != nil {
@@ -306,19 +512,25 @@ func (p *Parser) expressionStatement() (Stmt, error) {
 	}, nil
 }
 
+// Call after consuming the '{'
 func (p *Parser) block() ([]Stmt, error) {
+	leftBrace := p.previous()
 	statements := []Stmt{}
+	p.blockDepth++
+	defer func() { p.blockDepth-- }()
 	for !p.check(token.RIGHT_BRACE) && !p.isAtEnd() {
 		stmt, stmtErr := p.declaration()
 		if stmtErr != nil {
-			return nil, stmtErr
+			// Recorded here, the rest of the block may still parse
+			p.errors = append(p.errors, stmtErr)
+			continue
 		}
 
 		statements = append(statements, stmt)
 	}
 	_, rightBraceErr := p.consume(token.RIGHT_BRACE, "Expect '}' after block.")
 	if rightBraceErr != nil {
-		return nil, rightBraceErr
+		return nil, noteOpenedAt(rightBraceErr, leftBrace)
 	}
 
 	return statements, nil
@@ -330,6 +542,9 @@ func (p *Parser) expression() (Expr, error) {
 
 func (p *Parser) assignment() (Expr, error) {
 	expr, exprErr := p.ternary()
+	if exprErr != nil {
+		return nil, exprErr
+	}
 
 	if p.match(token.EQUAL) {
 		equals := p.previous()
@@ -346,9 +561,18 @@ func (p *Parser) assignment() (Expr, error) {
 				Value: value,
 			}, nil
 		}
-		return nil, createParseError(equals, "Invalid assignment target.")
+
+		getExpr, isGetExpr := expr.(*ast.GetExpr)
+		if isGetExpr {
+			return &ast.SetExpr{
+				Object: getExpr.Object,
+				Name:   getExpr.Name,
+				Value:  value,
+			}, nil
+		}
+		return nil, createParseError(glox_error.INVALID_ASSIGNMENT_TARGET, equals, "Invalid assignment target.")
 	}
-	return expr, exprErr
+	return expr, nil
 }
 
 func (p *Parser) ternary() (Expr, error) {
@@ -526,27 +750,110 @@ func (p *Parser) unary() (Expr, error) {
 			Right:    right,
 		}, nil
 	}
-	result, primaryErr := p.primary()
+	result, callErr := p.call()
+	if callErr != nil {
+		return nil, callErr
+	}
+
+	return result, nil
+}
+
+func (p *Parser) call() (Expr, error) {
+	expr, primaryErr := p.primary()
 	if primaryErr != nil {
 		return nil, primaryErr
 	}
 
-	return result, nil
+	for {
+		if p.match(token.LEFT_PAREN) {
+			var callErr error
+			expr, callErr = p.finishCall(expr)
+			if callErr != nil {
+				return nil, callErr
+			}
+		} else if p.match(token.DOT) {
+			name, nameErr := p.consume(token.IDENTIFIER, "Expect property name after '.'.")
+			if nameErr != nil {
+				return nil, nameErr
+			}
+			expr = &ast.GetExpr{
+				Object: expr,
+				Name:   name,
+			}
+		} else {
+			break
+		}
+	}
+	return expr, nil
+}
+
+func (p *Parser) finishCall(callee Expr) (Expr, error) {
+	arguments := []Expr{}
+	if !p.check(token.RIGHT_PAREN) {
+		for {
+			if len(arguments) >= maxArguments {
+				return nil, createParseError(glox_error.TOO_MANY_ARGUMENTS, p.peek(), fmt.Sprintf("Can't have more than %d arguments.", maxArguments))
+			}
+
+			argument, argumentErr := p.expression()
+			if argumentErr != nil {
+				return nil, argumentErr
+			}
+			arguments = append(arguments, argument)
+
+			if !p.match(token.COMMA) {
+				break
+			}
+		}
+	}
+
+	paren, rightParenErr := p.consume(token.RIGHT_PAREN, "Expect ')' after arguments.")
+	if rightParenErr != nil {
+		return nil, rightParenErr
+	}
+
+	return &CallExpr{
+		Callee:    callee,
+		Paren:     paren,
+		Arguments: arguments,
+	}, nil
 }
 
 func (p *Parser) primary() (Expr, error) {
 	if p.match(token.FALSE) {
-		return &LiteralExpr{Value: false}, nil
+		return &LiteralExpr{Token: p.previous(), Value: false}, nil
 	}
 	if p.match(token.TRUE) {
-		return &LiteralExpr{Value: true}, nil
+		return &LiteralExpr{Token: p.previous(), Value: true}, nil
 	}
 	if p.match(token.NIL) {
-		return &LiteralExpr{Value: nil}, nil
+		return &LiteralExpr{Token: p.previous(), Value: nil}, nil
 	}
 
 	if p.match(token.STRING, token.NUMBER) {
-		return &LiteralExpr{Value: p.previous().Literal}, nil
+		return &LiteralExpr{Token: p.previous(), Value: p.previous().Literal}, nil
+	}
+
+	if p.match(token.SUPER) {
+		keyword := p.previous()
+		_, dotErr := p.consume(token.DOT, "Expect '.' after 'super'.")
+		if dotErr != nil {
+			return nil, dotErr
+		}
+		method, methodErr := p.consume(token.IDENTIFIER, "Expect superclass method name.")
+		if methodErr != nil {
+			return nil, methodErr
+		}
+		return &ast.SuperExpr{
+			Keyword: keyword,
+			Method:  method,
+		}, nil
+	}
+
+	if p.match(token.THIS) {
+		return &ast.ThisExpr{
+			Keyword: p.previous(),
+		}, nil
 	}
 
 	if p.match(token.IDENTIFIER) {
@@ -556,6 +863,7 @@ func (p *Parser) primary() (Expr, error) {
 	}
 
 	if p.match(token.LEFT_PAREN) {
+		leftParen := p.previous()
 		expr, err := p.expression()
 		if err != nil {
 			return nil, err
@@ -563,14 +871,14 @@ func (p *Parser) primary() (Expr, error) {
 
 		_, rightParenErr := p.consume(token.RIGHT_PAREN, "Expect ')' after expression")
 		if rightParenErr != nil {
-			return nil, rightParenErr
+			return nil, noteOpenedAt(rightParenErr, leftParen)
 		}
 
 		return &GroupingExpr{
 			Expression: expr,
 		}, nil
 	}
-	return nil, createParseError(p.peek(), "Expect expression.")
+	return nil, createParseError(glox_error.EXPECTED_EXPRESSION, p.peek(), "Expect expression.")
 }
 
 func (p *Parser) match(types ...TokenType) bool {
@@ -588,7 +896,7 @@ func (p *Parser) consume(tokenType TokenType, message string) (Token, error) {
 		return p.advance(), nil
 	}
 	// Add the error to the struct, and we keep trucking. We'll see if this becomes a problem
-	consumeError := createParseError(p.peek(), message)
+	consumeError := createParseError(glox_error.EXPECTED_TOKEN, p.peek(), message)
 	return Token{}, consumeError
 }
 
@@ -618,33 +926,67 @@ func (p *Parser) previous() Token {
 	return p.tokens[p.current-1]
 }
 
-func createParseError(tokenWithError Token, message string) *GloxError {
+func createParseError(code glox_error.Code, tokenWithError Token, message string) *ParseError {
 	if tokenWithError.TokenType == token.EOF {
-		return glox_error.Create(tokenWithError.Line, "at end", message)
+		return &ParseError{Diagnostic: glox_error.CreateAt(code, tokenWithError, "at end", message), IsAtEnd: true}
 	}
-	return glox_error.Create(tokenWithError.Line, fmt.Sprintf(" at '%s' of token type '%s'", tokenWithError.Lexeme, tokenWithError.TokenType), message)
+	where := fmt.Sprintf(" at '%s' of token type '%s'", tokenWithError.Lexeme, tokenWithError.TokenType)
+	return &ParseError{Diagnostic: glox_error.CreateAt(code, tokenWithError, where, message)}
 }
 
+// Points an unclosed delimiter error back at where the delimiter opened
+func noteOpenedAt(err error, opening Token) error {
+	var parseErr *ParseError
+	if errors.As(err, &parseErr) && parseErr.Code == glox_error.EXPECTED_TOKEN {
+		parseErr.AddNote(fmt.Sprintf("'%s' opened here", opening.Lexeme), glox_error.SpanOf(opening))
+	}
+	return err
+}
+
+// Discards tokens until the start of the next statement, so one mistake
+// doesn't cascade into a pile of bogus errors
 func (p *Parser) synchronize() {
+	if p.check(token.RIGHT_BRACE) && p.blockDepth > 0 {
+		// The error was at the brace closing the enclosing block, which still needs it
+		return
+	}
+	// Braces opened by the tokens being skipped, which their own '}' closes
+	skippedBraces := 0
+	if p.check(token.LEFT_BRACE) {
+		skippedBraces++
+	}
 	p.advance()
 
 	for !p.isAtEnd() {
+		// Inside a skipped brace everything belongs to the broken declaration, up to its '}'
+		if skippedBraces > 0 {
+			switch p.peek().TokenType {
+			case token.LEFT_BRACE:
+				skippedBraces++
+			case token.RIGHT_BRACE:
+				skippedBraces--
+			}
+			p.advance()
+			if skippedBraces == 0 {
+				return
+			}
+			continue
+		}
 		if p.previous().TokenType == token.SEMICOLON {
 			return
 		}
 
 		switch p.peek().TokenType {
-		case token.CLASS:
-		case token.FUN:
-		case token.VAR:
-		case token.FOR:
-		case token.IF:
-		case token.WHILE:
-		case token.PRINT:
-		case token.RETURN:
+		case token.CLASS, token.FUN, token.VAR, token.FOR, token.IF, token.WHILE, token.PRINT, token.RETURN:
 			return
+		case token.LEFT_BRACE:
+			skippedBraces++
+		case token.RIGHT_BRACE:
+			if p.blockDepth > 0 {
+				// Leave the brace for the enclosing block to close
+				return
+			}
 		}
 		p.advance()
 	}
-
 }
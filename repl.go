@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bufio"
+	"dsoechting/glox/complete"
+	"dsoechting/glox/parse"
+	"dsoechting/glox/repl"
+	"dsoechting/glox/scanner"
+	"dsoechting/glox/vm"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const (
+	PROMPT              = "> "
+	CONTINUATION_PROMPT = "... "
+)
+
+// Reads statements interactively. Input that stops partway, like an open brace
+// or a trailing operator, continues on the next line until it parses
+func (g *Glox) runPrompt() error {
+	// Scripts read through the same buffer via readLine, so neither steals the other's lines
+	reader, isBuffered := g.options.Stdin.(*bufio.Reader)
+	if !isBuffered {
+		reader = bufio.NewReader(g.options.Stdin)
+	}
+	editor := repl.Create(reader, g.options.Stdout, g.loadHistory())
+	commands := g.replCommands()
+	editor.SetCompleter(func(line string, cursor int) (int, []string) {
+		return g.complete(commands, line, cursor)
+	})
+	// Once is enough, the file won't become writable between lines
+	historyReported := false
+	editor.OnHistoryError(func(historyErr error) {
+		if !historyReported {
+			fmt.Fprintf(g.options.Stderr, "Couldn't save history: %v\n", historyErr)
+			historyReported = true
+		}
+	})
+	if g.terminal != nil {
+		editor.AttachTerminal(g.terminal)
+	}
+
+	pending := ""
+	for {
+		prompt := PROMPT
+		if pending != "" {
+			prompt = CONTINUATION_PROMPT
+		}
+		line, readErr := editor.ReadLine(prompt)
+		if errors.Is(readErr, repl.ErrInterrupted) {
+			pending = ""
+			continue
+		}
+		if readErr == io.EOF {
+			if pending != "" {
+				// Run what there is, so the missing part gets reported
+				g.run(pending)
+			}
+			return nil
+		}
+		if readErr != nil {
+			return readErr
+		}
+
+		if pending == "" && repl.IsCommand(line) {
+			if commandErr := commands.Run(line); commandErr != nil {
+				fmt.Fprintln(g.options.Stderr, commandErr)
+			}
+			continue
+		}
+
+		source := pending + line + "\n"
+		if isIncomplete(source) {
+			pending = source
+			continue
+		}
+		pending = ""
+		g.printEchoes(g.run(source))
+	}
+}
+
+// Echoes what a line's expression statements evaluated to, one value per line.
+// An empty string still gets its line, only statements without a value print nothing
+func (g *Glox) printEchoes(echoes []string) {
+	for _, echo := range echoes {
+		fmt.Fprintln(g.options.Stdout, echo)
+	}
+}
+
+// Completes command names while the first word of a command is typed, and
+// glox code from the live session everywhere else
+func (g *Glox) complete(commands *repl.Commands, line string, cursor int) (int, []string) {
+	before := []rune(line)[:cursor]
+	if repl.IsCommand(line) && !strings.ContainsAny(string(before), " \t") {
+		candidates := []string{}
+		for _, name := range commands.Names() {
+			if strings.HasPrefix(name, string(before)) {
+				// The space lets arguments follow straight on
+				candidates = append(candidates, name+" ")
+			}
+		}
+		return 0, candidates
+	}
+	if g.backend == VM_BACKEND {
+		return complete.Complete(line, cursor, vmScope{globals: g.vm.Globals()})
+	}
+	return complete.Complete(line, cursor, complete.EnvironmentScope(g.interpreter.Environment()))
+}
+
+// Completion over the VM's globals, which are all a REPL line can see
+type vmScope struct {
+	globals map[string]vm.Value
+}
+
+func (s vmScope) Names() []string {
+	names := make([]string, 0, len(s.globals))
+	for name := range s.globals {
+		names = append(names, name)
+	}
+	return names
+}
+
+func (s vmScope) Lookup(name string) (any, bool) {
+	value, isPresent := s.globals[name]
+	return value.Obj, isPresent
+}
+
+// Whether source only fails to parse because it ends too soon
+func isIncomplete(source string) bool {
+	tokens, scanErr := scanner.Create(source).ScanTokens()
+	if scanErr != nil {
+		return false
+	}
+	parser := parse.Create(tokens)
+	_, parseErr := parser.Parse()
+	return parse.IsIncomplete(parseErr)
+}
+
+// History is a convenience, so a missing home directory or unreadable file
+// only costs a warning
+func (g *Glox) loadHistory() *repl.History {
+	path, pathErr := repl.DefaultHistoryPath()
+	if pathErr != nil {
+		path = ""
+	}
+	history, loadErr := repl.LoadHistory(path)
+	if loadErr != nil {
+		fmt.Fprintf(g.options.Stderr, "Couldn't load history: %v\n", loadErr)
+	}
+	return history
+}
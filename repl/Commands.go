@@ -0,0 +1,81 @@
+package repl
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Returned by a command's Run when its arguments don't fit its usage
+var ErrUsage = errors.New("wrong arguments")
+
+// Lines starting with this are commands for the REPL rather than glox code
+const COMMAND_PREFIX = ":"
+
+// A REPL command, typed as :name followed by its arguments
+type Command struct {
+	Name string
+	// How the command is typed, like ":load file.glox"
+	Usage string
+	Help  string
+	// Gets everything after the name, trimmed
+	Run func(args string) error
+}
+
+// The commands a REPL knows, always including :help
+type Commands struct {
+	commands []Command
+	output   io.Writer
+}
+
+func CreateCommands(output io.Writer) *Commands {
+	commands := &Commands{output: output}
+	commands.Add(Command{Name: "help", Usage: ":help", Help: "show these commands", Run: commands.help})
+	return commands
+}
+
+func (c *Commands) Add(command Command) {
+	c.commands = append(c.commands, command)
+}
+
+// Every command's name, with its prefix, like ":env"
+func (c *Commands) Names() []string {
+	names := make([]string, len(c.commands))
+	for index, command := range c.commands {
+		names[index] = COMMAND_PREFIX + command.Name
+	}
+	return names
+}
+
+func IsCommand(line string) bool {
+	return strings.HasPrefix(strings.TrimSpace(line), COMMAND_PREFIX)
+}
+
+// Runs the command line names. Errors are for the user to read
+func (c *Commands) Run(line string) error {
+	text := strings.TrimPrefix(strings.TrimSpace(line), COMMAND_PREFIX)
+	name, args, _ := strings.Cut(text, " ")
+	for _, command := range c.commands {
+		if command.Name != name {
+			continue
+		}
+		runErr := command.Run(strings.TrimSpace(args))
+		if errors.Is(runErr, ErrUsage) {
+			return fmt.Errorf("Usage %s", command.Usage)
+		}
+		return runErr
+	}
+	return fmt.Errorf("Unknown command '%s%s', try %shelp", COMMAND_PREFIX, name, COMMAND_PREFIX)
+}
+
+func (c *Commands) help(args string) error {
+	width := 0
+	for _, command := range c.commands {
+		width = max(width, len(command.Usage))
+	}
+	for _, command := range c.commands {
+		fmt.Fprintf(c.output, "%-*s  %s\n", width, command.Usage, command.Help)
+	}
+	return nil
+}
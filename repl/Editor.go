@@ -0,0 +1,296 @@
+package repl
+
+import (
+	"bufio"
+	"dsoechting/glox/complete"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Returned by ReadLine when Ctrl-C throws the line away
+var ErrInterrupted = errors.New("interrupted")
+
+// Control keys, as a terminal in raw mode sends them
+const (
+	CTRL_A    = 1
+	CTRL_B    = 2
+	CTRL_C    = 3
+	CTRL_D    = 4
+	CTRL_E    = 5
+	CTRL_F    = 6
+	CTRL_K    = 11
+	CTRL_N    = 14
+	CTRL_P    = 16
+	CTRL_U    = 21
+	ESCAPE    = 27
+	BACKSPACE = 127
+)
+
+// Reads lines from a terminal with arrow key editing and history. When input
+// isn't a terminal, lines are read as they come
+type Editor struct {
+	input   *bufio.Reader
+	output  io.Writer
+	history *History
+	// Put into raw mode while a line is being read, nil unless attached
+	terminal  *os.File
+	isEditing bool
+	// Called on tab, possibly nil
+	completer Completer
+	// Called when a line can't be saved to the history file, possibly nil
+	onHistoryError func(error)
+}
+
+// Completes the word ending at cursor, a rune index into line. Returns where
+// the word starts and what it could become
+type Completer func(line string, cursor int) (int, []string)
+
+// Lines are read as typed until a terminal is attached or editing is enabled
+func Create(input *bufio.Reader, output io.Writer, history *History) *Editor {
+	return &Editor{input: input, output: output, history: history}
+}
+
+// Edits lines when terminal, the file input reads from, is a terminal. Reports whether it was
+func (e *Editor) AttachTerminal(terminal *os.File) bool {
+	if !isTerminal(terminal.Fd()) {
+		return false
+	}
+	e.terminal = terminal
+	e.isEditing = true
+	return true
+}
+
+// Handles keys the way a terminal in raw mode sends them, without touching
+// any terminal settings. For input that is already raw
+func (e *Editor) EnableEditing() {
+	e.isEditing = true
+}
+
+// Tab completes with completer. Without one, or at the start of a line, tab indents
+func (e *Editor) SetCompleter(completer Completer) {
+	e.completer = completer
+}
+
+// A history file that can't be written shouldn't stop the session, so the
+// error goes to report instead of ReadLine's caller
+func (e *Editor) OnHistoryError(report func(error)) {
+	e.onHistoryError = report
+}
+
+func (e *Editor) History() *History {
+	return e.history
+}
+
+// Shows prompt and reads one line, without its newline. io.EOF means the input
+// is finished, or Ctrl-D was pressed on an empty line
+func (e *Editor) ReadLine(prompt string) (string, error) {
+	if !e.isEditing {
+		fmt.Fprint(e.output, prompt)
+		line, readErr := e.input.ReadString('\n')
+		if readErr != nil && line == "" {
+			return "", readErr
+		}
+		return strings.TrimRight(line, "\r\n"), nil
+	}
+
+	if e.terminal != nil {
+		restore, rawErr := makeRaw(e.terminal.Fd())
+		if rawErr != nil {
+			return "", rawErr
+		}
+		// Scripts run with the terminal as it was, so Ctrl-C still stops them
+		defer restore()
+	}
+	line, editErr := e.edit(prompt)
+	if editErr == nil {
+		if addErr := e.history.Add(line); addErr != nil && e.onHistoryError != nil {
+			e.onHistoryError(addErr)
+		}
+	}
+	return line, editErr
+}
+
+// The line being edited
+type lineState struct {
+	prompt string
+	buffer []rune
+	cursor int
+	// Which history entry is showing, len(entries) for the new line
+	historyIndex int
+	// The new line, kept while browsing history
+	draft []rune
+}
+
+func (e *Editor) edit(prompt string) (string, error) {
+	state := &lineState{prompt: prompt, historyIndex: len(e.history.Entries())}
+	e.refresh(state)
+	for {
+		key, _, readErr := e.input.ReadRune()
+		if readErr != nil {
+			if readErr == io.EOF && len(state.buffer) > 0 {
+				fmt.Fprintln(e.output)
+				return string(state.buffer), nil
+			}
+			return "", readErr
+		}
+
+		switch key {
+		case '\r', '\n':
+			fmt.Fprintln(e.output)
+			return string(state.buffer), nil
+		case CTRL_C:
+			fmt.Fprintln(e.output, "^C")
+			return "", ErrInterrupted
+		case CTRL_D:
+			if len(state.buffer) == 0 {
+				fmt.Fprintln(e.output)
+				return "", io.EOF
+			}
+			state.deleteForward()
+		case BACKSPACE, '\b':
+			state.deleteBackward()
+		case CTRL_A:
+			state.cursor = 0
+		case CTRL_E:
+			state.cursor = len(state.buffer)
+		case CTRL_B:
+			state.cursor = max(0, state.cursor-1)
+		case CTRL_F:
+			state.cursor = min(len(state.buffer), state.cursor+1)
+		case CTRL_K:
+			state.buffer = state.buffer[:state.cursor]
+		case CTRL_U:
+			state.buffer = state.buffer[state.cursor:]
+			state.cursor = 0
+		case CTRL_P:
+			e.browseHistory(state, -1)
+		case CTRL_N:
+			e.browseHistory(state, 1)
+		case ESCAPE:
+			e.escapeSequence(state)
+		case '\t':
+			e.complete(state)
+		default:
+			if key >= ' ' {
+				state.insert(key)
+			}
+		}
+		e.refresh(state)
+	}
+}
+
+// Handles the sequences arrow, Home, End and Delete keys send, like ESC [ A.
+// Unknown ones are read through and ignored
+func (e *Editor) escapeSequence(state *lineState) {
+	kind, _ := e.input.ReadByte()
+	if kind != '[' && kind != 'O' {
+		return
+	}
+	parameter := ""
+	for {
+		final, readErr := e.input.ReadByte()
+		if readErr != nil {
+			return
+		}
+		if final >= '0' && final <= '9' || final == ';' {
+			parameter += string(final)
+			continue
+		}
+		switch {
+		case final == 'A':
+			e.browseHistory(state, -1)
+		case final == 'B':
+			e.browseHistory(state, 1)
+		case final == 'C':
+			state.cursor = min(len(state.buffer), state.cursor+1)
+		case final == 'D':
+			state.cursor = max(0, state.cursor-1)
+		case final == 'H', final == '~' && (parameter == "1" || parameter == "7"):
+			state.cursor = 0
+		case final == 'F', final == '~' && (parameter == "4" || parameter == "8"):
+			state.cursor = len(state.buffer)
+		case final == '~' && parameter == "3":
+			state.deleteForward()
+		}
+		return
+	}
+}
+
+// Fills in as much of the word as every candidate agrees on. When that adds
+// nothing, the candidates are listed under the line instead
+func (e *Editor) complete(state *lineState) {
+	if e.completer == nil || strings.TrimSpace(string(state.buffer[:state.cursor])) == "" {
+		state.insert(' ', ' ')
+		return
+	}
+	start, candidates := e.completer(string(state.buffer), state.cursor)
+	if len(candidates) == 0 {
+		return
+	}
+	word := state.buffer[start:state.cursor]
+	completion := []rune(complete.CommonPrefix(candidates))
+	if len(completion) > len(word) {
+		state.insert(completion[len(word):]...)
+		return
+	}
+	if len(candidates) > 1 {
+		listed := make([]string, len(candidates))
+		for index, candidate := range candidates {
+			listed[index] = strings.TrimSpace(candidate)
+		}
+		fmt.Fprintf(e.output, "\n%s\n", strings.Join(listed, "  "))
+	}
+}
+
+// Moves through history by step, -1 for older and 1 for newer
+func (e *Editor) browseHistory(state *lineState, step int) {
+	entries := e.history.Entries()
+	next := state.historyIndex + step
+	if next < 0 || next > len(entries) {
+		return
+	}
+	if state.historyIndex == len(entries) {
+		state.draft = state.buffer
+	}
+	state.historyIndex = next
+	if next == len(entries) {
+		state.buffer = state.draft
+	} else {
+		state.buffer = []rune(entries[next])
+	}
+	state.cursor = len(state.buffer)
+}
+
+// Redraws the prompt and line, then puts the cursor back where it belongs
+func (e *Editor) refresh(state *lineState) {
+	fmt.Fprintf(e.output, "\r%s%s\x1b[K", state.prompt, string(state.buffer))
+	if back := len(state.buffer) - state.cursor; back > 0 {
+		fmt.Fprintf(e.output, "\x1b[%dD", back)
+	}
+}
+
+func (s *lineState) insert(keys ...rune) {
+	buffer := make([]rune, 0, len(s.buffer)+len(keys))
+	buffer = append(buffer, s.buffer[:s.cursor]...)
+	buffer = append(buffer, keys...)
+	s.buffer = append(buffer, s.buffer[s.cursor:]...)
+	s.cursor += len(keys)
+}
+
+func (s *lineState) deleteBackward() {
+	if s.cursor == 0 {
+		return
+	}
+	s.buffer = append(s.buffer[:s.cursor-1:s.cursor-1], s.buffer[s.cursor:]...)
+	s.cursor--
+}
+
+func (s *lineState) deleteForward() {
+	if s.cursor == len(s.buffer) {
+		return
+	}
+	s.buffer = append(s.buffer[:s.cursor:s.cursor], s.buffer[s.cursor+1:]...)
+}
@@ -0,0 +1,87 @@
+package repl
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Older lines are dropped from the history file once it grows past this
+const MAX_HISTORY = 1000
+
+const HISTORY_FILE = ".glox_history"
+
+// Lines entered so far, oldest first, kept in a file so they last between sessions
+type History struct {
+	entries []string
+	// Empty when the history only lives in memory
+	path string
+}
+
+// The history file in the user's home directory
+func DefaultHistoryPath() (string, error) {
+	home, homeErr := os.UserHomeDir()
+	if homeErr != nil {
+		return "", homeErr
+	}
+	return filepath.Join(home, HISTORY_FILE), nil
+}
+
+// Reads the history saved at path. A missing file is an empty history, which
+// is created on the first Add. An empty path keeps the history in memory only
+func LoadHistory(path string) (*History, error) {
+	history := &History{path: path}
+	if path == "" {
+		return history, nil
+	}
+	data, readErr := os.ReadFile(path)
+	if errors.Is(readErr, fs.ErrNotExist) {
+		return history, nil
+	}
+	if readErr != nil {
+		return history, readErr
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if line != "" {
+			history.entries = append(history.entries, line)
+		}
+	}
+	if len(history.entries) > MAX_HISTORY {
+		history.entries = history.entries[len(history.entries)-MAX_HISTORY:]
+		return history, history.rewrite()
+	}
+	return history, nil
+}
+
+func (h *History) Entries() []string {
+	return h.entries
+}
+
+// Records a line, skipping blank ones and repeats of the line before. The line
+// is appended to the file straight away, so nothing is lost if glox is killed
+func (h *History) Add(line string) error {
+	if strings.TrimSpace(line) == "" || len(h.entries) > 0 && h.entries[len(h.entries)-1] == line {
+		return nil
+	}
+	h.entries = append(h.entries, line)
+	if h.path == "" {
+		return nil
+	}
+	if len(h.entries) > MAX_HISTORY {
+		h.entries = h.entries[len(h.entries)-MAX_HISTORY:]
+		return h.rewrite()
+	}
+	file, openErr := os.OpenFile(h.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if openErr != nil {
+		return openErr
+	}
+	_, writeErr := file.WriteString(line + "\n")
+	closeErr := file.Close()
+	return errors.Join(writeErr, closeErr)
+}
+
+func (h *History) rewrite() error {
+	return os.WriteFile(h.path, []byte(strings.Join(h.entries, "\n")+"\n"), 0o600)
+}
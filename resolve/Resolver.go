@@ -0,0 +1,349 @@
+package resolve
+
+import (
+	"dsoechting/glox/ast"
+	glox_error "dsoechting/glox/error"
+	"dsoechting/glox/interpret"
+	"dsoechting/glox/token"
+	"errors"
+	"fmt"
+)
+
+type Interpreter = interpret.Interpreter
+type Stmt = ast.Stmt
+type BlockStmt = ast.BlockStmt
+type ClassStmt = ast.ClassStmt
+type ExpressionStmt = ast.ExpressionStmt
+type FunctionStmt = ast.FunctionStmt
+type IfStmt = ast.IfStmt
+type PrintStmt = ast.PrintStmt
+type ReturnStmt = ast.ReturnStmt
+type VarStmt = ast.VarStmt
+type WhileStmt = ast.WhileStmt
+type Expr = ast.Expr
+type TernaryExpr = ast.TernaryExpr
+type AssignExpr = ast.AssignExpr
+type BinaryExpr = ast.BinaryExpr
+type CallExpr = ast.CallExpr
+type GetExpr = ast.GetExpr
+type GroupingExpr = ast.GroupingExpr
+type LiteralExpr = ast.LiteralExpr
+type LogicalExpr = ast.LogicalExpr
+type SetExpr = ast.SetExpr
+type SuperExpr = ast.SuperExpr
+type ThisExpr = ast.ThisExpr
+type UnaryExpr = ast.UnaryExpr
+type VariableExpr = ast.VariableExpr
+type Token = token.Token
+type ResolveError = glox_error.ResolveError
+
+type FunctionType int
+
+const (
+	NONE FunctionType = iota
+	FUNCTION
+	INITIALIZER
+	METHOD
+)
+
+type ClassType int
+
+const (
+	NO_CLASS ClassType = iota
+	CLASS
+	SUBCLASS
+)
+
+// Implements ExprVisitor and StmtVisitor
+// Walks the tree once before it runs, telling the interpreter how many scopes
+// out each local variable lives. Globals are left unresolved and looked up dynamically
+type Resolver struct {
+	interpreter *Interpreter
+	// Each scope maps a name to whether its initializer has finished resolving
+	scopes          []map[string]bool
+	currentFunction FunctionType
+	currentClass    ClassType
+	errors          []error
+}
+
+func Create(interpreter *Interpreter) *Resolver {
+	return &Resolver{
+		interpreter:     interpreter,
+		scopes:          []map[string]bool{},
+		currentFunction: NONE,
+		currentClass:    NO_CLASS,
+	}
+}
+
+// Reports every static error found, not just the first one
+func (r *Resolver) Resolve(statements []Stmt) error {
+	r.resolveStatements(statements)
+	return errors.Join(r.errors...)
+}
+
+func (r *Resolver) VisitBlock(stmt *BlockStmt) (any, error) {
+	r.beginScope()
+	r.resolveStatements(stmt.Statements)
+	r.endScope()
+	return nil, nil
+}
+
+func (r *Resolver) VisitClass(stmt *ClassStmt) (any, error) {
+	enclosingClass := r.currentClass
+	r.currentClass = CLASS
+
+	r.declare(stmt.Name)
+	r.define(stmt.Name)
+
+	if stmt.Superclass != nil {
+		if stmt.Name.Lexeme == stmt.Superclass.Name.Lexeme {
+			r.addError(glox_error.INHERITS_FROM_ITSELF, stmt.Superclass.Name, "A class can't inherit from itself.")
+		}
+		r.currentClass = SUBCLASS
+		r.resolveExpr(stmt.Superclass)
+
+		r.beginScope()
+		r.scopes[len(r.scopes)-1]["super"] = true
+	}
+
+	// Methods close over a scope that holds "this"
+	r.beginScope()
+	r.scopes[len(r.scopes)-1]["this"] = true
+	for _, method := range stmt.Methods {
+		declaration := METHOD
+		if method.Name.Lexeme == "init" {
+			declaration = INITIALIZER
+		}
+		r.resolveFunction(method, declaration)
+	}
+	r.endScope()
+
+	if stmt.Superclass != nil {
+		r.endScope()
+	}
+
+	r.currentClass = enclosingClass
+	return nil, nil
+}
+
+func (r *Resolver) VisitExpression(stmt *ExpressionStmt) (any, error) {
+	r.resolveExpr(stmt.Expression)
+	return nil, nil
+}
+
+func (r *Resolver) VisitFunction(stmt *FunctionStmt) (any, error) {
+	// Define eagerly so the function can refer to itself recursively
+	r.declare(stmt.Name)
+	r.define(stmt.Name)
+
+	r.resolveFunction(stmt, FUNCTION)
+	return nil, nil
+}
+
+func (r *Resolver) VisitIf(stmt *IfStmt) (any, error) {
+	r.resolveExpr(stmt.Condition)
+	r.resolveStmt(stmt.ThenBranch)
+	if stmt.ElseBranch != nil {
+		r.resolveStmt(stmt.ElseBranch)
+	}
+	return nil, nil
+}
+
+func (r *Resolver) VisitPrint(stmt *PrintStmt) (any, error) {
+	r.resolveExpr(stmt.Expression)
+	return nil, nil
+}
+
+func (r *Resolver) VisitReturn(stmt *ReturnStmt) (any, error) {
+	if r.currentFunction == NONE {
+		r.addError(glox_error.TOP_LEVEL_RETURN, stmt.Keyword, "Can't return from top-level code.")
+	}
+	if stmt.Value != nil {
+		if r.currentFunction == INITIALIZER {
+			r.addError(glox_error.RETURN_VALUE_FROM_INITIALIZER, stmt.Keyword, "Can't return a value from an initializer.")
+		}
+		r.resolveExpr(stmt.Value)
+	}
+	return nil, nil
+}
+
+func (r *Resolver) VisitVar(stmt *VarStmt) (any, error) {
+	r.declare(stmt.Name)
+	if stmt.Initializer != nil {
+		r.resolveExpr(stmt.Initializer)
+	}
+	r.define(stmt.Name)
+	return nil, nil
+}
+
+func (r *Resolver) VisitWhile(stmt *WhileStmt) (any, error) {
+	r.resolveExpr(stmt.Condition)
+	r.resolveStmt(stmt.Body)
+	return nil, nil
+}
+
+func (r *Resolver) VisitTernary(expr *TernaryExpr) (any, error) {
+	r.resolveExpr(expr.First)
+	r.resolveExpr(expr.Second)
+	r.resolveExpr(expr.Third)
+	return nil, nil
+}
+
+func (r *Resolver) VisitAssign(expr *AssignExpr) (any, error) {
+	r.resolveExpr(expr.Value)
+	r.resolveLocal(expr, expr.Name)
+	return nil, nil
+}
+
+func (r *Resolver) VisitBinary(expr *BinaryExpr) (any, error) {
+	r.resolveExpr(expr.Left)
+	r.resolveExpr(expr.Right)
+	return nil, nil
+}
+
+func (r *Resolver) VisitCall(expr *CallExpr) (any, error) {
+	r.resolveExpr(expr.Callee)
+	for _, argument := range expr.Arguments {
+		r.resolveExpr(argument)
+	}
+	return nil, nil
+}
+
+func (r *Resolver) VisitGet(expr *GetExpr) (any, error) {
+	// Properties are looked up dynamically, so only the object gets resolved
+	r.resolveExpr(expr.Object)
+	return nil, nil
+}
+
+func (r *Resolver) VisitGrouping(expr *GroupingExpr) (any, error) {
+	r.resolveExpr(expr.Expression)
+	return nil, nil
+}
+
+func (r *Resolver) VisitLiteral(expr *LiteralExpr) (any, error) {
+	return nil, nil
+}
+
+func (r *Resolver) VisitLogical(expr *LogicalExpr) (any, error) {
+	r.resolveExpr(expr.Left)
+	r.resolveExpr(expr.Right)
+	return nil, nil
+}
+
+func (r *Resolver) VisitSet(expr *SetExpr) (any, error) {
+	r.resolveExpr(expr.Value)
+	r.resolveExpr(expr.Object)
+	return nil, nil
+}
+
+func (r *Resolver) VisitSuper(expr *SuperExpr) (any, error) {
+	if r.currentClass == NO_CLASS {
+		r.addError(glox_error.SUPER_OUTSIDE_CLASS, expr.Keyword, "Can't use 'super' outside of a class.")
+		return nil, nil
+	}
+	if r.currentClass != SUBCLASS {
+		r.addError(glox_error.SUPER_WITHOUT_SUPERCLASS, expr.Keyword, "Can't use 'super' in a class with no superclass.")
+		return nil, nil
+	}
+	r.resolveLocal(expr, expr.Keyword)
+	return nil, nil
+}
+
+func (r *Resolver) VisitThis(expr *ThisExpr) (any, error) {
+	if r.currentClass == NO_CLASS {
+		r.addError(glox_error.THIS_OUTSIDE_CLASS, expr.Keyword, "Can't use 'this' outside of a class.")
+		return nil, nil
+	}
+	r.resolveLocal(expr, expr.Keyword)
+	return nil, nil
+}
+
+func (r *Resolver) VisitUnary(expr *UnaryExpr) (any, error) {
+	r.resolveExpr(expr.Right)
+	return nil, nil
+}
+
+func (r *Resolver) VisitVariable(expr *VariableExpr) (any, error) {
+	if len(r.scopes) > 0 {
+		defined, isDeclared := r.scopes[len(r.scopes)-1][expr.Name.Lexeme]
+		if isDeclared && !defined {
+			r.addError(glox_error.READ_IN_OWN_INITIALIZER, expr.Name, "Can't read local variable in its own initializer.")
+		}
+	}
+	r.resolveLocal(expr, expr.Name)
+	return nil, nil
+}
+
+func (r *Resolver) resolveStatements(statements []Stmt) {
+	for _, stmt := range statements {
+		r.resolveStmt(stmt)
+	}
+}
+
+func (r *Resolver) resolveStmt(stmt Stmt) {
+	stmt.Accept(r)
+}
+
+func (r *Resolver) resolveExpr(expr Expr) {
+	expr.Accept(r)
+}
+
+func (r *Resolver) resolveFunction(function *FunctionStmt, functionType FunctionType) {
+	enclosingFunction := r.currentFunction
+	r.currentFunction = functionType
+
+	r.beginScope()
+	for _, param := range function.Params {
+		r.declare(param)
+		r.define(param)
+	}
+	r.resolveStatements(function.Body)
+	r.endScope()
+
+	r.currentFunction = enclosingFunction
+}
+
+// Walk outwards from the innermost scope. If we never find the name, it's a global
+func (r *Resolver) resolveLocal(expr Expr, name Token) {
+	for i := len(r.scopes) - 1; i >= 0; i-- {
+		if _, isPresent := r.scopes[i][name.Lexeme]; isPresent {
+			r.interpreter.Resolve(expr, len(r.scopes)-1-i)
+			return
+		}
+	}
+}
+
+func (r *Resolver) beginScope() {
+	r.scopes = append(r.scopes, map[string]bool{})
+}
+
+func (r *Resolver) endScope() {
+	r.scopes = r.scopes[:len(r.scopes)-1]
+}
+
+func (r *Resolver) declare(name Token) {
+	if len(r.scopes) == 0 {
+		return
+	}
+	scope := r.scopes[len(r.scopes)-1]
+	if _, isPresent := scope[name.Lexeme]; isPresent {
+		r.addError(glox_error.ALREADY_DECLARED, name, "Already a variable with this name in this scope.")
+	}
+	scope[name.Lexeme] = false
+}
+
+func (r *Resolver) define(name Token) {
+	if len(r.scopes) == 0 {
+		return
+	}
+	r.scopes[len(r.scopes)-1][name.Lexeme] = true
+}
+
+func (r *Resolver) addError(code glox_error.Code, tokenWithError Token, message string) {
+	r.errors = append(r.errors, createResolveError(code, tokenWithError, message))
+}
+
+func createResolveError(code glox_error.Code, tokenWithError Token, message string) *ResolveError {
+	where := fmt.Sprintf(" at '%s'", tokenWithError.Lexeme)
+	return &ResolveError{Diagnostic: glox_error.CreateAt(code, tokenWithError, where, message)}
+}
@@ -14,6 +14,15 @@ type Scanner struct {
 	start   int
 	current int
 	line    int
+	// Offset of the first byte of the current line
+	lineStart int
+	// Line and column of the token being scanned
+	startLine   int
+	startColumn int
+	// Comments waiting for the next token to carry them
+	comments []token.Comment
+	// Line the last token ended on, to tell trailing comments from ones on their own line
+	lastTokenLine int
 }
 
 func Create(source string) *Scanner {
@@ -31,13 +40,16 @@ func (s *Scanner) ScanTokens() ([]token.Token, error) {
 
 	for !s.isAtEnd() {
 		s.start = s.current
+		s.startLine = s.line
+		s.startColumn = s.current - s.lineStart + 1
 		err := s.scanToken()
 		if err != nil {
 			return nil, err
 		}
 
 	}
-	newToken := token.Create(token.EOF, "", nil, s.line)
+	newToken := token.Create(token.EOF, "", nil, s.line).At(s.current-s.lineStart+1, s.current, s.current)
+	newToken.Comments = s.comments
 	s.tokens = append(s.tokens, *newToken)
 	return s.tokens, nil
 }
@@ -119,13 +131,17 @@ func (s *Scanner) scanToken() error {
 			for s.peek() != '\n' && !s.isAtEnd() {
 				s.advance()
 			}
+			s.addComment()
 			// Block comments
 		} else if s.match('*') {
-			for !(s.peek() == '*' && s.peekNext() == '/') {
-				s.advance()
+			for !(s.peek() == '*' && s.peekNext() == '/') && !s.isAtEnd() {
+				if s.advance() == '\n' {
+					s.newLine()
+				}
 			}
 			s.match('*')
 			s.match('/')
+			s.addComment()
 		} else {
 			s.addTokenSimple(token.SLASH)
 		}
@@ -135,19 +151,18 @@ func (s *Scanner) scanToken() error {
 		// Ignore whitespace
 		break
 	case '\n':
-		s.line++
+		s.newLine()
 		break
 	case '"':
-		s.scanString()
-		break
+		return s.scanString()
 	default:
 		if isDigit(currentRune) {
-			s.number()
+			return s.number()
 		} else if isAlphaNumeric(currentRune) {
 			s.identifier()
 		} else {
 			errorString := fmt.Sprintf("Unexpected character: %c", currentRune)
-			return glox_error.Create(s.line, "", errorString)
+			return s.errorAt(glox_error.UNEXPECTED_CHARACTER, s.start, s.current, errorString)
 		}
 	}
 	return nil
@@ -192,7 +207,7 @@ func (s *Scanner) number() error {
 	}
 	value, err := strconv.ParseFloat(s.source[s.start:s.current], 64)
 	if err != nil {
-		return glox_error.Create(s.line, "", "Could not parse number")
+		return s.errorAt(glox_error.INVALID_NUMBER, s.start, s.current, "Could not parse number")
 	}
 	s.addToken(token.NUMBER, value)
 	return nil
@@ -200,13 +215,13 @@ func (s *Scanner) number() error {
 
 func (s *Scanner) scanString() error {
 	for s.peek() != '"' && !s.isAtEnd() {
-		if s.peek() == '\n' {
-			s.line++
+		if s.advance() == '\n' {
+			s.newLine()
 		}
-		s.advance()
 	}
 	if s.isAtEnd() {
-		return glox_error.Create(s.line, "", "Unterminated string literal")
+		// Point at the opening quote, the end of the file says little
+		return s.errorAt(glox_error.UNTERMINATED_STRING, s.start, s.start+1, "Unterminated string literal")
 	}
 	s.advance()
 
@@ -255,10 +270,39 @@ func (s *Scanner) addTokenSimple(tokenType token.TokenType) {
 
 func (s *Scanner) addToken(tokenType token.TokenType, literal any) {
 	text := s.source[s.start:s.current]
-	newToken := token.Create(tokenType, text, literal, s.line)
+	newToken := token.Create(tokenType, text, literal, s.startLine).At(s.startColumn, s.start, s.current)
+	newToken.Comments = s.comments
+	s.comments = nil
+	s.lastTokenLine = s.line
 	s.tokens = append(s.tokens, *newToken)
 }
 
+func (s *Scanner) addComment() {
+	s.comments = append(s.comments, token.Comment{
+		Text:       s.source[s.start:s.current],
+		Line:       s.startLine,
+		Start:      s.start,
+		End:        s.current,
+		IsTrailing: len(s.tokens) > 0 && s.lastTokenLine == s.startLine,
+	})
+}
+
+// Call after consuming a newline
+func (s *Scanner) newLine() {
+	s.line++
+	s.lineStart = s.current
+}
+
+func (s *Scanner) errorAt(code glox_error.Code, start int, end int, message string) *glox_error.ScanError {
+	diagnostic := glox_error.Create(code, s.startLine, "", message)
+	diagnostic.Span = glox_error.Span{
+		Column: s.startColumn,
+		Start:  start,
+		End:    end,
+	}
+	return &glox_error.ScanError{Diagnostic: diagnostic}
+}
+
 func (s *Scanner) PrintTokens() {
 	for _, token := range s.tokens {
 		log.Println(token)
@@ -0,0 +1,462 @@
+package scope
+
+import (
+	"dsoechting/glox/ast"
+	glox_error "dsoechting/glox/error"
+	"dsoechting/glox/token"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+type Expr = ast.Expr
+type Stmt = ast.Stmt
+type ExpressionStmt = ast.ExpressionStmt
+type IfStmt = ast.IfStmt
+type PrintStmt = ast.PrintStmt
+type WhileStmt = ast.WhileStmt
+type VarStmt = ast.VarStmt
+type BlockStmt = ast.BlockStmt
+type ClassStmt = ast.ClassStmt
+type FunctionStmt = ast.FunctionStmt
+type ReturnStmt = ast.ReturnStmt
+type TernaryExpr = ast.TernaryExpr
+type AssignExpr = ast.AssignExpr
+type BinaryExpr = ast.BinaryExpr
+type CallExpr = ast.CallExpr
+type GetExpr = ast.GetExpr
+type SetExpr = ast.SetExpr
+type SuperExpr = ast.SuperExpr
+type ThisExpr = ast.ThisExpr
+type LogicalExpr = ast.LogicalExpr
+type UnaryExpr = ast.UnaryExpr
+type VariableExpr = ast.VariableExpr
+type GroupingExpr = ast.GroupingExpr
+type LiteralExpr = ast.LiteralExpr
+type Token = token.Token
+
+type SymbolKind int
+
+const (
+	VARIABLE SymbolKind = iota
+	PARAMETER
+	FUNCTION
+	METHOD
+	CLASS
+	NATIVE
+)
+
+// Globals every script starts with
+var Builtins = []string{"clock", "readLine"}
+
+// Something a name can refer to
+type Symbol struct {
+	Name string
+	Kind SymbolKind
+	// The name token at the declaration, zero for builtins
+	Declaration Token
+	// One line summary, like "fun add(a, b)"
+	Detail string
+	// Byte offsets of the whole declaration, from its keyword to its closing brace or ';'
+	Start int
+	End   int
+	// Declarations nested inside this one, for outlines
+	Children []*Symbol
+	// Every use of the name that resolves here, not counting the declaration
+	References []Token
+	// The scope depth it was declared at, 0 for globals
+	Depth int
+	// An outer symbol of the same name that this one hides, if any
+	Shadows *Symbol
+}
+
+// Reports whether the symbol was written in the source, rather than built in
+func (s *Symbol) IsDeclared() bool {
+	return s.Kind != NATIVE
+}
+
+// A name in the source and the symbol it resolves to
+type Occurrence struct {
+	Token         Token
+	Symbol        *Symbol
+	IsDeclaration bool
+	// Set when the name is only being assigned to, not read
+	IsAssignment bool
+}
+
+// A use of a name not found in any local scope
+type unresolvedName struct {
+	name         Token
+	isAssignment bool
+}
+
+type Analysis struct {
+	// Top level declarations, with nested ones as their children
+	Symbols []*Symbol
+	// Every declared symbol, in source order
+	All []*Symbol
+	// Names that resolve to a symbol, sorted by position
+	Occurrences []Occurrence
+	// Uses of names never declared, as warnings
+	Diagnostics []error
+}
+
+// Finds the symbol whose name covers the byte offset, either at a use or at its declaration
+func (a *Analysis) SymbolAt(offset int) (*Symbol, bool) {
+	index := sort.Search(len(a.Occurrences), func(i int) bool {
+		return a.Occurrences[i].Token.End >= offset
+	})
+	// Names never overlap, so only the first one ending at or after offset can cover it
+	if index == len(a.Occurrences) || a.Occurrences[index].Token.Start > offset {
+		return nil, false
+	}
+	return a.Occurrences[index].Symbol, true
+}
+
+// Implements ExprVisitor and StmtVisitor
+// Walks the tree binding every name to its declaration, the way the resolver
+// does, but remembering what it found for editor tooling
+type Analyzer struct {
+	tokens  []Token
+	scopes  []map[string]*Symbol
+	globals map[string]*Symbol
+	// Symbol that new declarations nest under, nil at the top level
+	container *Symbol
+	// Uses of names not found in any local scope, settled once every global is known
+	unresolved []unresolvedName
+	analysis   *Analysis
+}
+
+// tokens are the ones the statements were parsed from, used to find declaration extents
+func Create(tokens []Token) *Analyzer {
+	globals := map[string]*Symbol{}
+	for _, name := range Builtins {
+		globals[name] = &Symbol{Name: name, Kind: NATIVE, Detail: fmt.Sprintf("native fn %s()", name)}
+	}
+	return &Analyzer{
+		tokens:   tokens,
+		globals:  globals,
+		analysis: &Analysis{},
+	}
+}
+
+func (a *Analyzer) Analyze(statements []Stmt) *Analysis {
+	a.walkStatements(statements)
+
+	// Globals can be used above their declaration from inside functions, so
+	// these are only looked up now that the whole file has been seen
+	for _, unresolved := range a.unresolved {
+		name := unresolved.name
+		symbol, isPresent := a.globals[name.Lexeme]
+		if !isPresent {
+			diagnostic := glox_error.CreateAt(glox_error.UNDEFINED_VARIABLE, name, fmt.Sprintf(" at '%s'", name.Lexeme), fmt.Sprintf("Undefined variable '%s'.", name.Lexeme))
+			diagnostic.Severity = glox_error.WARNING
+			a.analysis.Diagnostics = append(a.analysis.Diagnostics, &glox_error.ResolveError{Diagnostic: diagnostic})
+			continue
+		}
+		a.reference(name, symbol, unresolved.isAssignment)
+	}
+
+	sort.SliceStable(a.analysis.Occurrences, func(i, j int) bool {
+		return a.analysis.Occurrences[i].Token.Start < a.analysis.Occurrences[j].Token.Start
+	})
+	return a.analysis
+}
+
+func (a *Analyzer) VisitBlock(stmt *BlockStmt) (any, error) {
+	a.beginScope()
+	a.walkStatements(stmt.Statements)
+	a.endScope()
+	return nil, nil
+}
+
+func (a *Analyzer) VisitClass(stmt *ClassStmt) (any, error) {
+	detail := "class " + stmt.Name.Lexeme
+	if stmt.Superclass != nil {
+		detail += " < " + stmt.Superclass.Name.Lexeme
+		a.walkExpr(stmt.Superclass)
+	}
+	class := a.declare(stmt.Name, CLASS, detail)
+
+	enclosing := a.container
+	a.container = class
+	for _, method := range stmt.Methods {
+		symbol := a.newSymbol(method.Name, METHOD, fmt.Sprintf("method %s.%s(%s)", stmt.Name.Lexeme, method.Name.Lexeme, parameterList(method)))
+		a.addOccurrence(method.Name, symbol, true)
+		a.walkFunction(method, symbol)
+	}
+	a.container = enclosing
+	return nil, nil
+}
+
+func (a *Analyzer) VisitExpression(stmt *ExpressionStmt) (any, error) {
+	a.walkExpr(stmt.Expression)
+	return nil, nil
+}
+
+func (a *Analyzer) VisitFunction(stmt *FunctionStmt) (any, error) {
+	// Declared before the body so the function can call itself
+	symbol := a.declare(stmt.Name, FUNCTION, fmt.Sprintf("fun %s(%s)", stmt.Name.Lexeme, parameterList(stmt)))
+	a.walkFunction(stmt, symbol)
+	return nil, nil
+}
+
+func (a *Analyzer) VisitIf(stmt *IfStmt) (any, error) {
+	a.walkExpr(stmt.Condition)
+	a.walkStmt(stmt.ThenBranch)
+	if stmt.ElseBranch != nil {
+		a.walkStmt(stmt.ElseBranch)
+	}
+	return nil, nil
+}
+
+func (a *Analyzer) VisitPrint(stmt *PrintStmt) (any, error) {
+	a.walkExpr(stmt.Expression)
+	return nil, nil
+}
+
+func (a *Analyzer) VisitReturn(stmt *ReturnStmt) (any, error) {
+	if stmt.Value != nil {
+		a.walkExpr(stmt.Value)
+	}
+	return nil, nil
+}
+
+func (a *Analyzer) VisitVar(stmt *VarStmt) (any, error) {
+	// The initializer sees any outer variable of the same name
+	if stmt.Initializer != nil {
+		a.walkExpr(stmt.Initializer)
+	}
+	a.declare(stmt.Name, VARIABLE, "var "+stmt.Name.Lexeme)
+	return nil, nil
+}
+
+func (a *Analyzer) VisitWhile(stmt *WhileStmt) (any, error) {
+	a.walkExpr(stmt.Condition)
+	a.walkStmt(stmt.Body)
+	return nil, nil
+}
+
+func (a *Analyzer) VisitTernary(expr *TernaryExpr) (any, error) {
+	a.walkExpr(expr.First)
+	a.walkExpr(expr.Second)
+	a.walkExpr(expr.Third)
+	return nil, nil
+}
+
+func (a *Analyzer) VisitAssign(expr *AssignExpr) (any, error) {
+	a.walkExpr(expr.Value)
+	a.resolve(expr.Name, true)
+	return nil, nil
+}
+
+func (a *Analyzer) VisitBinary(expr *BinaryExpr) (any, error) {
+	a.walkExpr(expr.Left)
+	a.walkExpr(expr.Right)
+	return nil, nil
+}
+
+func (a *Analyzer) VisitCall(expr *CallExpr) (any, error) {
+	a.walkExpr(expr.Callee)
+	for _, argument := range expr.Arguments {
+		a.walkExpr(argument)
+	}
+	return nil, nil
+}
+
+// Properties are looked up at runtime, so there is nothing to bind
+func (a *Analyzer) VisitGet(expr *GetExpr) (any, error) {
+	a.walkExpr(expr.Object)
+	return nil, nil
+}
+
+func (a *Analyzer) VisitGrouping(expr *GroupingExpr) (any, error) {
+	a.walkExpr(expr.Expression)
+	return nil, nil
+}
+
+func (a *Analyzer) VisitLiteral(expr *LiteralExpr) (any, error) {
+	return nil, nil
+}
+
+func (a *Analyzer) VisitLogical(expr *LogicalExpr) (any, error) {
+	a.walkExpr(expr.Left)
+	a.walkExpr(expr.Right)
+	return nil, nil
+}
+
+func (a *Analyzer) VisitSet(expr *SetExpr) (any, error) {
+	a.walkExpr(expr.Object)
+	a.walkExpr(expr.Value)
+	return nil, nil
+}
+
+func (a *Analyzer) VisitSuper(expr *SuperExpr) (any, error) {
+	return nil, nil
+}
+
+func (a *Analyzer) VisitThis(expr *ThisExpr) (any, error) {
+	return nil, nil
+}
+
+func (a *Analyzer) VisitUnary(expr *UnaryExpr) (any, error) {
+	a.walkExpr(expr.Right)
+	return nil, nil
+}
+
+func (a *Analyzer) VisitVariable(expr *VariableExpr) (any, error) {
+	a.resolve(expr.Name, false)
+	return nil, nil
+}
+
+func (a *Analyzer) walkFunction(function *FunctionStmt, symbol *Symbol) {
+	enclosing := a.container
+	a.container = symbol
+	a.beginScope()
+	for _, param := range function.Params {
+		a.declare(param, PARAMETER, "parameter "+param.Lexeme)
+	}
+	a.walkStatements(function.Body)
+	a.endScope()
+	a.container = enclosing
+}
+
+func (a *Analyzer) walkStatements(statements []Stmt) {
+	for _, stmt := range statements {
+		a.walkStmt(stmt)
+	}
+}
+
+func (a *Analyzer) walkStmt(stmt Stmt) {
+	stmt.Accept(a)
+}
+
+func (a *Analyzer) walkExpr(expr Expr) {
+	expr.Accept(a)
+}
+
+func (a *Analyzer) beginScope() {
+	a.scopes = append(a.scopes, map[string]*Symbol{})
+}
+
+func (a *Analyzer) endScope() {
+	a.scopes = a.scopes[:len(a.scopes)-1]
+}
+
+// Binds a use of a name to the innermost declaration seen so far
+func (a *Analyzer) resolve(name Token, isAssignment bool) {
+	for i := len(a.scopes) - 1; i >= 0; i-- {
+		if symbol, isPresent := a.scopes[i][name.Lexeme]; isPresent {
+			a.reference(name, symbol, isAssignment)
+			return
+		}
+	}
+	a.unresolved = append(a.unresolved, unresolvedName{name: name, isAssignment: isAssignment})
+}
+
+func (a *Analyzer) reference(name Token, symbol *Symbol, isAssignment bool) {
+	symbol.References = append(symbol.References, name)
+	a.analysis.Occurrences = append(a.analysis.Occurrences, Occurrence{Token: name, Symbol: symbol, IsAssignment: isAssignment})
+}
+
+// The symbol a new declaration in the innermost scope would hide, if any
+func (a *Analyzer) visible(name string) *Symbol {
+	for i := len(a.scopes) - 2; i >= 0; i-- {
+		if symbol, isPresent := a.scopes[i][name]; isPresent {
+			return symbol
+		}
+	}
+	if len(a.scopes) > 0 {
+		return a.globals[name]
+	}
+	return nil
+}
+
+func (a *Analyzer) declare(name Token, kind SymbolKind, detail string) *Symbol {
+	symbol := a.newSymbol(name, kind, detail)
+	symbol.Shadows = a.visible(name.Lexeme)
+	if len(a.scopes) == 0 {
+		a.globals[name.Lexeme] = symbol
+	} else {
+		a.scopes[len(a.scopes)-1][name.Lexeme] = symbol
+	}
+	a.addOccurrence(name, symbol, true)
+	return symbol
+}
+
+func (a *Analyzer) newSymbol(name Token, kind SymbolKind, detail string) *Symbol {
+	symbol := &Symbol{
+		Name:        name.Lexeme,
+		Kind:        kind,
+		Declaration: name,
+		Detail:      detail,
+		Depth:       len(a.scopes),
+	}
+	symbol.Start, symbol.End = a.extent(name, kind)
+	if a.container == nil {
+		a.analysis.Symbols = append(a.analysis.Symbols, symbol)
+	} else {
+		a.container.Children = append(a.container.Children, symbol)
+	}
+	a.analysis.All = append(a.analysis.All, symbol)
+	return symbol
+}
+
+func (a *Analyzer) addOccurrence(name Token, symbol *Symbol, isDeclaration bool) {
+	a.analysis.Occurrences = append(a.analysis.Occurrences, Occurrence{Token: name, Symbol: symbol, IsDeclaration: isDeclaration})
+}
+
+// Finds where a declaration starts and ends by walking the tokens around its name
+func (a *Analyzer) extent(name Token, kind SymbolKind) (int, int) {
+	index := sort.Search(len(a.tokens), func(i int) bool {
+		return a.tokens[i].Start >= name.Start
+	})
+	if index >= len(a.tokens) || a.tokens[index].Start != name.Start {
+		return name.Start, name.End
+	}
+
+	start := name.Start
+	if index > 0 {
+		switch a.tokens[index-1].TokenType {
+		case token.VAR, token.FUN, token.CLASS:
+			start = a.tokens[index-1].Start
+		}
+	}
+
+	switch kind {
+	case FUNCTION, METHOD, CLASS:
+		return start, a.closingBrace(index, name.End)
+	case VARIABLE:
+		for i := index; i < len(a.tokens); i++ {
+			if a.tokens[i].TokenType == token.SEMICOLON {
+				return start, a.tokens[i].End
+			}
+		}
+	}
+	return start, name.End
+}
+
+// The end of the brace block opened first after the token at index
+func (a *Analyzer) closingBrace(index int, fallback int) int {
+	depth := 0
+	for i := index; i < len(a.tokens); i++ {
+		switch a.tokens[i].TokenType {
+		case token.LEFT_BRACE:
+			depth++
+		case token.RIGHT_BRACE:
+			depth--
+			if depth == 0 {
+				return a.tokens[i].End
+			}
+		}
+	}
+	return fallback
+}
+
+func parameterList(function *FunctionStmt) string {
+	names := make([]string, len(function.Params))
+	for i, param := range function.Params {
+		names[i] = param.Lexeme
+	}
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"dsoechting/glox/golden"
+	"fmt"
+	"os"
+)
+
+// glox test [dir ...]
+// Runs every .glox script under the directories, the current one by default,
+// and checks it against its // expect: annotations
+func (g *Glox) runTests(args []string) int {
+	if len(args) == 0 {
+		args = []string{"."}
+	}
+	backend := golden.Tree
+	if g.backend == VM_BACKEND {
+		backend = golden.VM
+	}
+
+	passed, failed := 0, 0
+	for _, root := range args {
+		paths, findErr := golden.Find(root)
+		if findErr != nil {
+			fmt.Fprintln(g.options.Stderr, findErr)
+			return 66
+		}
+		for _, path := range paths {
+			data, readErr := os.ReadFile(path)
+			if readErr != nil {
+				fmt.Fprintln(g.options.Stderr, readErr)
+				return 66
+			}
+			failures := golden.Check(string(data), backend)
+			if len(failures) == 0 {
+				passed++
+				continue
+			}
+			failed++
+			fmt.Fprintf(g.options.Stdout, "FAIL %s\n", path)
+			for _, failure := range failures {
+				fmt.Fprintf(g.options.Stdout, "    %s\n", failure)
+			}
+		}
+	}
+	fmt.Fprintf(g.options.Stdout, "%d passed, %d failed\n", passed, failed)
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
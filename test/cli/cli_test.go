@@ -0,0 +1,42 @@
+package test
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// Builds the glox command into a temporary directory
+func buildGlox(t *testing.T) string {
+	binary := filepath.Join(t.TempDir(), "glox")
+	build := exec.Command("go", "build", "-o", binary, "dsoechting/glox")
+	if output, buildErr := build.CombinedOutput(); buildErr != nil {
+		t.Fatalf("Failed to build glox: %v\n%s", buildErr, output)
+	}
+	return binary
+}
+
+func TestScriptNamedLikeSubcommand(t *testing.T) {
+	binary := buildGlox(t)
+	dir := t.TempDir()
+	for _, name := range []string{"test", "lint", "fmt"} {
+		if writeErr := os.WriteFile(filepath.Join(dir, name), []byte("print \""+name+"\";\n"), 0644); writeErr != nil {
+			t.Fatalf("Failed to write %s: %v", name, writeErr)
+		}
+		run := exec.Command(binary, name)
+		run.Dir = dir
+		output, runErr := run.CombinedOutput()
+		if runErr != nil || string(output) != name+"\n" {
+			t.Errorf("Expected the %s script to run, got %q (%v)", name, output, runErr)
+		}
+	}
+
+	// Without such a file, the word is still a subcommand
+	run := exec.Command(binary, "disasm")
+	run.Dir = t.TempDir()
+	output, _ := run.CombinedOutput()
+	if string(output) != "Usage glox disasm script\n" {
+		t.Errorf("Expected the disasm usage, got %q", output)
+	}
+}
@@ -0,0 +1,157 @@
+package test
+
+import (
+	"bytes"
+	"dsoechting/glox/compile"
+	"dsoechting/glox/parse"
+	"dsoechting/glox/scanner"
+	"dsoechting/glox/vm"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const source = `
+fun makeAdder(n) {
+  fun add(x) { return x + n; }
+  return add;
+}
+class Greeter {
+  init(name) { this.name = name; }
+  greet() { return "hi " + this.name; }
+}
+makeAdder(2)(40);
+`
+
+func compileSource(t *testing.T, text string) *compile.Function {
+	tokens, scanErr := scanner.Create(text).ScanTokens()
+	if scanErr != nil {
+		t.Fatalf("Failed to scan: %v", scanErr)
+	}
+	parser := parse.Create(tokens)
+	statements, parseErr := parser.Parse()
+	if parseErr != nil {
+		t.Fatalf("Failed to parse: %v", parseErr)
+	}
+	function, compileErr := compile.Compile(statements)
+	if compileErr != nil {
+		t.Fatalf("Failed to compile: %v", compileErr)
+	}
+	return function
+}
+
+func TestRoundTrip(t *testing.T) {
+	function := compileSource(t, source)
+
+	var encoded bytes.Buffer
+	if err := compile.Encode(&encoded, function); err != nil {
+		t.Fatalf("Failed to encode: %v", err)
+	}
+	if !compile.IsCompiled(encoded.Bytes()) {
+		t.Fatalf("Encoded chunk is missing the magic header")
+	}
+
+	decoded, decodeErr := compile.Decode(encoded.Bytes())
+	if decodeErr != nil {
+		t.Fatalf("Failed to decode: %v", decodeErr)
+	}
+
+	expected, _ := vm.Create().Interpret(function)
+	actual, runErr := vm.Create().Interpret(decoded)
+	if runErr != nil {
+		t.Fatalf("Failed to run decoded chunk: %v", runErr)
+	}
+	if !reflect.DeepEqual(actual, expected) || len(actual) != 1 || actual[0].String() != "42" {
+		t.Errorf("Expected: %v\nActual: %v\n", expected, actual)
+	}
+}
+
+func TestCorruptChunk(t *testing.T) {
+	var encoded bytes.Buffer
+	compile.Encode(&encoded, compileSource(t, source))
+	data := encoded.Bytes()
+	data[len(data)-1] ^= 0xff
+
+	_, decodeErr := compile.Decode(data)
+	if !errors.Is(decodeErr, compile.ErrChecksum) {
+		t.Errorf("Expected a checksum error, got: %v", decodeErr)
+	}
+
+	_, decodeErr = compile.Decode([]byte("print 1;"))
+	if !errors.Is(decodeErr, compile.ErrBadMagic) {
+		t.Errorf("Expected a bad magic error, got: %v", decodeErr)
+	}
+}
+
+func TestDisassemble(t *testing.T) {
+	var out strings.Builder
+	compile.Disassemble(&out, compileSource(t, source))
+	listing := out.String()
+
+	for _, expected := range []string{"== <script> ==", "== <fn add> ==", "OP_CLOSURE", "local 1", "'hi '", "OP_GET_PROPERTY"} {
+		if !strings.Contains(listing, expected) {
+			t.Errorf("Disassembly is missing %q:\n%s", expected, listing)
+		}
+	}
+}
+
+func TestVersionMismatch(t *testing.T) {
+	var encoded bytes.Buffer
+	compile.Encode(&encoded, compileSource(t, source))
+	data := encoded.Bytes()
+	data[len(compile.Magic)+1]++
+
+	_, decodeErr := compile.Decode(data)
+	if decodeErr == nil || !strings.Contains(decodeErr.Error(), "unsupported compiled glox version") {
+		t.Errorf("Expected a version error, got: %v", decodeErr)
+	}
+}
+
+// Builds a script function from raw bytes, bypassing the compiler
+func handWritten(code []byte, constants ...compile.Value) *compile.Function {
+	chunk := compile.CreateChunk()
+	for _, b := range code {
+		chunk.Write(b, 1)
+	}
+	for _, constant := range constants {
+		chunk.AddConstant(constant)
+	}
+	return &compile.Function{Chunk: chunk}
+}
+
+func TestMalformedBytecode(t *testing.T) {
+	const (
+		CONSTANT = byte(compile.OP_CONSTANT)
+		RETURN   = byte(compile.OP_RETURN)
+		JUMP     = byte(compile.OP_JUMP)
+	)
+	tests := map[string]*compile.Function{
+		"empty code":               handWritten(nil),
+		"constant out of range":    handWritten([]byte{CONSTANT, 0, 5, RETURN}, compile.NumberValue(1)),
+		"truncated operand":        handWritten([]byte{CONSTANT, 0}),
+		"missing return":           handWritten([]byte{CONSTANT, 0, 0}, compile.NumberValue(1)),
+		"unknown instruction":      handWritten([]byte{0xff, RETURN}),
+		"jump past the end":        handWritten([]byte{JUMP, 0, 9, RETURN}),
+		"jump into an operand":     handWritten([]byte{JUMP, 0, 1, CONSTANT, 0, 0, RETURN}, compile.NumberValue(1)),
+		"name that isn't a string": handWritten([]byte{byte(compile.OP_GET_GLOBAL), 0, 0, RETURN}, compile.NumberValue(1)),
+		"missing upvalue":          handWritten([]byte{byte(compile.OP_GET_UPVALUE), 0, RETURN}),
+		"nested function is invalid": handWritten(
+			[]byte{CONSTANT, 0, 0, RETURN},
+			compile.ObjValue(handWritten([]byte{CONSTANT, 0, 3, RETURN})),
+		),
+	}
+
+	for name, function := range tests {
+		t.Run(name, func(t *testing.T) {
+			var encoded bytes.Buffer
+			if err := compile.Encode(&encoded, function); err != nil {
+				t.Fatalf("Failed to encode: %v", err)
+			}
+			_, decodeErr := compile.Decode(encoded.Bytes())
+			if decodeErr == nil || !strings.Contains(decodeErr.Error(), "malformed") {
+				t.Errorf("Expected a malformed error, got: %v", decodeErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package test
+
+import (
+	"dsoechting/glox/complete"
+	"dsoechting/glox/interpret"
+	"dsoechting/glox/parse"
+	"dsoechting/glox/resolve"
+	"dsoechting/glox/scanner"
+	"reflect"
+	"testing"
+)
+
+// A session with a few globals, one holding an instance
+func session(t *testing.T) complete.Scope {
+	t.Helper()
+	source := `
+class Base { describe() {} }
+class Point < Base { init(x) { this.x = x; } length() {} }
+var point = Point(1);
+var pointCount = 1;
+fun printAll() {}
+`
+	tokens, _ := scanner.Create(source).ScanTokens()
+	parser := parse.Create(tokens)
+	statements, parseErr := parser.Parse()
+	if parseErr != nil {
+		t.Fatalf("Failed to parse: %v", parseErr)
+	}
+	interpreter := interpret.Create()
+	if resolveErr := resolve.Create(&interpreter).Resolve(statements); resolveErr != nil {
+		t.Fatalf("Failed to resolve: %v", resolveErr)
+	}
+	if _, runErr := interpreter.Interpret(statements); runErr != nil {
+		t.Fatalf("Failed to run: %v", runErr)
+	}
+	return complete.EnvironmentScope(interpreter.Globals())
+}
+
+func TestComplete(t *testing.T) {
+	scope := session(t)
+	tests := []struct {
+		name       string
+		line       string
+		start      int
+		candidates []string
+	}{
+		{"keywords and globals", "pr", 0, []string{"print", "printAll"}},
+		{"globals", "print poi", 6, []string{"point", "pointCount"}},
+		{"keywords only", "whi", 0, []string{"while"}},
+		{"members", "print point.", 12, []string{"describe", "init", "length", "x"}},
+		{"members with prefix", "point.le", 6, []string{"length"}},
+		{"members of a non instance", "pointCount.", 11, []string{}},
+		{"members of an unknown variable", "nope.", 5, []string{}},
+		{"inside a string", `print "poi`, 10, []string{}},
+		{"inside a comment", "print 1; // poi", 15, []string{}},
+		{"after a closed string", `print "a" + poi`, 12, []string{"point", "pointCount"}},
+		{"new name", "var poi", 4, []string{}},
+		{"number", "print 12", 6, []string{}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			start, candidates := complete.Complete(test.line, len([]rune(test.line)), scope)
+			if candidates == nil {
+				candidates = []string{}
+			}
+			if start != test.start || !reflect.DeepEqual(candidates, test.candidates) {
+				t.Errorf("Expected %d %q, got %d %q", test.start, test.candidates, start, candidates)
+			}
+		})
+	}
+}
+
+func TestCompleteMidLine(t *testing.T) {
+	start, candidates := complete.Complete("print poi + 1;", 9, session(t))
+	if start != 6 || !reflect.DeepEqual(candidates, []string{"point", "pointCount"}) {
+		t.Errorf("Expected the word before the cursor to complete, got %d %q", start, candidates)
+	}
+}
+
+func TestCommonPrefix(t *testing.T) {
+	for expected, candidates := range map[string][]string{
+		"point": {"point", "pointCount"},
+		"pr":    {"print", "printAll", "pr"},
+		"":      {"a", "b"},
+	} {
+		if prefix := complete.CommonPrefix(candidates); prefix != expected {
+			t.Errorf("Expected %q for %q, got %q", expected, candidates, prefix)
+		}
+	}
+}
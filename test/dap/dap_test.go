@@ -0,0 +1,399 @@
+package test
+
+import (
+	"bufio"
+	"dsoechting/glox/dap"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Any message from the server, responses and events alike
+type message struct {
+	Seq        int             `json:"seq"`
+	Type       string          `json:"type"`
+	RequestSeq int             `json:"request_seq"`
+	Success    bool            `json:"success"`
+	Command    string          `json:"command"`
+	Message    string          `json:"message"`
+	Event      string          `json:"event"`
+	Body       json.RawMessage `json:"body"`
+}
+
+// Plays the editor's side against a server running in the same process
+type client struct {
+	t      *testing.T
+	writer io.WriteCloser
+	reader *bufio.Reader
+	seq    int
+	served chan error
+	// Events that arrived while waiting for something else
+	events []message
+}
+
+func startServer(t *testing.T) *client {
+	serverIn, clientOut := io.Pipe()
+	clientIn, serverOut := io.Pipe()
+	c := &client{
+		t:      t,
+		writer: clientOut,
+		reader: bufio.NewReader(clientIn),
+		served: make(chan error, 1),
+	}
+	go func() {
+		c.served <- dap.Create(serverIn, serverOut).Serve()
+		serverOut.Close()
+	}()
+	t.Cleanup(func() { clientOut.Close() })
+
+	c.request("initialize", map[string]any{"clientID": "test", "linesStartAt1": true}, nil)
+	c.waitFor("initialized")
+	return c
+}
+
+func (c *client) receive() message {
+	headers, err := textproto.NewReader(c.reader).ReadMIMEHeader()
+	if err != nil {
+		c.t.Fatalf("Failed to read headers: %v", err)
+	}
+	length, err := strconv.Atoi(headers.Get("Content-Length"))
+	if err != nil {
+		c.t.Fatalf("Bad Content-Length: %v", err)
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(c.reader, body); err != nil {
+		c.t.Fatalf("Failed to read body: %v", err)
+	}
+	var received message
+	if err := json.Unmarshal(body, &received); err != nil {
+		c.t.Fatalf("Bad message %s: %v", body, err)
+	}
+	return received
+}
+
+// Sends a request and decodes the body of its response into body. Returns the
+// failure message, or "" when the request succeeded
+func (c *client) request(command string, arguments any, body any) string {
+	c.seq++
+	encoded, err := json.Marshal(map[string]any{"seq": c.seq, "type": "request", "command": command, "arguments": arguments})
+	if err != nil {
+		c.t.Fatalf("Failed to encode: %v", err)
+	}
+	if _, err := fmt.Fprintf(c.writer, "Content-Length: %d\r\n\r\n%s", len(encoded), encoded); err != nil {
+		c.t.Fatalf("Failed to send: %v", err)
+	}
+	for {
+		received := c.receive()
+		if received.Type == "event" {
+			c.events = append(c.events, received)
+			continue
+		}
+		if received.RequestSeq != c.seq || received.Command != command {
+			c.t.Fatalf("Expected the response to %s, got %+v", command, received)
+		}
+		if !received.Success {
+			return received.Message
+		}
+		if body != nil {
+			if err := json.Unmarshal(received.Body, body); err != nil {
+				c.t.Fatalf("Bad %s body %s: %v", command, received.Body, err)
+			}
+		}
+		return ""
+	}
+}
+
+// Waits for the next event with this name, returning the events skipped on the way
+func (c *client) waitFor(event string) (message, []message) {
+	skipped := []message{}
+	for {
+		var next message
+		if len(c.events) > 0 {
+			next, c.events = c.events[0], c.events[1:]
+		} else {
+			next = c.receive()
+		}
+		if next.Type != "event" {
+			c.t.Fatalf("Expected the %s event, got %+v", event, next)
+		}
+		if next.Event == event {
+			return next, skipped
+		}
+		skipped = append(skipped, next)
+	}
+}
+
+func (c *client) mustRequest(command string, arguments any, body any) {
+	if failure := c.request(command, arguments, body); failure != "" {
+		c.t.Fatalf("%s failed: %s", command, failure)
+	}
+}
+
+// Waits to stop, checking why and where
+func (c *client) expectStop(reason string, name string, line int) {
+	event, _ := c.waitFor("stopped")
+	var stopped dap.StoppedEventBody
+	json.Unmarshal(event.Body, &stopped)
+	if stopped.Reason != reason {
+		c.t.Errorf("Expected to stop for %s, got %s", reason, stopped.Reason)
+	}
+	var trace dap.StackTraceResponseBody
+	c.mustRequest("stackTrace", map[string]any{"threadId": dap.THREAD_ID}, &trace)
+	top := trace.StackFrames[0]
+	if top.Name != name || top.Line != line {
+		c.t.Fatalf("Expected to stop in %s at line %d, got %s at line %d", name, line, top.Name, top.Line)
+	}
+}
+
+const source = `class Point {
+  init(x, y) {
+    this.x = x;
+    this.y = y;
+  }
+}
+fun scale(p, factor) {
+  var result = Point(p.x * factor, p.y * factor);
+  return result;
+}
+var origin = Point(1, 2);
+var scaled = scale(origin, 3);
+print scaled.x;
+`
+
+func writeProgram(t *testing.T, text string) string {
+	program := filepath.Join(t.TempDir(), "main.glox")
+	if err := os.WriteFile(program, []byte(text), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return program
+}
+
+func variables(c *client, reference int) map[string]dap.Variable {
+	var body dap.VariablesResponseBody
+	c.mustRequest("variables", map[string]any{"variablesReference": reference}, &body)
+	named := map[string]dap.Variable{}
+	for _, variable := range body.Variables {
+		named[variable.Name] = variable
+	}
+	return named
+}
+
+func evaluate(c *client, expression string, frameID int) (string, string) {
+	var body dap.EvaluateResponseBody
+	failure := c.request("evaluate", map[string]any{"expression": expression, "frameId": frameID, "context": "watch"}, &body)
+	return body.Result, failure
+}
+
+func TestBreakpointsScopesAndWatches(t *testing.T) {
+	c := startServer(t)
+	program := writeProgram(t, source)
+	c.mustRequest("launch", map[string]any{"program": program}, nil)
+
+	var set dap.SetBreakpointsResponseBody
+	c.mustRequest("setBreakpoints", map[string]any{
+		"source":      map[string]any{"path": program},
+		"breakpoints": []map[string]any{{"line": 9}, {"line": 5}, {"line": 20}},
+	}, &set)
+	got := []string{}
+	for _, breakpoint := range set.Breakpoints {
+		got = append(got, fmt.Sprintf("%v:%d", breakpoint.Verified, breakpoint.Line))
+	}
+	// Line 5 only closes a block, so its breakpoint moves to the next statement
+	if strings.Join(got, " ") != "true:9 true:7 false:20" {
+		t.Errorf("Unexpected breakpoints %v", got)
+	}
+	c.mustRequest("setBreakpoints", map[string]any{
+		"source":      map[string]any{"path": program},
+		"breakpoints": []map[string]any{{"line": 9}},
+	}, nil)
+	c.mustRequest("configurationDone", nil, nil)
+
+	c.expectStop("breakpoint", "scale", 9)
+	var trace dap.StackTraceResponseBody
+	c.mustRequest("stackTrace", map[string]any{"threadId": dap.THREAD_ID}, &trace)
+	if len(trace.StackFrames) != 2 || trace.StackFrames[1].Name != "script" || trace.StackFrames[1].Line != 12 {
+		t.Errorf("Expected scale called from line 12, got %+v", trace.StackFrames)
+	}
+
+	var scopes dap.ScopesResponseBody
+	c.mustRequest("scopes", map[string]any{"frameId": 1}, &scopes)
+	if len(scopes.Scopes) != 2 || scopes.Scopes[0].Name != "Locals" || scopes.Scopes[1].Name != "Globals" {
+		t.Fatalf("Expected locals and globals, got %+v", scopes.Scopes)
+	}
+	locals := variables(c, scopes.Scopes[0].VariablesReference)
+	if locals["factor"].Value != "3" || locals["factor"].Type != "number" {
+		t.Errorf("Unexpected factor %+v", locals["factor"])
+	}
+	result := locals["result"]
+	if result.Value != "Point instance" || result.VariablesReference == 0 {
+		t.Fatalf("Expected an expandable instance, got %+v", result)
+	}
+	fields := variables(c, result.VariablesReference)
+	if fields["x"].Value != "3" || fields["y"].Value != "6" {
+		t.Errorf("Unexpected fields %+v", fields)
+	}
+
+	if value, failure := evaluate(c, "result.y + factor", 1); value != "9" {
+		t.Errorf("Expected 9, got %q (%s)", value, failure)
+	}
+	if value, failure := evaluate(c, "origin.x", 2); value != "1" {
+		t.Errorf("Expected 1, got %q (%s)", value, failure)
+	}
+	if _, failure := evaluate(c, "factor", 2); failure != "Undefined variable 'factor'." {
+		t.Errorf("Expected factor to be out of scope in the caller, got %q", failure)
+	}
+	if _, failure := evaluate(c, "1 +", 1); failure != "Expect expression." {
+		t.Errorf("Expected a syntax error, got %q", failure)
+	}
+
+	c.mustRequest("stepOut", map[string]any{"threadId": dap.THREAD_ID}, nil)
+	c.expectStop("step", "script", 13)
+	c.mustRequest("continue", map[string]any{"threadId": dap.THREAD_ID}, nil)
+	exited, skipped := c.waitFor("exited")
+	if len(skipped) != 1 || !strings.Contains(string(skipped[0].Body), `"output":"3\n"`) {
+		t.Errorf("Expected the script's output, got %+v", skipped)
+	}
+	if string(exited.Body) != `{"exitCode":0}` {
+		t.Errorf("Expected a clean exit, got %s", exited.Body)
+	}
+	c.waitFor("terminated")
+
+	c.mustRequest("disconnect", nil, nil)
+	if err := <-c.served; err != nil {
+		t.Errorf("Expected a clean disconnect, got %v", err)
+	}
+}
+
+func TestStoppingOnEntryAndStepping(t *testing.T) {
+	c := startServer(t)
+	program := writeProgram(t, source)
+	c.mustRequest("launch", map[string]any{"program": program, "stopOnEntry": true}, nil)
+	c.mustRequest("configurationDone", nil, nil)
+
+	c.expectStop("entry", "script", 1)
+	c.mustRequest("next", map[string]any{"threadId": dap.THREAD_ID}, nil)
+	c.expectStop("step", "script", 7)
+	c.mustRequest("next", map[string]any{"threadId": dap.THREAD_ID}, nil)
+	c.expectStop("step", "script", 11)
+	c.mustRequest("stepIn", map[string]any{"threadId": dap.THREAD_ID}, nil)
+	c.expectStop("step", "init", 3)
+
+	if failure := c.request("next", map[string]any{"threadId": dap.THREAD_ID}, nil); failure != "" {
+		t.Fatalf("next failed: %s", failure)
+	}
+	c.expectStop("step", "init", 4)
+	c.mustRequest("terminate", nil, nil)
+	_, skipped := c.waitFor("terminated")
+	for _, event := range skipped {
+		if event.Event == "output" {
+			t.Errorf("Expected the script to stop before printing, got %s", event.Body)
+		}
+	}
+	if failure := c.request("continue", map[string]any{"threadId": dap.THREAD_ID}, nil); failure != "The program is not paused." {
+		t.Errorf("Expected continuing a stopped script to fail, got %q", failure)
+	}
+	c.mustRequest("disconnect", nil, nil)
+}
+
+// Fails the test rather than hanging when the server never answers
+func within(t *testing.T, what string, action func()) {
+	t.Helper()
+	done := make(chan struct{})
+	go func() {
+		action()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Timed out waiting for %s", what)
+	}
+}
+
+const loopSource = `var i = 0;
+while (i < 3) {
+  i = i + 1;
+}
+print i;
+`
+
+func TestBreakpointInLoopBody(t *testing.T) {
+	c := startServer(t)
+	program := writeProgram(t, loopSource)
+	c.mustRequest("launch", map[string]any{"program": program}, nil)
+	c.mustRequest("setBreakpoints", map[string]any{
+		"source":      map[string]any{"path": program},
+		"breakpoints": []map[string]any{{"line": 3}},
+	}, nil)
+	c.mustRequest("configurationDone", nil, nil)
+
+	for _, expected := range []string{"0", "1", "2"} {
+		c.expectStop("breakpoint", "script", 3)
+		if value, failure := evaluate(c, "i", 0); value != expected || failure != "" {
+			t.Errorf("Expected i to be %s, got %q (%s)", expected, value, failure)
+		}
+		c.mustRequest("continue", map[string]any{"threadId": dap.THREAD_ID}, nil)
+	}
+	c.waitFor("terminated")
+	c.mustRequest("disconnect", nil, nil)
+}
+
+// Only runs blocks once it's looping
+const infiniteLoop = "print \"looping\";\nwhile (true) {}\n"
+
+// Waits for the script's output, then gives it a moment to get into the loop
+func waitUntilLooping(c *client) {
+	c.waitFor("output")
+	time.Sleep(50 * time.Millisecond)
+}
+
+func TestTerminatingAnInfiniteLoop(t *testing.T) {
+	c := startServer(t)
+	c.mustRequest("launch", map[string]any{"program": writeProgram(t, infiniteLoop)}, nil)
+	c.mustRequest("configurationDone", nil, nil)
+	waitUntilLooping(c)
+	within(t, "terminate", func() {
+		c.mustRequest("terminate", nil, nil)
+		c.waitFor("terminated")
+	})
+	c.mustRequest("disconnect", nil, nil)
+}
+
+func TestDisconnectingDuringAnInfiniteLoop(t *testing.T) {
+	for _, noDebug := range []bool{false, true} {
+		c := startServer(t)
+		c.mustRequest("launch", map[string]any{"program": writeProgram(t, infiniteLoop), "noDebug": noDebug}, nil)
+		c.mustRequest("configurationDone", nil, nil)
+		waitUntilLooping(c)
+		within(t, "disconnect", func() {
+			c.mustRequest("disconnect", nil, nil)
+		})
+	}
+}
+
+func TestLaunchAndRuntimeErrors(t *testing.T) {
+	c := startServer(t)
+	failure := c.request("launch", map[string]any{"program": writeProgram(t, "var a = ;\n")}, nil)
+	if !strings.Contains(failure, "Expect expression.") {
+		t.Errorf("Expected the syntax error, got %q", failure)
+	}
+
+	c.mustRequest("launch", map[string]any{"program": writeProgram(t, "print 1;\nprint -\"a\";\n")}, nil)
+	c.mustRequest("configurationDone", nil, nil)
+	exited, skipped := c.waitFor("exited")
+	if len(skipped) != 2 || !strings.Contains(string(skipped[1].Body), "Operand must be a number") {
+		t.Errorf("Expected the output then the error, got %+v", skipped)
+	}
+	if string(exited.Body) != `{"exitCode":70}` {
+		t.Errorf("Expected a runtime failure, got %s", exited.Body)
+	}
+	c.waitFor("terminated")
+	c.mustRequest("disconnect", nil, nil)
+}
@@ -0,0 +1,166 @@
+package test
+
+import (
+	"bufio"
+	"bytes"
+	"dsoechting/glox/debug"
+	"dsoechting/glox/interpret"
+	"dsoechting/glox/parse"
+	"dsoechting/glox/resolve"
+	"dsoechting/glox/scanner"
+	"errors"
+	"strings"
+	"testing"
+)
+
+const source = `fun add(a, b) {
+  var sum = a + b;
+  return sum;
+}
+var total = 0;
+for (var i = 0; i < 2; i = i + 1) {
+  total = add(total, i);
+}
+print total;
+`
+
+// Runs source under the debugger, feeding it commands. Returns the
+// debugger's output, the script's output and the error Interpret returned
+func debugScript(t *testing.T, commands ...string) (string, string, error) {
+	return debugSource(t, source, commands...)
+}
+
+func debugSource(t *testing.T, source string, commands ...string) (string, string, error) {
+	tokens, scanErr := scanner.Create(source).ScanTokens()
+	if scanErr != nil {
+		t.Fatal(scanErr)
+	}
+	parser := parse.Create(tokens)
+	statements, parseErr := parser.Parse()
+	if parseErr != nil {
+		t.Fatal(parseErr)
+	}
+	var stdout bytes.Buffer
+	interpreter := interpret.CreateWithOptions(interpret.Options{Stdout: &stdout})
+	if resolveErr := resolve.Create(&interpreter).Resolve(statements); resolveErr != nil {
+		t.Fatal(resolveErr)
+	}
+
+	var output bytes.Buffer
+	input := bufio.NewReader(strings.NewReader(strings.Join(commands, "\n") + "\n"))
+	interpreter.SetHook(debug.Create(source, input, &output))
+	_, err := interpreter.Interpret(statements)
+	return output.String(), stdout.String(), err
+}
+
+// The lines the debugger stopped at, in order
+func stops(output string) []string {
+	lines := []string{}
+	for _, line := range strings.Split(output, "\n") {
+		if strings.HasPrefix(line, "(glox) Stopped at ") || strings.HasPrefix(line, "Stopped at ") {
+			lines = append(lines, line[strings.Index(line, "Stopped at ")+len("Stopped at "):])
+		}
+	}
+	return lines
+}
+
+func TestBreakpointsAndContinue(t *testing.T) {
+	output, stdout, err := debugScript(t, "break 7", "c", "p i", "c", "delete 7", "c")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if stdout != "1\n" {
+		t.Errorf("Expected the script to finish, got %q", stdout)
+	}
+	expected := "[line 1 in script line 7 in script line 7 in script]"
+	if got := "[" + strings.Join(stops(output), " ") + "]"; got != expected {
+		t.Errorf("Expected stops %s, got %s", expected, got)
+	}
+	if !strings.Contains(output, "i = 0\n") {
+		t.Errorf("Expected i to be printed, got:\n%s", output)
+	}
+}
+
+func TestStepping(t *testing.T) {
+	// Into add, over its body, out to the loop's increment, then over the rest
+	output, _, err := debugScript(t, "b 7", "c", "delete 7", "s", "n", "finish", "n", "n", "n")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	expected := []string{"line 1 in script", "line 7 in script", "line 2 in add", "line 3 in add", "line 6 in script", "line 7 in script", "line 6 in script", "line 9 in script"}
+	if got := stops(output); strings.Join(got, ",") != strings.Join(expected, ",") {
+		t.Errorf("Expected stops %v, got %v", expected, got)
+	}
+}
+
+const loopSource = `var i = 0;
+while (i < 3) {
+  i = i + 1;
+}
+print i;
+`
+
+func TestBreakpointInLoopBody(t *testing.T) {
+	output, stdout, err := debugSource(t, loopSource, "b 3", "c", "p i", "c", "p i", "c", "p i", "c")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if stdout != "3\n" {
+		t.Errorf("Expected the script to finish, got %q", stdout)
+	}
+	expected := "[line 1 in script line 3 in script line 3 in script line 3 in script]"
+	if got := "[" + strings.Join(stops(output), " ") + "]"; got != expected {
+		t.Errorf("Expected stops %s, got %s", expected, got)
+	}
+	for _, value := range []string{"i = 0\n", "i = 1\n", "i = 2\n"} {
+		if !strings.Contains(output, value) {
+			t.Errorf("Expected %q to be printed, got:\n%s", value, output)
+		}
+	}
+}
+
+func TestSteppingThroughLoop(t *testing.T) {
+	output, _, err := debugSource(t, loopSource, "n", "n", "n", "n", "n", "n")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	expected := []string{"line 1 in script", "line 2 in script", "line 3 in script", "line 3 in script", "line 3 in script", "line 5 in script"}
+	if got := stops(output); strings.Join(got, ",") != strings.Join(expected, ",") {
+		t.Errorf("Expected stops %v, got %v", expected, got)
+	}
+}
+
+func TestBreakpointInOneLineLoop(t *testing.T) {
+	// The whole line is one visit until the loop comes back around to the body
+	output, stdout, err := debugSource(t, "var i = 0; while (i < 3) { i = i + 1; } print i;\n", "b 1", "c", "p i", "c", "p i", "c")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if stdout != "3\n" {
+		t.Errorf("Expected the script to finish, got %q", stdout)
+	}
+	if got := len(stops(output)); got != 3 {
+		t.Errorf("Expected 3 stops, got %d:\n%s", got, output)
+	}
+	if !strings.Contains(output, "i = 1\n") || !strings.Contains(output, "i = 2\n") {
+		t.Errorf("Expected the loop to stop each time around, got:\n%s", output)
+	}
+}
+
+func TestBacktraceAndEnvironment(t *testing.T) {
+	output, _, err := debugScript(t, "b 3", "c", "bt", "p", "q")
+	if !errors.Is(err, debug.ErrQuit) {
+		t.Fatalf("Expected quitting to stop the script, got %v", err)
+	}
+	if !strings.Contains(output, "#0 add at line 3\n#1 script at line 7\n") {
+		t.Errorf("Unexpected backtrace:\n%s", output)
+	}
+	// The call's scope then the globals add closed over, not the caller's loop variable
+	scopes := "scope 0:\n  a = 0\n  b = 0\n  sum = 0\nglobals:\n"
+	if !strings.Contains(output, scopes) {
+		t.Errorf("Expected the environment chain, got:\n%s", output)
+	}
+	if !strings.Contains(output, "  total = 0\n") {
+		t.Errorf("Expected the globals, got:\n%s", output)
+	}
+}
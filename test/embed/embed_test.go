@@ -0,0 +1,179 @@
+package test
+
+import (
+	glox_error "dsoechting/glox/error"
+	"dsoechting/glox/interpret"
+	"dsoechting/glox/parse"
+	"dsoechting/glox/resolve"
+	"dsoechting/glox/scanner"
+	"errors"
+	"strings"
+	"testing"
+)
+
+type Interpreter = interpret.Interpreter
+
+func run(interpreter *Interpreter, source string) (string, error) {
+	tokens, scanErr := scanner.Create(source).ScanTokens()
+	if scanErr != nil {
+		return "", scanErr
+	}
+	parser := parse.Create(tokens)
+	statements, parseErr := parser.Parse()
+	if parseErr != nil {
+		return "", parseErr
+	}
+	resolveErr := resolve.Create(interpreter).Resolve(statements)
+	if resolveErr != nil {
+		return "", resolveErr
+	}
+	values, runErr := interpreter.Interpret(statements)
+	if runErr != nil {
+		return "", runErr
+	}
+	echoes := make([]string, len(values))
+	for index, value := range values {
+		echoes[index] = interpret.Stringify(value)
+	}
+	return strings.Join(echoes, "\n"), nil
+}
+
+func TestDefineNative(t *testing.T) {
+	interpreter := interpret.Create()
+	interpreter.DefineNative("repeat", 2, func(arguments []any) (any, error) {
+		text, isString := arguments[0].(string)
+		count, isNumber := arguments[1].(float64)
+		if !isString || !isNumber {
+			return nil, errors.New("repeat expects a string and a number")
+		}
+		return strings.Repeat(text, int(count)), nil
+	})
+	interpreter.DefineNative("answer", 0, func(arguments []any) (any, error) {
+		// Go ints come back as glox numbers
+		return 42, nil
+	})
+
+	actual, err := run(&interpreter, `repeat("ab", 3) + "!";`)
+	if err != nil || actual != "ababab!" {
+		t.Errorf("Expected: ababab!\nActual: %v (%v)\n", actual, err)
+	}
+
+	actual, err = run(&interpreter, "answer() + 1;")
+	if err != nil || actual != "43" {
+		t.Errorf("Expected: 43\nActual: %v (%v)\n", actual, err)
+	}
+}
+
+var errHost = errors.New("host is unavailable")
+
+func TestNativeErrors(t *testing.T) {
+	interpreter := interpret.Create()
+	interpreter.DefineNative("fail", 0, func(arguments []any) (any, error) {
+		return nil, errHost
+	})
+	interpreter.DefineNative("channel", 0, func(arguments []any) (any, error) {
+		return make(chan int), nil
+	})
+
+	_, err := run(&interpreter, "var a = 1;\nfail();")
+	if !errors.Is(err, errHost) {
+		t.Errorf("Expected the host error to be wrapped, got: %v", err)
+	}
+	if err == nil || !strings.HasPrefix(err.Error(), "[line 2]") {
+		t.Errorf("Expected the error at the call site line, got: %v", err)
+	}
+
+	_, err = run(&interpreter, "channel();")
+	if err == nil || !strings.Contains(err.Error(), "Can't convert Go value of type chan int") {
+		t.Errorf("Expected a conversion error, got: %v", err)
+	}
+
+	_, err = run(&interpreter, "fail(1);")
+	if err == nil || !strings.Contains(err.Error(), "Expected 0 arguments but got 1.") {
+		t.Errorf("Expected an arity error, got: %v", err)
+	}
+}
+
+func TestCallFromGo(t *testing.T) {
+	interpreter := interpret.Create()
+	_, err := run(&interpreter, `
+var greeting = "hello";
+fun add(a, b) { return a + b; }
+class Counter {
+  init(start) { this.count = start; }
+  next() { this.count = this.count + 1; return this.count; }
+}
+var counter = Counter(10);
+`)
+	if err != nil {
+		t.Fatalf("Failed to run script: %v", err)
+	}
+
+	greeting, isDefined := interpreter.Global("greeting")
+	if !isDefined || greeting != "hello" || interpret.IsCallable(greeting) {
+		t.Errorf("Expected the greeting global, got: %v (%v)", greeting, isDefined)
+	}
+	if _, isDefined := interpreter.Global("missing"); isDefined {
+		t.Errorf("Expected missing to be undefined")
+	}
+
+	add, _ := interpreter.Global("add")
+	if !interpret.IsCallable(add) {
+		t.Fatalf("Expected add to be callable")
+	}
+	sum, err := interpreter.Call(add, 2, 3.5)
+	if err != nil || sum != 5.5 {
+		t.Errorf("Expected: 5.5\nActual: %v (%v)\n", sum, err)
+	}
+	if _, err := interpreter.Call(add, 1); err == nil {
+		t.Errorf("Expected an arity error")
+	}
+	if _, err := interpreter.Call(greeting); err == nil {
+		t.Errorf("Expected an error calling a string")
+	}
+
+	// Classes and bound methods are callables too
+	class, _ := interpreter.Global("Counter")
+	instance, err := interpreter.Call(class, 1)
+	if err != nil {
+		t.Fatalf("Failed to construct instance: %v", err)
+	}
+	if _, isInstance := instance.(*interpret.Instance); !isInstance {
+		t.Errorf("Expected an instance, got: %v", instance)
+	}
+
+	_, err = run(&interpreter, "var next = counter.next;")
+	if err != nil {
+		t.Fatalf("Failed to run script: %v", err)
+	}
+	next, _ := interpreter.Global("next")
+	count, err := interpreter.Call(next)
+	if err != nil || count != 11.0 {
+		t.Errorf("Expected: 11\nActual: %v (%v)\n", count, err)
+	}
+}
+
+// Calls from Go get the same frames and error wrapping as calls in a script
+func TestCallFromGoLikeScript(t *testing.T) {
+	interpreter := interpret.Create()
+	interpreter.DefineNative("fail", 0, func(arguments []any) (any, error) {
+		return nil, errHost
+	})
+	_, err := run(&interpreter, "fun broken() { return 1 + nil; }")
+	if err != nil {
+		t.Fatalf("Failed to run script: %v", err)
+	}
+
+	var runtimeErr *glox_error.RuntimeError
+	broken, _ := interpreter.Global("broken")
+	_, err = interpreter.Call(broken)
+	if !errors.As(err, &runtimeErr) || len(runtimeErr.Trace) == 0 || runtimeErr.Trace[0].Name != "broken" {
+		t.Errorf("Expected a runtime error with a broken frame, got: %v", err)
+	}
+
+	fail, _ := interpreter.Global("fail")
+	_, err = interpreter.Call(fail)
+	if !errors.As(err, &runtimeErr) || runtimeErr.Code != glox_error.NATIVE_FAILURE || !errors.Is(err, errHost) {
+		t.Errorf("Expected the host error to be wrapped, got: %v", err)
+	}
+}
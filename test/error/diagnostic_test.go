@@ -0,0 +1,117 @@
+package test
+
+import (
+	"dsoechting/glox/compile"
+	glox_error "dsoechting/glox/error"
+	"dsoechting/glox/interpret"
+	"dsoechting/glox/parse"
+	"dsoechting/glox/resolve"
+	"dsoechting/glox/scanner"
+	"dsoechting/glox/vm"
+	"errors"
+	"io"
+	"testing"
+)
+
+// Runs source through every phase of the tree walker, returning the first failure
+func runTree(source string) error {
+	tokens, scanErr := scanner.Create(source).ScanTokens()
+	if scanErr != nil {
+		return scanErr
+	}
+	parser := parse.Create(tokens)
+	statements, parseErr := parser.Parse()
+	if parseErr != nil {
+		return parseErr
+	}
+	interpreter := interpret.CreateWithOptions(interpret.Options{Stdout: io.Discard})
+	resolveErr := resolve.Create(&interpreter).Resolve(statements)
+	if resolveErr != nil {
+		return resolveErr
+	}
+	_, runErr := interpreter.Interpret(statements)
+	return runErr
+}
+
+func TestEachPhaseHasItsOwnType(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		target any
+		code   glox_error.Code
+	}{
+		{"scan", "var a = #;", new(*glox_error.ScanError), glox_error.UNEXPECTED_CHARACTER},
+		{"parse", "var = 1;", new(*glox_error.ParseError), glox_error.EXPECTED_TOKEN},
+		{"resolve", "{ var a = 1; var a = 2; }", new(*glox_error.ResolveError), glox_error.ALREADY_DECLARED},
+		{"runtime", "print -\"a\";", new(*glox_error.RuntimeError), glox_error.INVALID_OPERAND},
+		{"undefined", "print nope;", new(*glox_error.RuntimeError), glox_error.UNDEFINED_VARIABLE},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := runTree(test.source)
+			if err == nil {
+				t.Fatal("Expected an error")
+			}
+			if !errors.As(err, test.target) {
+				t.Fatalf("Expected %T, got %T: %v", test.target, err, err)
+			}
+			var reportable glox_error.Reportable
+			if !errors.As(err, &reportable) {
+				t.Fatalf("%T is not reportable", err)
+			}
+			diagnostic := reportable.Details()
+			if diagnostic.Code != test.code {
+				t.Errorf("Expected code %s, got %s", test.code, diagnostic.Code)
+			}
+			if diagnostic.Severity != glox_error.ERROR {
+				t.Errorf("Expected an error severity, got %s", diagnostic.Severity)
+			}
+			if !diagnostic.Span.IsKnown() {
+				t.Errorf("Expected a span for %v", err)
+			}
+		})
+	}
+}
+
+func TestCompilerAndVMDiagnostics(t *testing.T) {
+	tokens, _ := scanner.Create("return 1;").ScanTokens()
+	parser := parse.Create(tokens)
+	statements, _ := parser.Parse()
+	_, compileErr := compile.Compile(statements)
+	var compileError *glox_error.CompileError
+	if !errors.As(compileErr, &compileError) || compileError.Code != glox_error.TOP_LEVEL_RETURN {
+		t.Fatalf("Expected a top level return compile error, got %v", compileErr)
+	}
+
+	tokens, _ = scanner.Create("\n\nnil();").ScanTokens()
+	parser = parse.Create(tokens)
+	statements, _ = parser.Parse()
+	function, compileErr := compile.Compile(statements)
+	if compileErr != nil {
+		t.Fatalf("Failed to compile: %v", compileErr)
+	}
+	_, runErr := vm.CreateWithOptions(vm.Options{Stdout: io.Discard}).Interpret(function)
+	var runtimeError *glox_error.RuntimeError
+	if !errors.As(runErr, &runtimeError) || runtimeError.Code != glox_error.NOT_CALLABLE {
+		t.Fatalf("Expected a not callable runtime error, got %v", runErr)
+	}
+	if runtimeError.Line != 3 {
+		t.Errorf("Expected line 3, got %d", runtimeError.Line)
+	}
+}
+
+// Operand errors name the operator, like the parser and resolver name their token
+func TestOperandErrorWhere(t *testing.T) {
+	tests := map[string]string{
+		`print 1 + "a";`:    "[line 1] Error  at '+': Operands must be two numbers or two strings.",
+		`print 1 < "a";`:    "[line 1] Error  at '<': Operands must be numbers.",
+		"print -\"a\";":     "[line 1] Error  at '-': Operand must be a number.",
+		"\nprint nil == 1;": "[line 2] Error  at '==': Operands must be numbers.",
+	}
+	for source, expected := range tests {
+		err := runTree(source)
+		if err == nil || err.Error() != expected {
+			t.Errorf("Expected: %s\nActual: %v", expected, err)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package test
+
+import (
+	"bytes"
+	"dsoechting/glox/compile"
+	glox_error "dsoechting/glox/error"
+	"dsoechting/glox/parse"
+	"dsoechting/glox/scanner"
+	"dsoechting/glox/vm"
+	"encoding/json"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestJSONDiagnostics(t *testing.T) {
+	source := "var a = 1;\nprint (a +\n  2;\nprint b;"
+	err := runTree(source)
+	if err == nil {
+		t.Fatal("Expected an error")
+	}
+
+	var out bytes.Buffer
+	if writeErr := glox_error.WriteJSON(&out, "script.glox", source, err); writeErr != nil {
+		t.Fatalf("Failed to write: %v", writeErr)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("Expected one JSON line, got %d:\n%s", len(lines), out.String())
+	}
+	var decoded glox_error.JSONDiagnostic
+	if jsonErr := json.Unmarshal([]byte(lines[0]), &decoded); jsonErr != nil {
+		t.Fatalf("Invalid JSON %q: %v", lines[0], jsonErr)
+	}
+
+	expected := glox_error.JSONDiagnostic{
+		File:      "script.glox",
+		Line:      3,
+		Column:    4,
+		EndLine:   3,
+		EndColumn: 5,
+		Code:      glox_error.EXPECTED_TOKEN,
+		Severity:  "error",
+		Message:   "Expect ')' after expression",
+	}
+	if len(decoded.Notes) != 1 || decoded.Notes[0].Line != 2 || decoded.Notes[0].Column != 7 {
+		t.Errorf("Expected a note at 2:7, got %+v", decoded.Notes)
+	}
+	decoded.Notes = nil
+	if !reflect.DeepEqual(decoded, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, decoded)
+	}
+}
+
+func TestJSONRuntimeAndPlainErrors(t *testing.T) {
+	source := "print 1;\nprint missing;"
+	runErr := runTree(source)
+	joined := errors.Join(runErr, errors.New("compiled glox file is corrupt"))
+
+	converted := glox_error.ToJSON("a.glox", source, joined)
+	if len(converted) != 2 {
+		t.Fatalf("Expected 2 diagnostics, got %d", len(converted))
+	}
+	if converted[0].Code != glox_error.UNDEFINED_VARIABLE || converted[0].Line != 2 || converted[0].Column != 7 || converted[0].EndColumn != 14 {
+		t.Errorf("Unexpected runtime diagnostic %+v", converted[0])
+	}
+	if converted[1].Code != "" || converted[1].Message != "compiled glox file is corrupt" || converted[1].Severity != "error" {
+		t.Errorf("Unexpected plain diagnostic %+v", converted[1])
+	}
+}
+
+// The VM keeps token spans in its line table, so its errors point as precisely as the tree walker's
+func TestVMRuntimeErrorSpan(t *testing.T) {
+	source := "var a = 1;\nprint a + \"b\";"
+	tokens, _ := scanner.Create(source).ScanTokens()
+	parser := parse.Create(tokens)
+	statements, _ := parser.Parse()
+	function, compileErr := compile.Compile(statements)
+	if compileErr != nil {
+		t.Fatalf("Failed to compile: %v", compileErr)
+	}
+
+	var encoded bytes.Buffer
+	compile.Encode(&encoded, function)
+	decoded, decodeErr := compile.Decode(encoded.Bytes())
+	if decodeErr != nil {
+		t.Fatalf("Failed to decode: %v", decodeErr)
+	}
+
+	for name, function := range map[string]*compile.Function{"compiled": function, "decoded": decoded} {
+		_, runErr := vm.CreateWithOptions(vm.Options{Stdout: io.Discard}).Interpret(function)
+		if runErr == nil {
+			t.Fatalf("Expected a runtime error (%s)", name)
+		}
+
+		rendered := glox_error.Render(source, runErr)
+		if !strings.Contains(rendered, " 2 | print a + \"b\";\n   |         ^") {
+			t.Errorf("Expected a caret under '+' (%s), got:\n%s", name, rendered)
+		}
+
+		converted := glox_error.ToJSON("a.glox", source, runErr)
+		if len(converted) != 1 {
+			t.Fatalf("Expected 1 diagnostic (%s), got %d", name, len(converted))
+		}
+		diagnostic := converted[0]
+		if diagnostic.Line != 2 || diagnostic.Column != 9 || diagnostic.EndLine != 2 || diagnostic.EndColumn != 10 {
+			t.Errorf("Expected a span of 2:9 to 2:10 (%s), got %+v", name, diagnostic)
+		}
+	}
+}
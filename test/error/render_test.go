@@ -0,0 +1,70 @@
+package test
+
+import (
+	glox_error "dsoechting/glox/error"
+	"dsoechting/glox/parse"
+	"dsoechting/glox/scanner"
+	"errors"
+	"testing"
+)
+
+func TestRenderUnderlinesSpan(t *testing.T) {
+	source := "var a = 1;\n\tprint a + ;\n"
+	tokens, scanErr := scanner.Create(source).ScanTokens()
+	if scanErr != nil {
+		t.Fatalf("Failed to scan: %v", scanErr)
+	}
+	parser := parse.Create(tokens)
+	_, parseErr := parser.Parse()
+	if parseErr == nil {
+		t.Fatal("Expected a parse error")
+	}
+
+	expected := "[line 2] Error  at ';' of token type 'SEMICOLON': Expect expression.\n" +
+		" 2 | \tprint a + ;\n" +
+		"   | \t          ^"
+	if rendered := glox_error.Render(source, parseErr); rendered != expected {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expected, rendered)
+	}
+}
+
+func TestRenderUnderlinesWholeToken(t *testing.T) {
+	source := "print 1 +\n  undefinedThing;"
+	diagnostic := glox_error.Create(glox_error.UNDEFINED_VARIABLE, 2, "", "Undefined variable 'undefinedThing'.")
+	diagnostic.Span = glox_error.Span{Column: 3, Start: 12, End: 26}
+	err := &glox_error.RuntimeError{Diagnostic: diagnostic}
+
+	expected := "[line 2] Error : Undefined variable 'undefinedThing'.\n" +
+		" 2 |   undefinedThing;\n" +
+		"   |   ^^^^^^^^^^^^^^"
+	if rendered := glox_error.Render(source, err); rendered != expected {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expected, rendered)
+	}
+}
+
+func TestRenderShowsNotes(t *testing.T) {
+	source := "print (1 +\n  2;"
+	tokens, scanErr := scanner.Create(source).ScanTokens()
+	if scanErr != nil {
+		t.Fatalf("Failed to scan: %v", scanErr)
+	}
+	parser := parse.Create(tokens)
+	_, parseErr := parser.Parse()
+
+	expected := "[line 2] Error  at ';' of token type 'SEMICOLON': Expect ')' after expression\n" +
+		" 2 |   2;\n" +
+		"   |    ^\n" +
+		"  note: '(' opened here\n" +
+		" 1 | print (1 +\n" +
+		"   |       ^"
+	if rendered := glox_error.Render(source, parseErr); rendered != expected {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expected, rendered)
+	}
+}
+
+func TestRenderWithoutSpan(t *testing.T) {
+	err := errors.New("plain")
+	if rendered := glox_error.Render("print 1;", err); rendered != "plain" {
+		t.Errorf("Expected the bare message, got %q", rendered)
+	}
+}
@@ -0,0 +1,105 @@
+package test
+
+import (
+	"dsoechting/glox/compile"
+	glox_error "dsoechting/glox/error"
+	"dsoechting/glox/parse"
+	"dsoechting/glox/scanner"
+	"dsoechting/glox/vm"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func runVM(source string) error {
+	tokens, scanErr := scanner.Create(source).ScanTokens()
+	if scanErr != nil {
+		return scanErr
+	}
+	parser := parse.Create(tokens)
+	statements, parseErr := parser.Parse()
+	if parseErr != nil {
+		return parseErr
+	}
+	function, compileErr := compile.Compile(statements)
+	if compileErr != nil {
+		return compileErr
+	}
+	_, runErr := vm.CreateWithOptions(vm.Options{Stdout: io.Discard}).Interpret(function)
+	return runErr
+}
+
+const nestedSource = `fun outer() {
+  return inner();
+}
+fun inner() {
+  return 1 + nil;
+}
+print outer();
+`
+
+func TestTraceListsFramesInnermostFirst(t *testing.T) {
+	expected := []glox_error.Frame{
+		{Name: "inner", Line: 5},
+		{Name: "outer", Line: 2},
+		{Name: glox_error.SCRIPT_FRAME, Line: 7},
+	}
+	backends := map[string]func(string) error{"tree": runTree, "vm": runVM}
+	for name, run := range backends {
+		t.Run(name, func(t *testing.T) {
+			var runtimeErr *glox_error.RuntimeError
+			if err := run(nestedSource); !errors.As(err, &runtimeErr) {
+				t.Fatalf("Expected a runtime error, got %v", err)
+			}
+			if !reflect.DeepEqual(runtimeErr.Trace, expected) {
+				t.Errorf("Expected %+v, got %+v", expected, runtimeErr.Trace)
+			}
+		})
+	}
+}
+
+func TestTracebackRendering(t *testing.T) {
+	var runtimeErr *glox_error.RuntimeError
+	if err := runTree(nestedSource); !errors.As(err, &runtimeErr) {
+		t.Fatalf("Expected a runtime error, got %v", err)
+	}
+	runtimeErr.SetFile("nested.glox")
+
+	rendered := glox_error.Render(nestedSource, runtimeErr)
+	expected := `Traceback (most recent call last):
+  File "nested.glox", line 7, in script
+    print outer();
+  File "nested.glox", line 2, in outer
+    return inner();
+  File "nested.glox", line 5, in inner
+    return 1 + nil;
+`
+	if !strings.HasPrefix(rendered, expected) {
+		t.Errorf("Expected traceback:\n%s\ngot:\n%s", expected, rendered)
+	}
+}
+
+// Only the VM has a frame limit, the tree walker recurses as deep as Go lets it
+func TestDeepRecursionOverflows(t *testing.T) {
+	source := "fun r(n) {\n  return r(n + 1);\n}\nr(0);"
+	var runtimeErr *glox_error.RuntimeError
+	if err := runVM(source); !errors.As(err, &runtimeErr) || runtimeErr.Code != glox_error.STACK_OVERFLOW {
+		t.Fatalf("Expected a stack overflow, got %v", err)
+	}
+	if len(runtimeErr.Trace) != vm.FRAMES_MAX {
+		t.Errorf("Expected %d frames, got %d", vm.FRAMES_MAX, len(runtimeErr.Trace))
+	}
+	rendered := glox_error.Render(source, runtimeErr)
+	if !strings.Contains(rendered, "[Previous frame repeated 252 more times]") {
+		t.Errorf("Expected repeated frames to collapse, got:\n%s", rendered)
+	}
+}
+
+func TestTreeWalkerRecursesPastTheVMLimit(t *testing.T) {
+	source := "fun count(n) {\n  if (n < 1) return 0;\n  return 1 + count(n - 1);\n}\nprint count(1000);"
+	if err := runTree(source); err != nil {
+		t.Errorf("Expected deep recursion to work, got %v", err)
+	}
+}
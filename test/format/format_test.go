@@ -0,0 +1,133 @@
+package test
+
+import (
+	"dsoechting/glox/format"
+	"strings"
+	"testing"
+)
+
+func TestCanonicalStyle(t *testing.T) {
+	tests := []struct {
+		name     string
+		source   string
+		expected string
+	}{
+		{"spacing", "var   a=1+2*-b;print(a)?\"x\":nil;", "var a = 1 + 2 * -b;\nprint (a) ? \"x\" : nil;\n"},
+		{"one statement per line", "var a; a = 1; print a;", "var a;\na = 1;\nprint a;\n"},
+		{"braces", "fun add(a,b){return a+b;}", "fun add(a, b) {\n  return a + b;\n}\n"},
+		{"empty block", "{   }", "{}\n"},
+		{
+			"class",
+			"class B<A{init(x){this.x=x;}get(){return super.get();}}",
+			"class B < A {\n  init(x) {\n    this.x = x;\n  }\n  get() {\n    return super.get();\n  }\n}\n",
+		},
+		{
+			"if else",
+			"if(a)print 1;else if(b){print 2;}else print 3;",
+			"if (a)\n  print 1;\nelse if (b) {\n  print 2;\n} else\n  print 3;\n",
+		},
+		{"while", "while(a<3)a=a+1;", "while (a < 3)\n  a = a + 1;\n"},
+		{"for", "for(var i=0;i<3;i=i+1){print i;}", "for (var i = 0; i < 3; i = i + 1) {\n  print i;\n}\n"},
+		{"for without clauses", "for(;;)print 1;", "for (;;)\n  print 1;\n"},
+		{"for without increment", "for(i=0;i<3;){i=i+1;}", "for (i = 0; i < 3;) {\n  i = i + 1;\n}\n"},
+		{"for without initializer", "for(;i<3;i=i+1)print i;", "for (; i < 3; i = i + 1)\n  print i;\n"},
+		{"blank lines", "var a;\n\n\n\nvar b;\n{\n\nprint a;\n\n}", "var a;\n\nvar b;\n{\n  print a;\n}\n"},
+		{"literals keep their spelling", "print 1.50 + 2;", "print 1.50 + 2;\n"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			formatted, err := format.Source(test.source)
+			if err != nil {
+				t.Fatalf("Failed to format: %v", err)
+			}
+			if formatted != test.expected {
+				t.Errorf("Expected:\n%s\nGot:\n%s", test.expected, formatted)
+			}
+		})
+	}
+}
+
+func TestCommentsSurvive(t *testing.T) {
+	source := `// header
+
+/* block
+   comment */
+var a=1;   // trailing
+fun f(){ // opens
+  // inside
+  return a+ // half
+    1;
+  // before the brace
+}
+print f(/* inline */ 2);
+// end
+`
+	expected := `// header
+
+/* block
+   comment */
+var a = 1; // trailing
+fun f() { // opens
+  // inside
+  return a + // half
+    1;
+  // before the brace
+}
+print f(/* inline */ 2);
+// end
+`
+	formatted, err := format.Source(source)
+	if err != nil {
+		t.Fatalf("Failed to format: %v", err)
+	}
+	if formatted != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, formatted)
+	}
+}
+
+func TestFormattingIsIdempotent(t *testing.T) {
+	source := "class A{m(){for(var i=0;i<2;i=i+1){if(i)print i;else{print -i;}}}} // done\n/* a */ var x=A().m();\n"
+	once, err := format.Source(source)
+	if err != nil {
+		t.Fatalf("Failed to format: %v", err)
+	}
+	twice, err := format.Source(once)
+	if err != nil {
+		t.Fatalf("Failed to format the result: %v", err)
+	}
+	if once != twice {
+		t.Errorf("Formatting again changed:\n%s\ninto:\n%s", once, twice)
+	}
+}
+
+func TestSyntaxErrorsAreReturned(t *testing.T) {
+	if _, err := format.Source("var a = ;"); err == nil || !strings.Contains(err.Error(), "Expect expression.") {
+		t.Errorf("Expected the parse error, got %v", err)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	old := "a\nb\nc\nd\ne\nf\ng\nh\ni\nj\nk\nl\nm\n"
+	new := "a\nB\nc\nd\ne\nf\ng\nh\ni\nj\nk\nl\nm\nn\n"
+	expected := `--- old
++++ new
+@@ -1,5 +1,5 @@
+ a
+-b
++B
+ c
+ d
+ e
+@@ -11,3 +11,4 @@
+ k
+ l
+ m
++n
+`
+	if diff := format.Diff("old", "new", old, new); diff != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, diff)
+	}
+	if diff := format.Diff("old", "new", old, old); diff != "" {
+		t.Errorf("Expected no diff for equal texts, got:\n%s", diff)
+	}
+}
@@ -0,0 +1,64 @@
+package test
+
+import (
+	"dsoechting/glox/golden"
+	"reflect"
+	"testing"
+)
+
+func TestParseAnnotations(t *testing.T) {
+	source := "print 1; // expect: 1\nprint x; // expect runtime error: Undefined variable 'x'.\nvar = 1; // Error at '=': Expect variable name.\n// [line 7] Error at end: Expect '}' after block."
+	expectations := golden.Parse(source)
+	expected := golden.Expectations{
+		Output:       []golden.Expected{{Line: 1, Text: "1"}},
+		RuntimeError: &golden.Expected{Line: 2, Text: "Undefined variable 'x'."},
+		Errors: []golden.Expected{
+			{Line: 3, Text: "Error at '=': Expect variable name."},
+			{Line: 7, Text: "Error at end: Expect '}' after block."},
+		},
+	}
+	if !reflect.DeepEqual(expectations, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, expectations)
+	}
+}
+
+func TestCheckReportsMismatches(t *testing.T) {
+	tests := []struct {
+		name     string
+		source   string
+		expected []string
+	}{
+		{"passing", "print 1; // expect: 1", []string{}},
+		{"wrong output", "print 2; // expect: 1", []string{"Expected output '1' on line 1 and got '2'."}},
+		{"missing output", "// expect: 1", []string{"Missing expected output '1' on line 1."}},
+		{"extra output", "print 1;", []string{"Got output '1' when none was expected."}},
+		{"echo", "1 + 1; // expect echo: 2", []string{}},
+		{"wrong echo", "1; // expect echo: 2", []string{"Expected echo '2' on line 1 and got '1'."}},
+		{"echoes unchecked without annotations", "1;", []string{}},
+		{
+			"unexpected runtime error",
+			"print x;",
+			[]string{"Unexpected runtime error: [line 1] Error : Undefined variable 'x'."},
+		},
+		{
+			"runtime error that never happens",
+			"print 1; // expect: 1\n// expect runtime error: Boom.",
+			[]string{"Expected runtime error 'Boom.' on line 2 and got none."},
+		},
+		{
+			"missing static error",
+			"print 1; // expect: 1\n// Error at 'a': Boom.",
+			[]string{"Missing expected error: [line 2] Error at 'a': Boom."},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			for _, backend := range []golden.Backend{golden.Tree, golden.VM} {
+				failures := golden.Check(test.source, backend)
+				if !reflect.DeepEqual(failures, test.expected) {
+					t.Errorf("Expected %q, got %q", test.expected, failures)
+				}
+			}
+		})
+	}
+}
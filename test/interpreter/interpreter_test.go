@@ -1,79 +1,134 @@
 package test
 
 import (
-	"dsoechting/glox/interpret"
-	"dsoechting/glox/parse"
-	"dsoechting/glox/scanner"
-	"fmt"
+	"dsoechting/glox/golden"
+	"io"
 	"os"
 	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
 )
 
-type Interpreter = interpret.Interpreter
-
-type expressionTestCase struct {
-	name     string
-	input    string
-	expected string
+// Every test case runs against both the tree walker and the bytecode VM
+var backends = []struct {
+	name string
+	run  golden.Backend
+}{
+	{"tree", golden.Tree},
+	{"vm", golden.VM},
 }
 
-func TestExpressions(t *testing.T) {
-	// TODO: Dynamically iterate through all test data
-	expressionTests := []expressionTestCase{
-		{name: "Add numbers", input: "add_number_test", expected: "33"},
-		{name: "Add strings", input: "add_strings_test", expected: "firstsecond"},
-		{name: "Division", input: "div_test", expected: "11"},
-		{name: "Group", input: "group_test", expected: "true"},
-		{name: "Multiplication", input: "mult_test", expected: "27"},
-		{name: "Subtract", input: "subtract_test", expected: "1"},
-		{name: "Ternary", input: "ternary_test", expected: "27"},
+// Every .glox script under data is a test, checked against its // expect: annotations
+func TestScripts(t *testing.T) {
+	paths, findErr := golden.Find("data")
+	if findErr != nil {
+		t.Fatalf("Failed to find test scripts: %v", findErr)
+	}
+	if len(paths) == 0 {
+		t.Fatal("Found no test scripts under data")
 	}
 
-	for _, test := range expressionTests {
-		inputText, parseErr := readExpressionSnippet(test.input)
-		if parseErr != nil {
-			t.Errorf("Failed to read test input: %v\nError: %v\n", test.name, parseErr)
-		}
-		// Ideally my interpreter tests wouldn't rely on the scanner and the parser
-		// But I'm not typing out all of that test data
-		scanner := scanner.Create(inputText)
-		interpreter := Interpreter{}
-
-		tokens, _ := scanner.ScanTokens()
-		parser := parse.Create(tokens)
-		expression, _ := parser.Parse()
+	for _, path := range paths {
+		name, _ := filepath.Rel("data", path)
+		t.Run(filepath.ToSlash(name), func(t *testing.T) {
+			source, readErr := os.ReadFile(path)
+			if readErr != nil {
+				t.Fatalf("Failed to read %s: %v", path, readErr)
+			}
+			for _, backend := range backends {
+				for _, failure := range golden.Check(string(source), backend.run) {
+					t.Errorf("(%s) %s", backend.name, failure)
+				}
+			}
+		})
+	}
+}
 
-		// Run test
-		actual, evalErr := interpreter.Interpret(expression)
+func TestPrintOutput(t *testing.T) {
+	source := `
+var greeting = "hello";
+print greeting;
+fun twice(n) { return n * 2; }
+print twice(21);
+print nil;
+`
+	expected := "hello\n42\nnil\n"
 
+	for _, backend := range backends {
+		var stdout strings.Builder
+		_, evalErr := backend.run(source, &stdout)
 		if evalErr != nil {
-			t.Errorf("Error while running test: %v\nError: %v\n", test.name, evalErr)
+			t.Errorf("Error while running print test (%s)\nError: %v\n", backend.name, evalErr)
 			continue
-
 		}
-		if actual != test.expected {
-			t.Errorf("Test '%s' failed.\nExpected: %v\nActual: %v\n", test.name, test.expected, actual)
-			continue
+		if stdout.String() != expected {
+			t.Errorf("Print test (%s) failed.\nExpected: %q\nActual: %q\n", backend.name, expected, stdout.String())
 		}
-		t.Logf("Test '%s' passed.\nExpected: %v\nActual: %v\n", test.name, test.expected, actual)
 	}
 }
 
-func readExpressionSnippet(snippetName string) (string, error) {
-	filePath := filepath.Join("data", fmt.Sprintf("%s.txt", snippetName))
-	return readTestFile(filePath)
+// Only bare expression statements are echoed, so an empty string still shows
+// up while declarations, prints, and assignments don't
+func TestEcho(t *testing.T) {
+	tests := []struct {
+		source   string
+		expected []string
+	}{
+		{"1 + 2;", []string{"3"}},
+		{"2.5;", []string{"2.5"}},
+		{`"";`, []string{""}},
+		{"nil;", []string{"nil"}},
+		{"1; true;", []string{"1", "true"}},
+		{"var a = 1;", []string{}},
+		{"var a; a = 2;", []string{}},
+		{"print 1;", []string{}},
+		{"{ 1; }", []string{}},
+		{"if (true) 3;", []string{}},
+		{"var i = 0; while (i < 2) i = i + 1; for (var j = 0; j < 2; j = j + 1) j;", []string{}},
+		{"fun f() {} f();", []string{"nil"}},
+		{"fun f() {} class A {}", []string{}},
+		{"var a; var b = a = 4; b;", []string{"4"}},
+	}
+	for _, backend := range backends {
+		for _, test := range tests {
+			echoes, runErr := backend.run(test.source, io.Discard)
+			if runErr != nil {
+				t.Errorf("Error while running %q (%s)\nError: %v\n", test.source, backend.name, runErr)
+				continue
+			}
+			if !reflect.DeepEqual(echoes, test.expected) {
+				t.Errorf("Echo of %q (%s) failed.\nExpected: %q\nActual: %q\n", test.source, backend.name, test.expected, echoes)
+			}
+		}
+	}
 }
 
-func readTestFile(path string) (string, error) {
-
-	contentBytes, err := os.ReadFile(path)
-	if err != nil {
-		fmt.Printf("Error reading file: %v\n", err)
-		return "", err
+// Equality and '!' only accept numbers, like the other arithmetic operators
+func TestOperandTypes(t *testing.T) {
+	sources := []string{`"a" == "a";`, "nil != false;", "!true;", `!"";`}
+	for _, backend := range backends {
+		for _, source := range sources {
+			_, runErr := backend.run(source, io.Discard)
+			if runErr == nil || !strings.Contains(runErr.Error(), "must be") {
+				t.Errorf("Expected an operand error for %q (%s), got: %v", source, backend.name, runErr)
+			}
+		}
 	}
+}
 
-	contentString := string(contentBytes)
-
-	return contentString, nil
+// Nesting piles up temporaries within one frame, more than a call reserves on the VM's stack
+func TestDeeplyNestedExpression(t *testing.T) {
+	depth := 17000
+	source := "print " + strings.Repeat("1 + (", depth) + "1" + strings.Repeat(")", depth) + ";"
+	for _, backend := range backends {
+		var stdout strings.Builder
+		if _, runErr := backend.run(source, &stdout); runErr != nil {
+			t.Errorf("Error while running (%s)\nError: %v\n", backend.name, runErr)
+			continue
+		}
+		if stdout.String() != "17001\n" {
+			t.Errorf("Expected 17001 (%s), got %q", backend.name, stdout.String())
+		}
+	}
 }
@@ -0,0 +1,109 @@
+package test
+
+import (
+	glox_error "dsoechting/glox/error"
+	"dsoechting/glox/lint"
+	"errors"
+	"testing"
+)
+
+type finding struct {
+	code glox_error.Code
+	line int
+}
+
+func lintFindings(t *testing.T, source string) []finding {
+	t.Helper()
+	errs, parseErr := lint.Source(source, lint.DefaultRules())
+	if parseErr != nil {
+		t.Fatalf("Failed to parse: %v", parseErr)
+	}
+	findings := []finding{}
+	for _, err := range errs {
+		var lintErr *glox_error.LintError
+		if !errors.As(err, &lintErr) {
+			t.Fatalf("Expected a LintError, got %T", err)
+		}
+		if lintErr.Severity != glox_error.WARNING {
+			t.Errorf("Expected a warning, got %v", lintErr.Severity)
+		}
+		findings = append(findings, finding{lintErr.Code, lintErr.Line})
+	}
+	return findings
+}
+
+func TestRules(t *testing.T) {
+	tests := []struct {
+		name     string
+		source   string
+		expected []finding
+	}{
+		{"unused local", "fun f() {\n  var a = 1;\n}", []finding{{glox_error.UNUSED_VARIABLE, 2}}},
+		{"assigned but never read", "fun f() {\n  var a;\n  a = 1;\n}", []finding{{glox_error.UNUSED_VARIABLE, 2}}},
+		{"underscore names are ignored", "fun f() {\n  var _a = 1;\n}", nil},
+		{"globals are ignored", "var a = 1;", nil},
+		{"shadowed local", "{\n  var a = 1;\n  {\n    var a = 2;\n    print a;\n  }\n  print a;\n}", []finding{{glox_error.SHADOWED_VARIABLE, 4}}},
+		{"shadowed parameter", "fun f(a) {\n  {\n    var a = 1;\n    print a;\n  }\n  print a;\n}", []finding{{glox_error.SHADOWED_VARIABLE, 3}}},
+		{"shadowed builtin", "fun f() {\n  var clock = 1;\n  print clock;\n}", []finding{{glox_error.SHADOWED_VARIABLE, 2}}},
+		{"code after return", "fun f() {\n  return 1;\n  print 2;\n}", []finding{{glox_error.UNREACHABLE_CODE, 3}}},
+		{"code after if that returns both ways", "fun f(a) {\n  if (a) return 1; else return 2;\n  print 3;\n}", []finding{{glox_error.UNREACHABLE_CODE, 3}}},
+		{"code after if that returns one way", "fun f(a) {\n  if (a) return 1;\n  print 3;\n}", nil},
+		{"return inside a for loop", "fun f() {\n  for (var i = 0; i < 3; i = i + 1) {\n    return i;\n  }\n}", nil},
+		{"constant if", "if (1 < 2) print 1;", []finding{{glox_error.CONSTANT_CONDITION, 1}}},
+		{"constant while", "while (nil) print 1;", []finding{{glox_error.CONSTANT_CONDITION, 1}}},
+		{"while true is allowed", "fun f() {\n  while (true) return 1;\n}", nil},
+		{"for without a condition is allowed", "fun f() {\n  for (;;) return 1;\n}", nil},
+		{"variable conditions are fine", "var a = 1;\nif (a) print a;", nil},
+		{"self assignment", "var a = 1;\na = (a);", []finding{{glox_error.SELF_ASSIGNMENT, 2}}},
+		{"self field assignment", "class A {\n  init() {\n    this.x = this.x;\n  }\n}", []finding{{glox_error.SELF_ASSIGNMENT, 3}}},
+		{"field copied from another field", "class A {\n  init() {\n    this.x = this.y;\n  }\n}", nil},
+		{"string ordered against number", "print \"a\" > 1;", []finding{{glox_error.INVALID_COMPARISON, 1}}},
+		{"nil ordered", "var a = 1;\nprint a <= nil;", []finding{{glox_error.INVALID_COMPARISON, 2}}},
+		{"numbers ordered", "var a = 1;\nprint a < 2 + 3;", nil},
+		{"strings compared for equality", "print \"a\" == 1;", nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			findings := lintFindings(t, test.source)
+			if len(findings) != len(test.expected) {
+				t.Fatalf("Expected %v, got %v", test.expected, findings)
+			}
+			for index, expected := range test.expected {
+				if findings[index] != expected {
+					t.Errorf("Expected %v, got %v", test.expected, findings)
+				}
+			}
+		})
+	}
+}
+
+func TestDisableDirective(t *testing.T) {
+	source := "// lint:disable unused-variable, self-assignment\nfun f() {\n  var a = 1;\n  var b = 2;\n  b = b;\n  return 1;\n  print 3;\n}"
+	findings := lintFindings(t, source)
+	if len(findings) != 1 || findings[0] != (finding{glox_error.UNREACHABLE_CODE, 7}) {
+		t.Errorf("Expected only the unreachable code, got %v", findings)
+	}
+
+	findings = lintFindings(t, "// lint:disable\nfun f() {\n  var a = 1;\n}")
+	if len(findings) != 0 {
+		t.Errorf("Expected every rule to be off, got %v", findings)
+	}
+}
+
+func TestUnknownRuleInDirective(t *testing.T) {
+	findings := lintFindings(t, "// lint:disable no-such-rule\nvar a = 1;")
+	if len(findings) != 1 || findings[0] != (finding{glox_error.UNKNOWN_LINT_RULE, 1}) {
+		t.Errorf("Expected the unknown rule to be reported, got %v", findings)
+	}
+}
+
+func TestMessageNamesRule(t *testing.T) {
+	errs, _ := lint.Source("fun f() {\n  var a = 1;\n}", lint.DefaultRules())
+	if len(errs) != 1 {
+		t.Fatalf("Expected one finding, got %v", errs)
+	}
+	expected := "[line 2] Warning at 'a': Local variable 'a' is never used. (unused-variable)"
+	if errs[0].Error() != expected {
+		t.Errorf("Expected %q, got %q", expected, errs[0].Error())
+	}
+}
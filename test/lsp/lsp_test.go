@@ -0,0 +1,299 @@
+package test
+
+import (
+	"bufio"
+	"dsoechting/glox/lsp"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strconv"
+	"testing"
+)
+
+// Talks to a server running in the same process over a pair of pipes
+type client struct {
+	t      *testing.T
+	writer io.WriteCloser
+	reader *bufio.Reader
+	nextID int
+	served chan error
+	// Notifications that arrived while waiting for a response
+	notifications []lsp.Message
+}
+
+func startServer(t *testing.T) *client {
+	serverIn, clientOut := io.Pipe()
+	clientIn, serverOut := io.Pipe()
+	c := &client{
+		t:      t,
+		writer: clientOut,
+		reader: bufio.NewReader(clientIn),
+		served: make(chan error, 1),
+	}
+	go func() {
+		c.served <- lsp.Create(serverIn, serverOut).Serve()
+		serverOut.Close()
+	}()
+	t.Cleanup(func() { clientOut.Close() })
+
+	c.request("initialize", map[string]any{"capabilities": map[string]any{}}, nil)
+	c.notify("initialized", map[string]any{})
+	return c
+}
+
+func (c *client) send(message map[string]any) {
+	body, err := json.Marshal(message)
+	if err != nil {
+		c.t.Fatalf("Failed to encode: %v", err)
+	}
+	if _, err := fmt.Fprintf(c.writer, "Content-Length: %d\r\n\r\n%s", len(body), body); err != nil {
+		c.t.Fatalf("Failed to send: %v", err)
+	}
+}
+
+func (c *client) receive() lsp.Message {
+	headers, err := textproto.NewReader(c.reader).ReadMIMEHeader()
+	if err != nil {
+		c.t.Fatalf("Failed to read headers: %v", err)
+	}
+	length, err := strconv.Atoi(headers.Get("Content-Length"))
+	if err != nil {
+		c.t.Fatalf("Bad Content-Length: %v", err)
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(c.reader, body); err != nil {
+		c.t.Fatalf("Failed to read body: %v", err)
+	}
+	var message lsp.Message
+	if err := json.Unmarshal(body, &message); err != nil {
+		c.t.Fatalf("Bad message %s: %v", body, err)
+	}
+	return message
+}
+
+func (c *client) notify(method string, params any) {
+	c.send(map[string]any{"jsonrpc": "2.0", "method": method, "params": params})
+}
+
+// Sends a request and decodes the result of its response into result
+func (c *client) request(method string, params any, result any) *lsp.ResponseError {
+	c.nextID++
+	id := c.nextID
+	c.send(map[string]any{"jsonrpc": "2.0", "id": id, "method": method, "params": params})
+	for {
+		message := c.receive()
+		if message.ID == nil {
+			c.notifications = append(c.notifications, message)
+			continue
+		}
+		if string(*message.ID) != strconv.Itoa(id) {
+			c.t.Fatalf("Expected response %d, got %s", id, *message.ID)
+		}
+		if message.Error != nil {
+			return message.Error
+		}
+		if result != nil {
+			if err := json.Unmarshal(message.Result, result); err != nil {
+				c.t.Fatalf("Bad %s result %s: %v", method, message.Result, err)
+			}
+		}
+		return nil
+	}
+}
+
+// Waits for the diagnostics published for the next document change
+func (c *client) diagnostics() lsp.PublishDiagnosticsParams {
+	message := c.receive()
+	if message.Method != "textDocument/publishDiagnostics" {
+		c.t.Fatalf("Expected diagnostics, got %s", message.Method)
+	}
+	var params lsp.PublishDiagnosticsParams
+	if err := json.Unmarshal(message.Params, &params); err != nil {
+		c.t.Fatalf("Bad diagnostics: %v", err)
+	}
+	return params
+}
+
+const uri = "file:///project/main.glox"
+
+const source = `var total = 0;
+fun add(a, b) {
+  var sum = a + b;
+  return sum;
+}
+class Counter {
+  increment() {
+    total = add(total, 1);
+  }
+}
+print add(total, clock());
+`
+
+func open(c *client, text string) lsp.PublishDiagnosticsParams {
+	c.notify("textDocument/didOpen", map[string]any{
+		"textDocument": map[string]any{"uri": uri, "languageId": "glox", "version": 1, "text": text},
+	})
+	return c.diagnostics()
+}
+
+func at(line int, character int) map[string]any {
+	return map[string]any{
+		"textDocument": map[string]any{"uri": uri},
+		"position":     map[string]any{"line": line, "character": character},
+	}
+}
+
+func TestPublishesDiagnosticsAsYouType(t *testing.T) {
+	c := startServer(t)
+	published := open(c, source)
+	if published.URI != uri || len(published.Diagnostics) != 0 {
+		t.Fatalf("Expected a clean file, got %+v", published)
+	}
+
+	c.notify("textDocument/didChange", map[string]any{
+		"textDocument":   map[string]any{"uri": uri, "version": 2},
+		"contentChanges": []map[string]any{{"text": "var a = ;\nprint (1 +\n2;\n"}},
+	})
+	published = c.diagnostics()
+	if len(published.Diagnostics) != 2 {
+		t.Fatalf("Expected 2 syntax errors, got %+v", published.Diagnostics)
+	}
+	first := published.Diagnostics[0]
+	expectedRange := lsp.Range{Start: lsp.Position{Line: 0, Character: 8}, End: lsp.Position{Line: 0, Character: 9}}
+	if first.Range != expectedRange || first.Code != "E200" || first.Severity != lsp.SEVERITY_ERROR {
+		t.Errorf("Unexpected diagnostic %+v", first)
+	}
+	if related := published.Diagnostics[1].RelatedInformation; len(related) != 1 || related[0].Location.Range.Start.Line != 1 {
+		t.Errorf("Expected a note pointing at the '(', got %+v", related)
+	}
+
+	c.notify("textDocument/didChange", map[string]any{
+		"textDocument":   map[string]any{"uri": uri, "version": 3},
+		"contentChanges": []map[string]any{{"text": "{ var a = 1; var a = 2; }\nprint missing;\n"}},
+	})
+	published = c.diagnostics()
+	if len(published.Diagnostics) != 2 {
+		t.Fatalf("Expected a resolve error and a warning, got %+v", published.Diagnostics)
+	}
+	if published.Diagnostics[0].Code != "E301" || published.Diagnostics[1].Severity != lsp.SEVERITY_WARNING {
+		t.Errorf("Unexpected diagnostics %+v", published.Diagnostics)
+	}
+}
+
+func TestDefinitionAndReferences(t *testing.T) {
+	c := startServer(t)
+	open(c, source)
+
+	// "total" inside the method, line 8
+	var definition lsp.Location
+	if err := c.request("textDocument/definition", at(7, 6), &definition); err != nil {
+		t.Fatalf("Definition failed: %v", err)
+	}
+	expected := lsp.Range{Start: lsp.Position{Line: 0, Character: 4}, End: lsp.Position{Line: 0, Character: 9}}
+	if definition.URI != uri || definition.Range != expected {
+		t.Errorf("Expected the var on line 1, got %+v", definition)
+	}
+
+	// "sum" on the return line resolves to the local, not anything global
+	if err := c.request("textDocument/definition", at(3, 10), &definition); err != nil {
+		t.Fatalf("Definition failed: %v", err)
+	}
+	if definition.Range.Start != (lsp.Position{Line: 2, Character: 6}) {
+		t.Errorf("Expected the local sum, got %+v", definition.Range)
+	}
+
+	params := at(1, 5)
+	params["context"] = map[string]any{"includeDeclaration": true}
+	var references []lsp.Location
+	if err := c.request("textDocument/references", params, &references); err != nil {
+		t.Fatalf("References failed: %v", err)
+	}
+	lines := []int{}
+	for _, reference := range references {
+		lines = append(lines, reference.Range.Start.Line)
+	}
+	if fmt.Sprint(lines) != "[1 7 10]" {
+		t.Errorf("Expected add on lines [1 7 10], got %v", lines)
+	}
+}
+
+func TestHoverAndSymbols(t *testing.T) {
+	c := startServer(t)
+	open(c, source)
+
+	var hover lsp.Hover
+	if err := c.request("textDocument/hover", at(10, 7), &hover); err != nil {
+		t.Fatalf("Hover failed: %v", err)
+	}
+	if hover.Contents.Value != "```glox\nfun add(a, b)\n```\n\n2 references" {
+		t.Errorf("Unexpected hover %q", hover.Contents.Value)
+	}
+
+	var symbols []lsp.DocumentSymbol
+	if err := c.request("textDocument/documentSymbol", map[string]any{"textDocument": map[string]any{"uri": uri}}, &symbols); err != nil {
+		t.Fatalf("Symbols failed: %v", err)
+	}
+	names := []string{}
+	for _, symbol := range symbols {
+		names = append(names, symbol.Name)
+	}
+	if fmt.Sprint(names) != "[total add Counter]" {
+		t.Fatalf("Expected the top level declarations, got %v", names)
+	}
+	add := symbols[1]
+	if add.Kind != lsp.SYMBOL_FUNCTION || add.Range.Start.Line != 1 || add.Range.End.Line != 4 {
+		t.Errorf("Unexpected add symbol %+v", add)
+	}
+	if len(add.Children) != 3 || add.Children[2].Name != "sum" {
+		t.Errorf("Expected add's parameters and local as children, got %+v", add.Children)
+	}
+	counter := symbols[2]
+	if len(counter.Children) != 1 || counter.Children[0].Kind != lsp.SYMBOL_METHOD {
+		t.Errorf("Expected the increment method, got %+v", counter.Children)
+	}
+}
+
+func TestShutdownAndExit(t *testing.T) {
+	c := startServer(t)
+	if err := c.request("textDocument/formatting", at(0, 0), nil); err == nil || err.Code != lsp.METHOD_NOT_FOUND {
+		t.Errorf("Expected method not found, got %v", err)
+	}
+	if err := c.request("shutdown", nil, nil); err != nil {
+		t.Fatalf("Shutdown failed: %v", err)
+	}
+	c.notify("exit", nil)
+	if err := <-c.served; err != nil {
+		t.Errorf("Expected a clean exit, got %v", err)
+	}
+}
+
+// A bad frame gets a parse error, and the next message is handled as usual
+func TestMalformedMessages(t *testing.T) {
+	c := startServer(t)
+	frames := []string{
+		"Content-Length: 9\r\n\r\n{\"broken\"",
+		"Content-Length: nine\r\n\r\n",
+		"Content-Length: -1\r\n\r\n",
+	}
+	for _, frame := range frames {
+		if _, err := io.WriteString(c.writer, frame); err != nil {
+			t.Fatalf("Failed to send: %v", err)
+		}
+		response := c.receive()
+		if response.Error == nil || response.Error.Code != lsp.PARSE_ERROR {
+			t.Errorf("Expected a parse error for %q, got %+v", frame, response)
+		}
+	}
+
+	if diagnostics := open(c, "print 1;"); len(diagnostics.Diagnostics) != 0 {
+		t.Errorf("Expected the server to keep working, got %+v", diagnostics)
+	}
+	if err := c.request("shutdown", nil, nil); err != nil {
+		t.Fatalf("Shutdown failed: %v", err)
+	}
+	c.notify("exit", nil)
+	if err := <-c.served; err != nil {
+		t.Errorf("Expected a clean exit, got %v", err)
+	}
+}
@@ -0,0 +1,190 @@
+package test
+
+import (
+	"dsoechting/glox/ast"
+	"dsoechting/glox/parse"
+	"dsoechting/glox/scanner"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func parseSource(t *testing.T, text string) ([]parse.Stmt, error) {
+	tokens, scanErr := scanner.Create(text).ScanTokens()
+	if scanErr != nil {
+		t.Fatalf("Failed to scan: %v", scanErr)
+	}
+	parser := parse.Create(tokens)
+	return parser.Parse()
+}
+
+func TestReportsEverySyntaxError(t *testing.T) {
+	source := `var a = ;
+print "ok";
+fun f(a) { return a + ; }
+{
+  var = 2;
+  print "inside";
+}
+print (1 + ;
+`
+	statements, parseErr := parseSource(t, source)
+
+	var errs parse.Errors
+	if !errors.As(parseErr, &errs) {
+		t.Fatalf("Expected parse.Errors, got %v", parseErr)
+	}
+	expectedLines := []string{"[line 1]", "[line 3]", "[line 5]", "[line 8]"}
+	if len(errs) != len(expectedLines) {
+		t.Fatalf("Expected %d errors, got %d:\n%v", len(expectedLines), len(errs), parseErr)
+	}
+	for i, prefix := range expectedLines {
+		if !strings.HasPrefix(errs[i].Error(), prefix) {
+			t.Errorf("Error %d: expected %q prefix, got %q", i, prefix, errs[i].Error())
+		}
+	}
+
+	// The print on line 2, the function on line 3 and the block on line 4 still parse
+	if len(statements) != 3 {
+		t.Fatalf("Expected 3 recovered statements, got %d", len(statements))
+	}
+	block, isBlock := statements[2].(*ast.BlockStmt)
+	if !isBlock {
+		t.Fatalf("Expected a block, got %T", statements[2])
+	}
+	if len(block.Statements) != 1 {
+		t.Errorf("Expected the block to keep 1 statement, got %d", len(block.Statements))
+	}
+}
+
+// A '}' is only a place to resume inside a block. Elsewhere it belongs to the
+// broken declaration, and stopping there would report it a second time
+func TestRecoveryAroundBraces(t *testing.T) {
+	tests := []struct {
+		source   string
+		expected int
+	}{
+		{"fun f( { }", 1},
+		{"fun f( { print 2; }", 1},
+		{"fun f( { if (true) { print 2; } }\nprint 3 +;", 2},
+		{"class { }", 1},
+		{"{ print 1 + }", 1},
+		{"{ fun f( { } print 1; }", 1},
+		{"fun f() {\n  var = 1;\n  print 2 +;\n}", 2},
+	}
+	for _, test := range tests {
+		_, parseErr := parseSource(t, test.source)
+		var errs parse.Errors
+		if !errors.As(parseErr, &errs) {
+			t.Errorf("Expected parse.Errors for %q, got %v", test.source, parseErr)
+			continue
+		}
+		if len(errs) != test.expected {
+			t.Errorf("Expected %d errors for %q, got %d:\n%v", test.expected, test.source, len(errs), parseErr)
+		}
+	}
+}
+
+func TestValidSourceHasNoErrors(t *testing.T) {
+	statements, parseErr := parseSource(t, "var a = 1;\nprint a;\n")
+	if parseErr != nil {
+		t.Fatalf("Unexpected error: %v", parseErr)
+	}
+	if len(statements) != 2 {
+		t.Errorf("Expected 2 statements, got %d", len(statements))
+	}
+}
+
+func TestIncompleteInput(t *testing.T) {
+	tests := []struct {
+		source       string
+		isIncomplete bool
+	}{
+		{"{\n  print 1;\n", true},
+		{"if (a) {", true},
+		{"print (1 +", true},
+		{"print 1 +\n", true},
+		{"fun f(a,", true},
+		{"print 1", true},
+		{"print 1;", false},
+		{"print );", false},
+		{"print ); {", false},
+	}
+	for _, test := range tests {
+		_, parseErr := parseSource(t, test.source)
+		if parse.IsIncomplete(parseErr) != test.isIncomplete {
+			t.Errorf("Expected IsIncomplete(%q) to be %t, error was %v", test.source, test.isIncomplete, parseErr)
+		}
+	}
+}
+
+func TestFunctionDeclaration(t *testing.T) {
+	statements, parseErr := parseSource(t, "fun add(a, b) { return a + b; }\nadd(1, 2);\n")
+	if parseErr != nil {
+		t.Fatalf("Failed to parse: %v", parseErr)
+	}
+
+	function, isFunction := statements[0].(*ast.FunctionStmt)
+	if !isFunction {
+		t.Fatalf("Expected a function, got %T", statements[0])
+	}
+	if function.Name.Lexeme != "add" || len(function.Params) != 2 || len(function.Body) != 1 {
+		t.Errorf("Unexpected function: %s with %d params and %d statements", function.Name.Lexeme, len(function.Params), len(function.Body))
+	}
+	if _, isReturn := function.Body[0].(*ast.ReturnStmt); !isReturn {
+		t.Errorf("Expected a return, got %T", function.Body[0])
+	}
+
+	call, isCall := statements[1].(*ast.ExpressionStmt).Expression.(*ast.CallExpr)
+	if !isCall || len(call.Arguments) != 2 {
+		t.Errorf("Expected a call with 2 arguments, got %#v", statements[1])
+	}
+}
+
+func TestTooManyParameters(t *testing.T) {
+	params := make([]string, 256)
+	for i := range params {
+		params[i] = fmt.Sprintf("p%d", i)
+	}
+	list := strings.Join(params, ", ")
+
+	_, parseErr := parseSource(t, fmt.Sprintf("fun f(%s) {}\n", list))
+	if parseErr == nil || !strings.Contains(parseErr.Error(), "Can't have more than 255 parameters.") {
+		t.Errorf("Expected a parameter limit error, got: %v", parseErr)
+	}
+	_, parseErr = parseSource(t, fmt.Sprintf("f(%s);\n", list))
+	if parseErr == nil || !strings.Contains(parseErr.Error(), "Can't have more than 255 arguments.") {
+		t.Errorf("Expected an argument limit error, got: %v", parseErr)
+	}
+}
+
+func TestClassDeclaration(t *testing.T) {
+	statements, parseErr := parseSource(t, "class B < A {\n  init(x) { this.x = x; }\n  get() { return super.get(); }\n}\n")
+	if parseErr != nil {
+		t.Fatalf("Failed to parse: %v", parseErr)
+	}
+
+	class, isClass := statements[0].(*ast.ClassStmt)
+	if !isClass {
+		t.Fatalf("Expected a class, got %T", statements[0])
+	}
+	if class.Superclass == nil || class.Superclass.Name.Lexeme != "A" {
+		t.Errorf("Expected superclass A, got %#v", class.Superclass)
+	}
+	if len(class.Methods) != 2 || class.Methods[0].Name.Lexeme != "init" || class.Methods[1].Name.Lexeme != "get" {
+		t.Errorf("Expected methods init and get, got %d methods", len(class.Methods))
+	}
+
+	set, isSet := class.Methods[0].Body[0].(*ast.ExpressionStmt).Expression.(*ast.SetExpr)
+	if !isSet {
+		t.Fatalf("Expected a set expression in init")
+	}
+	if _, isThis := set.Object.(*ast.ThisExpr); !isThis || set.Name.Lexeme != "x" {
+		t.Errorf("Expected this.x, got %#v", set)
+	}
+	returned := class.Methods[1].Body[0].(*ast.ReturnStmt).Value.(*ast.CallExpr)
+	if super, isSuper := returned.Callee.(*ast.SuperExpr); !isSuper || super.Method.Lexeme != "get" {
+		t.Errorf("Expected super.get, got %#v", returned.Callee)
+	}
+}
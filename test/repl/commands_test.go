@@ -0,0 +1,46 @@
+package test
+
+import (
+	"dsoechting/glox/repl"
+	"strings"
+	"testing"
+)
+
+func TestCommandDispatch(t *testing.T) {
+	var output strings.Builder
+	commands := repl.CreateCommands(&output)
+	received := ""
+	commands.Add(repl.Command{Name: "load", Usage: ":load file.glox", Help: "run a script", Run: func(args string) error {
+		if args == "" {
+			return repl.ErrUsage
+		}
+		received = args
+		return nil
+	}})
+
+	if runErr := commands.Run("  :load   script.glox "); runErr != nil || received != "script.glox" {
+		t.Errorf("Expected the trimmed argument, got %q (%v)", received, runErr)
+	}
+	if runErr := commands.Run(":load"); runErr == nil || runErr.Error() != "Usage :load file.glox" {
+		t.Errorf("Expected the usage, got %v", runErr)
+	}
+	if runErr := commands.Run(":nope"); runErr == nil || runErr.Error() != "Unknown command ':nope', try :help" {
+		t.Errorf("Expected an unknown command error, got %v", runErr)
+	}
+
+	if runErr := commands.Run(":help"); runErr != nil {
+		t.Fatalf("Unexpected error: %v", runErr)
+	}
+	expected := ":help            show these commands\n:load file.glox  run a script\n"
+	if output.String() != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, output.String())
+	}
+}
+
+func TestIsCommand(t *testing.T) {
+	for line, expected := range map[string]bool{":env": true, "  :env": true, "print 1;": false, "": false} {
+		if repl.IsCommand(line) != expected {
+			t.Errorf("Expected IsCommand(%q) to be %t", line, expected)
+		}
+	}
+}
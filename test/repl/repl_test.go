@@ -0,0 +1,191 @@
+package test
+
+import (
+	"bufio"
+	"dsoechting/glox/repl"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// An editor reading keys as a raw terminal would send them
+func editor(t *testing.T, keys string, history *repl.History) *repl.Editor {
+	t.Helper()
+	if history == nil {
+		history, _ = repl.LoadHistory("")
+	}
+	editor := repl.Create(bufio.NewReader(strings.NewReader(keys)), io.Discard, history)
+	editor.EnableEditing()
+	return editor
+}
+
+func TestEditingKeys(t *testing.T) {
+	tests := []struct {
+		name     string
+		keys     string
+		expected string
+	}{
+		{"typing", "print 1;\r", "print 1;"},
+		{"backspace", "print 12\x7f;\r", "print 1;"},
+		{"left arrow inserts mid line", "prnt\x1b[D\x1b[Di\r", "print"},
+		{"home and end", "rint\x1b[Hp\x1b[F;\r", "print;"},
+		{"ctrl-a and ctrl-e", "b\x01a\x05c\r", "abc"},
+		{"delete key", "abc\x1b[D\x1b[D\x1b[3~\r", "ac"},
+		{"kill to end", "abcdef\x1b[D\x1b[D\x1b[D\x0b\r", "abc"},
+		{"kill to start", "abcdef\x1b[D\x1b[D\x15\r", "ef"},
+		{"unicode", "é\x1b[Dà\r", "àé"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			line, readErr := editor(t, test.keys, nil).ReadLine("> ")
+			if readErr != nil {
+				t.Fatalf("Unexpected error: %v", readErr)
+			}
+			if line != test.expected {
+				t.Errorf("Expected %q, got %q", test.expected, line)
+			}
+		})
+	}
+}
+
+func TestHistoryBrowsing(t *testing.T) {
+	e := editor(t, "first\rsecond\r\x1b[A\x1b[A\r\x1b[A\x1b[A\x1b[Bx\r", nil)
+	expected := []string{"first", "second", "first", "firstx"}
+	for _, want := range expected {
+		line, readErr := e.ReadLine("> ")
+		if readErr != nil {
+			t.Fatalf("Unexpected error: %v", readErr)
+		}
+		if line != want {
+			t.Errorf("Expected %q, got %q", want, line)
+		}
+	}
+}
+
+func TestInterruptAndEndOfInput(t *testing.T) {
+	e := editor(t, "abc\x03\x04", nil)
+	if _, readErr := e.ReadLine("> "); !errors.Is(readErr, repl.ErrInterrupted) {
+		t.Errorf("Expected ctrl-c to interrupt, got %v", readErr)
+	}
+	if _, readErr := e.ReadLine("> "); readErr != io.EOF {
+		t.Errorf("Expected ctrl-d on an empty line to end input, got %v", readErr)
+	}
+}
+
+func TestPlainInput(t *testing.T) {
+	history, _ := repl.LoadHistory("")
+	e := repl.Create(bufio.NewReader(strings.NewReader("print 1;\r\nlast")), io.Discard, history)
+	for _, want := range []string{"print 1;", "last"} {
+		line, readErr := e.ReadLine("> ")
+		if readErr != nil || line != want {
+			t.Errorf("Expected %q, got %q (%v)", want, line, readErr)
+		}
+	}
+	if _, readErr := e.ReadLine("> "); readErr != io.EOF {
+		t.Errorf("Expected io.EOF, got %v", readErr)
+	}
+}
+
+func TestHistoryFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), repl.HISTORY_FILE)
+	history, loadErr := repl.LoadHistory(path)
+	if loadErr != nil {
+		t.Fatalf("Unexpected error: %v", loadErr)
+	}
+	for _, line := range []string{"var a = 1;", "var a = 1;", "  ", "print a;"} {
+		if addErr := history.Add(line); addErr != nil {
+			t.Fatalf("Unexpected error: %v", addErr)
+		}
+	}
+
+	reloaded, loadErr := repl.LoadHistory(path)
+	if loadErr != nil {
+		t.Fatalf("Unexpected error: %v", loadErr)
+	}
+	entries := reloaded.Entries()
+	if len(entries) != 2 || entries[0] != "var a = 1;" || entries[1] != "print a;" {
+		t.Errorf("Expected blank lines and repeats to be skipped, got %q", entries)
+	}
+}
+
+func TestHistoryIsTrimmed(t *testing.T) {
+	path := filepath.Join(t.TempDir(), repl.HISTORY_FILE)
+	lines := make([]string, repl.MAX_HISTORY+10)
+	for index := range lines {
+		lines[index] = strings.Repeat("x", index+1)
+	}
+	if writeErr := os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0o600); writeErr != nil {
+		t.Fatal(writeErr)
+	}
+
+	history, loadErr := repl.LoadHistory(path)
+	if loadErr != nil {
+		t.Fatalf("Unexpected error: %v", loadErr)
+	}
+	entries := history.Entries()
+	if len(entries) != repl.MAX_HISTORY || entries[0] != lines[10] {
+		t.Errorf("Expected the newest %d lines, got %d starting with %q", repl.MAX_HISTORY, len(entries), entries[0])
+	}
+}
+
+func TestTabCompletion(t *testing.T) {
+	names := []string{"print", "printAll", "point"}
+	completer := func(line string, cursor int) (int, []string) {
+		start := strings.LastIndex(line[:cursor], " ") + 1
+		candidates := []string{}
+		for _, name := range names {
+			if strings.HasPrefix(name, line[start:cursor]) {
+				candidates = append(candidates, name)
+			}
+		}
+		return start, candidates
+	}
+	tests := []struct {
+		name     string
+		keys     string
+		expected string
+	}{
+		{"single candidate", "print poi\t;\r", "print point;"},
+		{"common prefix", "pri\t\r", "print"},
+		{"ambiguous adds nothing", "print\t\r", "print"},
+		{"no candidates", "x\t\r", "x"},
+		{"indents at the start of a line", "\tprint;\r", "  print;"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			e := editor(t, test.keys, nil)
+			e.SetCompleter(completer)
+			line, readErr := e.ReadLine("> ")
+			if readErr != nil || line != test.expected {
+				t.Errorf("Expected %q, got %q (%v)", test.expected, line, readErr)
+			}
+		})
+	}
+}
+
+func TestHistoryWriteErrors(t *testing.T) {
+	// A directory that doesn't exist can't hold the history file
+	path := filepath.Join(t.TempDir(), "missing", repl.HISTORY_FILE)
+	history, _ := repl.LoadHistory(path)
+	editor := editor(t, "print 1;\rprint 2;\r", history)
+	reported := []error{}
+	editor.OnHistoryError(func(err error) {
+		reported = append(reported, err)
+	})
+
+	for _, expected := range []string{"print 1;", "print 2;"} {
+		line, readErr := editor.ReadLine("> ")
+		if readErr != nil || line != expected {
+			t.Fatalf("Expected %q, got %q (%v)", expected, line, readErr)
+		}
+	}
+	if len(reported) != 2 || !errors.Is(reported[0], os.ErrNotExist) {
+		t.Errorf("Expected both lines to report a missing directory, got %v", reported)
+	}
+	if entries := history.Entries(); len(entries) != 2 {
+		t.Errorf("Expected the session to keep its history anyway, got %q", entries)
+	}
+}
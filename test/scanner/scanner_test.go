@@ -0,0 +1,79 @@
+package test
+
+import (
+	"dsoechting/glox/scanner"
+	"dsoechting/glox/token"
+	"testing"
+)
+
+func TestTokenPositions(t *testing.T) {
+	source := "var answer = 42;\n  print \"two\nlines\";"
+	tokens, scanErr := scanner.Create(source).ScanTokens()
+	if scanErr != nil {
+		t.Fatalf("Failed to scan: %v", scanErr)
+	}
+
+	expected := []struct {
+		tokenType token.TokenType
+		line      int
+		column    int
+	}{
+		{token.VAR, 1, 1},
+		{token.IDENTIFIER, 1, 5},
+		{token.EQUAL, 1, 12},
+		{token.NUMBER, 1, 14},
+		{token.SEMICOLON, 1, 16},
+		{token.PRINT, 2, 3},
+		{token.STRING, 2, 9},
+		{token.SEMICOLON, 3, 7},
+		{token.EOF, 3, 8},
+	}
+	if len(tokens) != len(expected) {
+		t.Fatalf("Expected %d tokens, got %d", len(expected), len(tokens))
+	}
+	for i, want := range expected {
+		got := tokens[i]
+		if got.TokenType != want.tokenType || got.Line != want.line || got.Column != want.column {
+			t.Errorf("Token %d: expected %s at %d:%d, got %s at %d:%d",
+				i, want.tokenType, want.line, want.column, got.TokenType, got.Line, got.Column)
+		}
+		if got.TokenType != token.EOF && source[got.Start:got.End] != got.Lexeme {
+			t.Errorf("Token %d: offsets %d..%d don't cover %q", i, got.Start, got.End, got.Lexeme)
+		}
+	}
+}
+
+func TestCommentsAreKeptAsTrivia(t *testing.T) {
+	source := "// leading\nvar a = 1; // trailing\n/* block\ncomment */ print a;\n// last\n"
+	tokens, scanErr := scanner.Create(source).ScanTokens()
+	if scanErr != nil {
+		t.Fatalf("Failed to scan: %v", scanErr)
+	}
+
+	expected := map[int][]token.Comment{
+		// var
+		0: {{Text: "// leading", Line: 1, Start: 0, End: 10}},
+		// print
+		5: {
+			{Text: "// trailing", Line: 2, Start: 22, End: 33, IsTrailing: true},
+			{Text: "/* block\ncomment */", Line: 3, Start: 34, End: 53},
+		},
+		// EOF
+		8: {{Text: "// last", Line: 5, Start: 63, End: 70}},
+	}
+	for index, tok := range tokens {
+		want := expected[index]
+		if len(tok.Comments) != len(want) {
+			t.Errorf("Token %d '%s': expected %d comments, got %+v", index, tok.Lexeme, len(want), tok.Comments)
+			continue
+		}
+		for i := range want {
+			if tok.Comments[i] != want[i] {
+				t.Errorf("Token %d '%s': expected %+v, got %+v", index, tok.Lexeme, want[i], tok.Comments[i])
+			}
+		}
+	}
+	if tokens[5].Line != 4 {
+		t.Errorf("Expected the block comment's newline to be counted, print is on line %d", tokens[5].Line)
+	}
+}
@@ -1,6 +1,9 @@
 package token
 
-import "fmt"
+import (
+	"fmt"
+	"strings"
+)
 
 // Just run go generate in this directory to update the enum string
 //
@@ -65,6 +68,29 @@ type Token struct {
 	// TODO can I type param this?
 	Literal any
 	Line    int
+	// 1-based byte column of the first character, 0 for tokens made up by the compiler
+	Column int
+	// Byte offsets of the lexeme in the source, End is exclusive
+	Start int
+	End   int
+	// Comments between the previous token and this one, kept for tools like the formatter
+	Comments []Comment
+}
+
+// A // or /* */ comment, kept as trivia on the token that follows it
+type Comment struct {
+	// The whole comment, markers included
+	Text string
+	Line int
+	// Byte offsets in the source, End is exclusive
+	Start int
+	End   int
+	// Set when code comes before the comment on its line, as in "x = 1; // why"
+	IsTrailing bool
+}
+
+func (c Comment) IsBlock() bool {
+	return strings.HasPrefix(c.Text, "/*")
 }
 
 func Create(tokenType TokenType, lexeme string, literal any, line int) *Token {
@@ -76,6 +102,19 @@ func Create(tokenType TokenType, lexeme string, literal any, line int) *Token {
 	}
 }
 
+// Records where in the source the token was scanned from
+func (t *Token) At(column int, start int, end int) *Token {
+	t.Column = column
+	t.Start = start
+	t.End = end
+	return t
+}
+
+// Reports whether the token came from source text, rather than being synthesized
+func (t *Token) HasPosition() bool {
+	return t.Column > 0
+}
+
 func (t *Token) String() string {
 	return fmt.Sprintf("%s %s %s", t.TokenType, t.Lexeme, t.Literal)
 }
@@ -16,20 +16,28 @@ var exprTypes = []string{
 	"Ternary : Operator token.Token, First Expr, Second Expr, Third Expr",
 	"Assign : Name token.Token, Value Expr",
 	"Binary : Left Expr, Operator token.Token, Right Expr",
+	"Call : Callee Expr, Paren token.Token, Arguments []Expr",
+	"Get : Object Expr, Name token.Token",
 	"Grouping : Expression Expr",
-	"Literal : Value any",
+	"Literal : Token token.Token, Value any",
 	"Logical : Left Expr, Operator token.Token, Right Expr",
+	"Set : Object Expr, Name token.Token, Value Expr",
+	"Super : Keyword token.Token, Method token.Token",
+	"This : Keyword token.Token",
 	"Unary : Operator token.Token, Right Expr",
 	"Variable : Name token.Token",
 }
 
 var stmtTypes = []string{
 	"Block : Statements []Stmt",
+	"Class : Name token.Token, Superclass *VariableExpr, Methods []*FunctionStmt",
 	"Expression : Expression Expr",
-	"If : Condition Expr, ThenBranch Stmt, ElseBranch Stmt",
-	"Print : Expression Expr",
+	"Function : Name token.Token, Params []token.Token, Body []Stmt",
+	"If : Keyword token.Token, Condition Expr, ThenBranch Stmt, ElseBranch Stmt",
+	"Print : Keyword token.Token, Expression Expr",
+	"Return : Keyword token.Token, Value Expr",
 	"Var : Name token.Token, Initializer Expr",
-	"While : Condition Expr, Body Stmt",
+	"While : Keyword token.Token, Condition Expr, Body Stmt",
 }
 
 const EXPR string = "Expr"
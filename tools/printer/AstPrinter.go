@@ -1,4 +1,4 @@
-package main
+package printer
 
 import (
 	"dsoechting/glox/ast"
@@ -9,11 +9,20 @@ import (
 
 type Expr = ast.Expr
 type TernaryExpr = ast.TernaryExpr
+type AssignExpr = ast.AssignExpr
 type BinaryExpr = ast.BinaryExpr
+type CallExpr = ast.CallExpr
+type GetExpr = ast.GetExpr
+type SetExpr = ast.SetExpr
+type SuperExpr = ast.SuperExpr
+type ThisExpr = ast.ThisExpr
 type UnaryExpr = ast.UnaryExpr
 type GroupingExpr = ast.GroupingExpr
 type LiteralExpr = ast.LiteralExpr
+type LogicalExpr = ast.LogicalExpr
+type VariableExpr = ast.VariableExpr
 
+// Prints expressions in a Lisp like prefix form, such as (+ 1 (group (* 2 3)))
 type AstPrinter struct{}
 
 func (printer *AstPrinter) Print(expr Expr) string {
@@ -38,6 +47,30 @@ func (printer *AstPrinter) VisitBinary(expr *BinaryExpr) (any, error) {
 	return printer.parenthesize(expr.Operator.Lexeme, expr.Left, expr.Right), nil
 }
 
+func (printer *AstPrinter) VisitAssign(expr *AssignExpr) (any, error) {
+	return printer.parenthesize("= "+expr.Name.Lexeme, expr.Value), nil
+}
+
+func (printer *AstPrinter) VisitCall(expr *CallExpr) (any, error) {
+	return printer.parenthesize("call", append([]Expr{expr.Callee}, expr.Arguments...)...), nil
+}
+
+func (printer *AstPrinter) VisitGet(expr *GetExpr) (any, error) {
+	return printer.parenthesize("."+expr.Name.Lexeme, expr.Object), nil
+}
+
+func (printer *AstPrinter) VisitSet(expr *SetExpr) (any, error) {
+	return printer.parenthesize("= ."+expr.Name.Lexeme, expr.Object, expr.Value), nil
+}
+
+func (printer *AstPrinter) VisitSuper(expr *SuperExpr) (any, error) {
+	return "super." + expr.Method.Lexeme, nil
+}
+
+func (printer *AstPrinter) VisitThis(expr *ThisExpr) (any, error) {
+	return "this", nil
+}
+
 func (printer *AstPrinter) VisitGrouping(expr *GroupingExpr) (any, error) {
 	return printer.parenthesize("group", expr.Expression), nil
 }
@@ -46,6 +79,14 @@ func (printer *AstPrinter) VisitLiteral(expr *LiteralExpr) (any, error) {
 	return fmt.Sprint(expr.Value), nil
 }
 
+func (printer *AstPrinter) VisitLogical(expr *LogicalExpr) (any, error) {
+	return printer.parenthesize(expr.Operator.Lexeme, expr.Left, expr.Right), nil
+}
+
+func (printer *AstPrinter) VisitVariable(expr *VariableExpr) (any, error) {
+	return expr.Name.Lexeme, nil
+}
+
 func (printer *AstPrinter) VisitUnary(expr *UnaryExpr) (any, error) {
 	return printer.parenthesize(expr.Operator.Lexeme, expr.Right), nil
 }
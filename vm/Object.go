@@ -0,0 +1,121 @@
+package vm
+
+import (
+	"dsoechting/glox/compile"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+type Closure struct {
+	function *compile.Function
+	upvalues []*Upvalue
+}
+
+func (c *Closure) String() string {
+	return c.function.String()
+}
+
+// A captured variable. While open it points at a live stack slot, once the
+// slot's scope ends the value is moved into closed
+type Upvalue struct {
+	location int
+	closed   Value
+	isClosed bool
+	// Open upvalues form a list sorted by stack slot, highest first
+	next *Upvalue
+}
+
+func (u *Upvalue) get(vm *VM) Value {
+	if u.isClosed {
+		return u.closed
+	}
+	return vm.stack[u.location]
+}
+
+func (u *Upvalue) set(vm *VM, value Value) {
+	if u.isClosed {
+		u.closed = value
+		return
+	}
+	vm.stack[u.location] = value
+}
+
+type Class struct {
+	name    string
+	methods map[string]*Closure
+}
+
+func (c *Class) String() string {
+	return c.name
+}
+
+type Instance struct {
+	class  *Class
+	fields map[string]Value
+}
+
+// Field and method names, for tools such as completion. Classes hold copies
+// of their inherited methods, so those are included
+func (i *Instance) Members() []string {
+	members := []string{}
+	for name := range i.fields {
+		members = append(members, name)
+	}
+	for name := range i.class.methods {
+		members = append(members, name)
+	}
+	return members
+}
+
+func (i *Instance) String() string {
+	return fmt.Sprintf("%s instance", i.class.name)
+}
+
+type BoundMethod struct {
+	receiver Value
+	method   *Closure
+}
+
+func (b *BoundMethod) String() string {
+	return b.method.String()
+}
+
+// Go functions exposed to glox scripts as globals
+type Native struct {
+	name     string
+	arity    int
+	function func(arguments []Value) (Value, error)
+}
+
+func (n *Native) String() string {
+	return fmt.Sprintf("<native fn %s>", n.name)
+}
+
+var clock = &Native{
+	name:  "clock",
+	arity: 0,
+	function: func(arguments []Value) (Value, error) {
+		return compile.NumberValue(float64(time.Now().UnixMilli()) / 1000.0), nil
+	},
+}
+
+// Reads a line from the VM's input, or nil once the input is exhausted
+func (vm *VM) defineReadLine() {
+	readLine := &Native{
+		name:  "readLine",
+		arity: 0,
+		function: func(arguments []Value) (Value, error) {
+			line, err := vm.stdin.ReadString('\n')
+			if err == io.EOF && line == "" {
+				return compile.NilValue(), nil
+			}
+			if err != nil && err != io.EOF {
+				return compile.NilValue(), err
+			}
+			return compile.ObjValue(strings.TrimRight(line, "\r\n")), nil
+		},
+	}
+	vm.globals[readLine.name] = compile.ObjValue(readLine)
+}
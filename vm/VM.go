@@ -0,0 +1,565 @@
+package vm
+
+import (
+	"bufio"
+	"dsoechting/glox/compile"
+	glox_error "dsoechting/glox/error"
+	"errors"
+	"fmt"
+)
+
+type Value = compile.Value
+type Function = compile.Function
+type OpCode = compile.OpCode
+
+const FRAMES_MAX = 256
+
+// Every frame can address 256 slots, the stack grows whenever it fills up
+const initialStackSize = 64 * 256
+
+type CallFrame struct {
+	closure *Closure
+	ip      int
+	// Index of the frame's slot zero on the value stack
+	slots int
+}
+
+type VM struct {
+	frames     []CallFrame
+	frameCount int
+	stack      []Value
+	// Index of the next free stack slot
+	sp           int
+	globals      map[string]Value
+	openUpvalues *Upvalue
+	// Values of top level expression statements, for the REPL
+	echoes  []Value
+	options Options
+	stdin   *bufio.Reader
+}
+
+func Create() *VM {
+	return CreateWithOptions(Options{})
+}
+
+func CreateWithOptions(options Options) *VM {
+	options = options.withDefaults()
+	vm := &VM{
+		frames:  make([]CallFrame, FRAMES_MAX),
+		stack:   make([]Value, initialStackSize),
+		globals: make(map[string]Value),
+		options: options,
+		stdin:   bufferInput(options.Stdin),
+	}
+	vm.globals[clock.name] = compile.ObjValue(clock)
+	vm.defineReadLine()
+	return vm
+}
+
+// A copy of the global variables, for tools such as the REPL's :env
+func (vm *VM) Globals() map[string]Value {
+	globals := make(map[string]Value, len(vm.globals))
+	for name, value := range vm.globals {
+		globals[name] = value
+	}
+	return globals
+}
+
+// Runs a compiled script. Globals persist between calls, so the REPL can feed it one line at a time.
+// Returns the values of the top level expression statements, for the REPL to echo
+func (vm *VM) Interpret(function *Function) ([]Value, error) {
+	vm.echoes = []Value{}
+
+	closure := &Closure{
+		function: function,
+		upvalues: []*Upvalue{},
+	}
+	vm.push(compile.ObjValue(closure))
+	callErr := vm.call(closure, 0)
+	if callErr != nil {
+		vm.resetStack()
+		return nil, callErr
+	}
+
+	runErr := vm.run()
+	if runErr != nil {
+		vm.resetStack()
+		return nil, runErr
+	}
+	return vm.echoes, nil
+}
+
+func (vm *VM) run() error {
+	frame := &vm.frames[vm.frameCount-1]
+	code := frame.closure.function.Chunk.Code
+	constants := frame.closure.function.Chunk.Constants
+	ip := frame.ip
+
+	readShort := func() uint16 {
+		ip += 2
+		return uint16(code[ip-2])<<8 | uint16(code[ip-1])
+	}
+	readString := func() string {
+		return constants[readShort()].Obj.(string)
+	}
+	// Frames switch on calls and returns, so the cached state is swapped with them
+	saveFrame := func() {
+		frame.ip = ip
+	}
+	loadFrame := func() {
+		frame = &vm.frames[vm.frameCount-1]
+		code = frame.closure.function.Chunk.Code
+		constants = frame.closure.function.Chunk.Constants
+		ip = frame.ip
+	}
+	runtimeError := func(code glox_error.Code, format string, args ...any) error {
+		saveFrame()
+		return vm.runtimeError(code, format, args...)
+	}
+
+	for {
+		instruction := OpCode(code[ip])
+		ip++
+
+		switch instruction {
+		case compile.OP_CONSTANT:
+			vm.push(constants[readShort()])
+		case compile.OP_NIL:
+			vm.push(compile.NilValue())
+		case compile.OP_TRUE:
+			vm.push(compile.BoolValue(true))
+		case compile.OP_FALSE:
+			vm.push(compile.BoolValue(false))
+		case compile.OP_POP:
+			vm.sp--
+		case compile.OP_GET_LOCAL:
+			slot := int(code[ip])
+			ip++
+			vm.push(vm.stack[frame.slots+slot])
+		case compile.OP_SET_LOCAL:
+			slot := int(code[ip])
+			ip++
+			vm.stack[frame.slots+slot] = vm.peek(0)
+		case compile.OP_GET_GLOBAL:
+			name := readString()
+			value, isPresent := vm.globals[name]
+			if !isPresent {
+				return runtimeError(glox_error.UNDEFINED_VARIABLE, "Undefined variable '%s'.", name)
+			}
+			vm.push(value)
+		case compile.OP_DEFINE_GLOBAL:
+			name := readString()
+			vm.globals[name] = vm.peek(0)
+			vm.sp--
+		case compile.OP_SET_GLOBAL:
+			name := readString()
+			if _, isPresent := vm.globals[name]; !isPresent {
+				return runtimeError(glox_error.UNDEFINED_VARIABLE, "Undefined variable '%s'.", name)
+			}
+			vm.globals[name] = vm.peek(0)
+		case compile.OP_GET_UPVALUE:
+			slot := int(code[ip])
+			ip++
+			vm.push(frame.closure.upvalues[slot].get(vm))
+		case compile.OP_SET_UPVALUE:
+			slot := int(code[ip])
+			ip++
+			frame.closure.upvalues[slot].set(vm, vm.peek(0))
+		case compile.OP_GET_PROPERTY:
+			instance, isInstance := vm.peek(0).Obj.(*Instance)
+			if !isInstance {
+				return runtimeError(glox_error.NOT_AN_INSTANCE, "Only instances have properties.")
+			}
+			name := readString()
+
+			// Fields shadow methods of the same name
+			if value, isField := instance.fields[name]; isField {
+				vm.stack[vm.sp-1] = value
+				break
+			}
+			if !vm.bindMethod(instance.class, name) {
+				return runtimeError(glox_error.UNDEFINED_PROPERTY, "Undefined property '%s'.", name)
+			}
+		case compile.OP_SET_PROPERTY:
+			instance, isInstance := vm.peek(1).Obj.(*Instance)
+			if !isInstance {
+				return runtimeError(glox_error.NOT_AN_INSTANCE, "Only instances have fields.")
+			}
+			instance.fields[readString()] = vm.peek(0)
+			value := vm.pop()
+			vm.stack[vm.sp-1] = value
+		case compile.OP_GET_SUPER:
+			name := readString()
+			superclass := vm.pop().Obj.(*Class)
+			if !vm.bindMethod(superclass, name) {
+				return runtimeError(glox_error.UNDEFINED_PROPERTY, "Undefined property '%s'.", name)
+			}
+		case compile.OP_EQUAL:
+			if !vm.peek(0).IsNumber() || !vm.peek(1).IsNumber() {
+				return runtimeError(glox_error.INVALID_OPERAND, glox_error.OPERANDS_MUST_BE_NUMBERS)
+			}
+			b := vm.pop()
+			a := vm.pop()
+			vm.push(compile.BoolValue(a.Equals(b)))
+		case compile.OP_GREATER:
+			if !vm.peek(0).IsNumber() || !vm.peek(1).IsNumber() {
+				return runtimeError(glox_error.INVALID_OPERAND, glox_error.OPERANDS_MUST_BE_NUMBERS)
+			}
+			b := vm.pop()
+			vm.stack[vm.sp-1] = compile.BoolValue(vm.stack[vm.sp-1].Number > b.Number)
+		case compile.OP_LESS:
+			if !vm.peek(0).IsNumber() || !vm.peek(1).IsNumber() {
+				return runtimeError(glox_error.INVALID_OPERAND, glox_error.OPERANDS_MUST_BE_NUMBERS)
+			}
+			b := vm.pop()
+			vm.stack[vm.sp-1] = compile.BoolValue(vm.stack[vm.sp-1].Number < b.Number)
+		case compile.OP_ADD:
+			b := vm.peek(0)
+			a := vm.peek(1)
+			if a.IsNumber() && b.IsNumber() {
+				vm.sp--
+				vm.stack[vm.sp-1] = compile.NumberValue(a.Number + b.Number)
+			} else if a.IsString() && b.IsString() {
+				vm.sp--
+				vm.stack[vm.sp-1] = compile.ObjValue(a.Obj.(string) + b.Obj.(string))
+			} else {
+				return runtimeError(glox_error.INVALID_OPERAND, glox_error.OPERANDS_MUST_BE_ADDABLE)
+			}
+		case compile.OP_SUBTRACT:
+			if !vm.peek(0).IsNumber() || !vm.peek(1).IsNumber() {
+				return runtimeError(glox_error.INVALID_OPERAND, glox_error.OPERANDS_MUST_BE_NUMBERS)
+			}
+			b := vm.pop()
+			vm.stack[vm.sp-1].Number -= b.Number
+		case compile.OP_MULTIPLY:
+			if !vm.peek(0).IsNumber() || !vm.peek(1).IsNumber() {
+				return runtimeError(glox_error.INVALID_OPERAND, glox_error.OPERANDS_MUST_BE_NUMBERS)
+			}
+			b := vm.pop()
+			vm.stack[vm.sp-1].Number *= b.Number
+		case compile.OP_DIVIDE:
+			if !vm.peek(0).IsNumber() || !vm.peek(1).IsNumber() {
+				return runtimeError(glox_error.INVALID_OPERAND, glox_error.OPERANDS_MUST_BE_NUMBERS)
+			}
+			b := vm.pop()
+			vm.stack[vm.sp-1].Number /= b.Number
+		case compile.OP_NOT:
+			if !vm.peek(0).IsNumber() {
+				return runtimeError(glox_error.INVALID_OPERAND, glox_error.OPERAND_MUST_BE_NUMBER)
+			}
+			vm.stack[vm.sp-1] = compile.BoolValue(vm.stack[vm.sp-1].IsFalsey())
+		case compile.OP_INVERT:
+			vm.stack[vm.sp-1] = compile.BoolValue(vm.stack[vm.sp-1].IsFalsey())
+		case compile.OP_NEGATE:
+			if !vm.peek(0).IsNumber() {
+				return runtimeError(glox_error.INVALID_OPERAND, glox_error.OPERAND_MUST_BE_NUMBER)
+			}
+			vm.stack[vm.sp-1].Number = -vm.stack[vm.sp-1].Number
+		case compile.OP_PRINT:
+			fmt.Fprintln(vm.options.Stdout, vm.pop().String())
+		case compile.OP_ECHO:
+			vm.echoes = append(vm.echoes, vm.pop())
+		case compile.OP_JUMP:
+			offset := readShort()
+			ip += int(offset)
+		case compile.OP_JUMP_IF_FALSE:
+			offset := readShort()
+			if vm.peek(0).IsFalsey() {
+				ip += int(offset)
+			}
+		case compile.OP_LOOP:
+			offset := readShort()
+			ip -= int(offset)
+		case compile.OP_CALL:
+			argCount := int(code[ip])
+			ip++
+			saveFrame()
+			callErr := vm.callValue(vm.peek(argCount), argCount)
+			if callErr != nil {
+				return callErr
+			}
+			loadFrame()
+		case compile.OP_INVOKE:
+			name := readString()
+			argCount := int(code[ip])
+			ip++
+			saveFrame()
+			invokeErr := vm.invoke(name, argCount)
+			if invokeErr != nil {
+				return invokeErr
+			}
+			loadFrame()
+		case compile.OP_SUPER_INVOKE:
+			name := readString()
+			argCount := int(code[ip])
+			ip++
+			saveFrame()
+			superclass := vm.pop().Obj.(*Class)
+			invokeErr := vm.invokeFromClass(superclass, name, argCount)
+			if invokeErr != nil {
+				return invokeErr
+			}
+			loadFrame()
+		case compile.OP_CLOSURE:
+			function := constants[readShort()].Obj.(*Function)
+			closure := &Closure{
+				function: function,
+				upvalues: make([]*Upvalue, function.UpvalueCount),
+			}
+			vm.push(compile.ObjValue(closure))
+			for i := range closure.upvalues {
+				isLocal := code[ip]
+				index := int(code[ip+1])
+				ip += 2
+				if isLocal == 1 {
+					closure.upvalues[i] = vm.captureUpvalue(frame.slots + index)
+				} else {
+					closure.upvalues[i] = frame.closure.upvalues[index]
+				}
+			}
+		case compile.OP_CLOSE_UPVALUE:
+			vm.closeUpvalues(vm.sp - 1)
+			vm.sp--
+		case compile.OP_RETURN:
+			result := vm.pop()
+			vm.closeUpvalues(frame.slots)
+			vm.frameCount--
+			if vm.frameCount == 0 {
+				// Discard the script closure
+				vm.sp--
+				return nil
+			}
+			vm.sp = frame.slots
+			vm.push(result)
+			loadFrame()
+		case compile.OP_CLASS:
+			vm.push(compile.ObjValue(&Class{
+				name:    readString(),
+				methods: make(map[string]*Closure),
+			}))
+		case compile.OP_INHERIT:
+			superclass, isClass := vm.peek(1).Obj.(*Class)
+			if !isClass {
+				return runtimeError(glox_error.SUPERCLASS_NOT_CLASS, "Superclass must be a class.")
+			}
+			subclass := vm.peek(0).Obj.(*Class)
+			// Copy down inherited methods, the subclass's own overwrite them afterwards
+			for name, method := range superclass.methods {
+				subclass.methods[name] = method
+			}
+			vm.sp--
+		case compile.OP_METHOD:
+			name := readString()
+			method := vm.peek(0).Obj.(*Closure)
+			class := vm.peek(1).Obj.(*Class)
+			class.methods[name] = method
+			vm.sp--
+		default:
+			return runtimeError(glox_error.INVALID_BYTECODE, "Unknown opcode %d.", instruction)
+		}
+	}
+}
+
+func (vm *VM) callValue(callee Value, argCount int) error {
+	switch object := callee.Obj.(type) {
+	case *BoundMethod:
+		vm.stack[vm.sp-argCount-1] = object.receiver
+		return vm.call(object.method, argCount)
+	case *Class:
+		vm.stack[vm.sp-argCount-1] = compile.ObjValue(&Instance{
+			class:  object,
+			fields: make(map[string]Value),
+		})
+		if initializer, hasInit := object.methods["init"]; hasInit {
+			return vm.call(initializer, argCount)
+		}
+		if argCount != 0 {
+			return vm.runtimeError(glox_error.WRONG_ARGUMENT_COUNT, "Expected 0 arguments but got %d.", argCount)
+		}
+		return nil
+	case *Closure:
+		return vm.call(object, argCount)
+	case *Native:
+		if argCount != object.arity {
+			return vm.runtimeError(glox_error.WRONG_ARGUMENT_COUNT, "Expected %d arguments but got %d.", object.arity, argCount)
+		}
+		result, nativeErr := object.function(vm.stack[vm.sp-argCount : vm.sp])
+		if nativeErr != nil {
+			return vm.nativeError(nativeErr)
+		}
+		vm.sp -= argCount + 1
+		vm.push(result)
+		return nil
+	}
+	return vm.runtimeError(glox_error.NOT_CALLABLE, "Can only call functions and classes.")
+}
+
+func (vm *VM) call(closure *Closure, argCount int) error {
+	if argCount != closure.function.Arity {
+		return vm.runtimeError(glox_error.WRONG_ARGUMENT_COUNT, "Expected %d arguments but got %d.", closure.function.Arity, argCount)
+	}
+	if vm.frameCount == FRAMES_MAX {
+		return vm.runtimeError(glox_error.STACK_OVERFLOW, "Stack overflow.")
+	}
+	vm.ensureStack()
+
+	vm.frames[vm.frameCount] = CallFrame{
+		closure: closure,
+		ip:      0,
+		slots:   vm.sp - argCount - 1,
+	}
+	vm.frameCount++
+	return nil
+}
+
+func (vm *VM) invoke(name string, argCount int) error {
+	receiver := vm.peek(argCount)
+	instance, isInstance := receiver.Obj.(*Instance)
+	if !isInstance {
+		return vm.runtimeError(glox_error.NOT_AN_INSTANCE, "Only instances have methods.")
+	}
+
+	// A field holding a callable shadows any method
+	if value, isField := instance.fields[name]; isField {
+		vm.stack[vm.sp-argCount-1] = value
+		return vm.callValue(value, argCount)
+	}
+	return vm.invokeFromClass(instance.class, name, argCount)
+}
+
+func (vm *VM) invokeFromClass(class *Class, name string, argCount int) error {
+	method, isPresent := class.methods[name]
+	if !isPresent {
+		return vm.runtimeError(glox_error.UNDEFINED_PROPERTY, "Undefined property '%s'.", name)
+	}
+	return vm.call(method, argCount)
+}
+
+// Replaces the instance on top of the stack with one of its methods bound to it
+func (vm *VM) bindMethod(class *Class, name string) bool {
+	method, isPresent := class.methods[name]
+	if !isPresent {
+		return false
+	}
+	bound := &BoundMethod{
+		receiver: vm.peek(0),
+		method:   method,
+	}
+	vm.stack[vm.sp-1] = compile.ObjValue(bound)
+	return true
+}
+
+// Reuses an existing open upvalue so closures capturing the same variable share it
+func (vm *VM) captureUpvalue(location int) *Upvalue {
+	var previous *Upvalue
+	upvalue := vm.openUpvalues
+	for upvalue != nil && upvalue.location > location {
+		previous = upvalue
+		upvalue = upvalue.next
+	}
+	if upvalue != nil && upvalue.location == location {
+		return upvalue
+	}
+
+	created := &Upvalue{
+		location: location,
+		next:     upvalue,
+	}
+	if previous == nil {
+		vm.openUpvalues = created
+	} else {
+		previous.next = created
+	}
+	return created
+}
+
+// Closes every open upvalue pointing at or above the given stack slot
+func (vm *VM) closeUpvalues(last int) {
+	for vm.openUpvalues != nil && vm.openUpvalues.location >= last {
+		upvalue := vm.openUpvalues
+		upvalue.closed = vm.stack[upvalue.location]
+		upvalue.isClosed = true
+		vm.openUpvalues = upvalue.next
+	}
+}
+
+// Upvalues refer to stack slots by index, so growing the stack never invalidates them
+func (vm *VM) ensureStack() {
+	if vm.sp+256 < len(vm.stack) {
+		return
+	}
+	vm.growStack()
+}
+
+func (vm *VM) growStack() {
+	grown := make([]Value, len(vm.stack)*2)
+	copy(grown, vm.stack)
+	vm.stack = grown
+}
+
+func (vm *VM) push(value Value) {
+	// Deeply nested expressions can pile up more temporaries than a call reserves
+	if vm.sp == len(vm.stack) {
+		vm.growStack()
+	}
+	vm.stack[vm.sp] = value
+	vm.sp++
+}
+
+func (vm *VM) pop() Value {
+	vm.sp--
+	return vm.stack[vm.sp]
+}
+
+func (vm *VM) peek(distance int) Value {
+	return vm.stack[vm.sp-1-distance]
+}
+
+func (vm *VM) resetStack() {
+	vm.sp = 0
+	vm.frameCount = 0
+	vm.openUpvalues = nil
+}
+
+func (vm *VM) runtimeError(code glox_error.Code, format string, args ...any) error {
+	diagnostic := glox_error.Create(code, vm.currentLine(), "", fmt.Sprintf(format, args...))
+	diagnostic.Span = vm.currentSpan()
+	return &glox_error.RuntimeError{Diagnostic: diagnostic, Trace: vm.trace()}
+}
+
+// Host errors are wrapped so errors.Is still finds them, unless they are already diagnostics
+func (vm *VM) nativeError(err error) error {
+	var reportable glox_error.Reportable
+	if errors.As(err, &reportable) {
+		return err
+	}
+	diagnostic := glox_error.Wrap(glox_error.NATIVE_FAILURE, vm.currentLine(), "", err)
+	diagnostic.Span = vm.currentSpan()
+	return &glox_error.RuntimeError{Diagnostic: diagnostic, Trace: vm.trace()}
+}
+
+// The active frames, innermost first
+func (vm *VM) trace() []glox_error.Frame {
+	trace := make([]glox_error.Frame, 0, vm.frameCount)
+	for i := vm.frameCount - 1; i >= 0; i-- {
+		frame := &vm.frames[i]
+		function := frame.closure.function
+		name := function.Name
+		if name == "" {
+			name = glox_error.SCRIPT_FRAME
+		}
+		trace = append(trace, glox_error.Frame{Name: name, Line: function.Chunk.GetLine(frame.ip - 1)})
+	}
+	return trace
+}
+
+func (vm *VM) currentLine() int {
+	frame := &vm.frames[vm.frameCount-1]
+	// The ip has already moved past the failing instruction
+	return frame.closure.function.Chunk.GetLine(frame.ip - 1)
+}
+
+func (vm *VM) currentSpan() glox_error.Span {
+	frame := &vm.frames[vm.frameCount-1]
+	return frame.closure.function.Chunk.GetSpan(frame.ip - 1)
+}